@@ -1,10 +1,16 @@
 package main
 
-import "time"
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
 
 // Account represents an account
+// The balance is in the currency of the account
 type Account struct {
-	Balance    float64        `json:"balance"`
+	Balance    Money          `json:"balance"`
+	Currency   string         `json:"currency"`
 	ID         string         `json:"id"`
 	Operations *OperationPool `json:"-"`
 	UpdatedAt  time.Time      `json:"updated_at"`
@@ -26,3 +32,84 @@ func (a *Account) init() *Account {
 	a.Operations = newOperationPool()
 	return a
 }
+
+// setDefaults sets the fields that didn't exist when the account was stored
+// Accounts were in the default currency before they had one
+func (a *Account) setDefaults() {
+	if a.Currency == "" {
+		if a.Currency = a.Balance.Currency; a.Currency == "" {
+			a.Currency = currencyDefault
+		}
+	}
+	if a.Balance.Currency == "" {
+		a.Balance.Currency = a.Currency
+	}
+}
+
+// OpeningBalance returns the balance before the first operation
+func (a *Account) OpeningBalance() (m Money, err error) {
+	// Total
+	var t Money
+	if t, err = a.Operations.Total(); err != nil {
+		err = errors.Wrap(err, "computing total failed")
+		return
+	}
+
+	// Subtract
+	if m, err = a.Balance.Sub(t); err != nil {
+		err = errors.Wrap(err, "subtracting total from balance failed")
+		return
+	}
+	return
+}
+
+// BalanceAt returns the balance at the end of a specific date
+func (a *Account) BalanceAt(t time.Time) (m Money, err error) {
+	// Opening balance
+	var opening Money
+	if opening, err = a.OpeningBalance(); err != nil {
+		err = errors.Wrap(err, "computing opening balance failed")
+		return
+	}
+
+	// Cumulated
+	var cumulated Money
+	if cumulated, err = a.Operations.CumulatedAt(t); err != nil {
+		err = errors.Wrap(err, "computing cumulated amount failed")
+		return
+	}
+
+	// Add
+	if m, err = opening.Add(cumulated); err != nil {
+		err = errors.Wrap(err, "adding cumulated amount to opening balance failed")
+		return
+	}
+	return
+}
+
+// RunningBalances returns the operations sorted by date along with the balance after each of them
+func (a *Account) RunningBalances() (ops []*Operation, bs []Money, err error) {
+	// Opening balance
+	var opening Money
+	if opening, err = a.OpeningBalance(); err != nil {
+		err = errors.Wrap(err, "computing opening balance failed")
+		return
+	}
+
+	// Cumulated
+	var cumulated []Money
+	if ops, cumulated, err = a.Operations.ByDate(); err != nil {
+		err = errors.Wrap(err, "sorting operations failed")
+		return
+	}
+
+	// Add
+	bs = make([]Money, len(cumulated))
+	for idx, m := range cumulated {
+		if bs[idx], err = opening.Add(m); err != nil {
+			err = errors.Wrap(err, "adding cumulated amount to opening balance failed")
+			return
+		}
+	}
+	return
+}
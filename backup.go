@@ -0,0 +1,164 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// Constants
+// Backup names have nanoseconds so that backups made within the same second don't overwrite each other. Names without
+// them, written by previous versions, are parsed as well since fractional seconds following the seconds are accepted.
+const (
+	backupTimeLayout       = "20060102-150405"
+	backupTimeLayoutFormat = "20060102-150405.000000000"
+)
+
+// BackupOptions represents backup options
+// The most recent backup of each of the last Daily days and of each of the last Monthly months are kept
+type BackupOptions struct {
+	Daily   int
+	Monthly int
+}
+
+// enabled checks whether backups are enabled
+func (o BackupOptions) enabled() bool {
+	return o.Daily > 0 || o.Monthly > 0
+}
+
+// backupStore represents a store that can back up its content
+type backupStore interface {
+	Backup(path string) error
+	Path() string
+}
+
+// backup represents a backup
+type backup struct {
+	path string
+	time time.Time
+}
+
+// backupsDirPath returns the path of the dir containing the backups of a store
+func backupsDirPath(storePath string) string {
+	return filepath.Join(filepath.Dir(storePath), "backups")
+}
+
+// backupNameParts returns the parts of a store file name backup names are built with
+func backupNameParts(storePath string) (prefix, ext string) {
+	ext = filepath.Ext(storePath)
+	prefix = strings.TrimSuffix(filepath.Base(storePath), ext) + "-"
+	return
+}
+
+// newBackupPath returns the path of a new backup of a store
+func newBackupPath(storePath string, t time.Time) string {
+	var prefix, ext = backupNameParts(storePath)
+	return filepath.Join(backupsDirPath(storePath), prefix+t.Format(backupTimeLayoutFormat)+ext)
+}
+
+// listBackups lists the backups of a store from the most recent to the oldest
+func listBackups(storePath string) (bs []backup, err error) {
+	// Read dir
+	var fs []os.FileInfo
+	if fs, err = ioutil.ReadDir(backupsDirPath(storePath)); os.IsNotExist(err) {
+		err = nil
+		return
+	} else if err != nil {
+		err = errors.Wrapf(err, "reading dir %s failed", backupsDirPath(storePath))
+		return
+	}
+
+	// Loop through files
+	var prefix, ext = backupNameParts(storePath)
+	for _, f := range fs {
+		// Invalid name
+		if f.IsDir() || !strings.HasPrefix(f.Name(), prefix) || !strings.HasSuffix(f.Name(), ext) {
+			continue
+		}
+
+		// Parse time
+		t, errParse := time.ParseInLocation(backupTimeLayout, strings.TrimSuffix(strings.TrimPrefix(f.Name(), prefix), ext), time.Local)
+		if errParse != nil {
+			continue
+		}
+		bs = append(bs, backup{path: filepath.Join(backupsDirPath(storePath), f.Name()), time: t})
+	}
+
+	// Sort
+	sort.Slice(bs, func(i, j int) bool { return bs[i].time.After(bs[j].time) })
+	return
+}
+
+// createBackup backs up a store and removes the backups that are not retained anymore
+func createBackup(s backupStore, o BackupOptions) (err error) {
+	// Create dir
+	if err = os.MkdirAll(backupsDirPath(s.Path()), 0700); err != nil {
+		err = errors.Wrapf(err, "mkdirall %s failed", backupsDirPath(s.Path()))
+		return
+	}
+
+	// Back up
+	var p = newBackupPath(s.Path(), time.Now())
+	astilog.Debugf("Backing up %s to %s", s.Path(), p)
+	if err = s.Backup(p); err != nil {
+		err = errors.Wrapf(err, "backing up to %s failed", p)
+		return
+	}
+
+	// Prune
+	if err = pruneBackups(s.Path(), o); err != nil {
+		err = errors.Wrap(err, "pruning backups failed")
+		return
+	}
+	return
+}
+
+// pruneBackups removes the backups that are not retained
+func pruneBackups(storePath string, o BackupOptions) (err error) {
+	// List backups
+	var bs []backup
+	if bs, err = listBackups(storePath); err != nil {
+		err = errors.Wrap(err, "listing backups failed")
+		return
+	}
+
+	// Loop through backups
+	var days, months = make(map[string]bool), make(map[string]bool)
+	for _, b := range bs {
+		// Keep the most recent backup of the day or of the month
+		var day, month = b.time.Format("2006-01-02"), b.time.Format("2006-01")
+		var keep bool
+		if _, ok := days[day]; !ok && len(days) < o.Daily {
+			days[day] = true
+			keep = true
+		}
+		if _, ok := months[month]; !ok && len(months) < o.Monthly {
+			months[month] = true
+			keep = true
+		}
+		if keep {
+			continue
+		}
+
+		// Remove
+		astilog.Debugf("Removing backup %s", b.path)
+		if err = os.Remove(b.path); err != nil {
+			err = errors.Wrapf(err, "removing %s failed", b.path)
+			return
+		}
+
+		// Remove journal
+		if err = os.Remove(journalPath(b.path)); err != nil && !os.IsNotExist(err) {
+			err = errors.Wrapf(err, "removing %s failed", journalPath(b.path))
+			return
+		}
+		err = nil
+	}
+	return
+}
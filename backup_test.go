@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListBackups(t *testing.T) {
+	// Create backups
+	// Two of them are made within the same second and one has a name without nanoseconds
+	var p = filepath.Join(t.TempDir(), "data.bin")
+	var now = time.Date(2018, 1, 2, 3, 4, 5, 0, time.Local)
+	var paths = []string{
+		filepath.Join(backupsDirPath(p), "data-20180101-030405.bin"),
+		newBackupPath(p, now.Add(time.Millisecond)),
+		newBackupPath(p, now.Add(2*time.Millisecond)),
+	}
+	if paths[1] == paths[2] {
+		t.Fatalf("expected backups made within the same second to have different paths, got %s", paths[1])
+	}
+	if err := os.MkdirAll(backupsDirPath(p), 0700); err != nil {
+		t.Fatalf("mkdirall failed: %v", err)
+	}
+	for _, bp := range append(paths, filepath.Join(backupsDirPath(p), "data-invalid.bin")) {
+		if err := ioutil.WriteFile(bp, []byte("backup"), 0600); err != nil {
+			t.Fatalf("writing %s failed: %v", bp, err)
+		}
+	}
+
+	// List
+	bs, err := listBackups(p)
+	if err != nil {
+		t.Fatalf("listing backups failed: %v", err)
+	} else if len(bs) != 3 {
+		t.Fatalf("expected 3 backups, got %+v", bs)
+	}
+	for idx, b := range bs {
+		if e := paths[len(paths)-1-idx]; b.path != e {
+			t.Errorf("backup #%d: expected %s, got %s", idx+1, e, b.path)
+		}
+	}
+	if !bs[0].time.Equal(now.Add(2 * time.Millisecond)) {
+		t.Errorf("expected time %s, got %s", now.Add(2*time.Millisecond), bs[0].time)
+	}
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/term"
+)
+
+// Constants
+const (
+	envPassphrase = "ASTIBANK_PASSPHRASE"
+)
+
+// Flags
+var (
+	changePassphrase = flag.Bool("change-passphrase", false, "change the passphrase of the data file")
+	decrypt          = flag.Bool("decrypt", false, "decrypt the data file")
+	decryptTo        = flag.String("decrypt-to", "", "export a decrypted copy of the data to this path")
+	encrypt          = flag.Bool("encrypt", false, "encrypt the data file with a passphrase")
+	exportJSON       = flag.String("export", "", "export the data as JSON to this path")
+	importJSON       = flag.String("import", "", "replace the data with the JSON data located at this path")
+	restore          = flag.Bool("restore", false, "list backups and restore one of them")
+)
+
+// runCommand runs the command requested through flags, if any, and returns whether one has been run
+func runCommand(baseDirPath string, o DataOptions) (ok bool, err error) {
+	// Restore and import replace the data and therefore don't load it
+	if *restore || *importJSON != "" {
+		// Check read-only
+		if o.ReadOnly {
+			err = errReadOnly
+			return
+		}
+
+		// Lock dir
+		var l *dirLock
+		if l, err = lockDir(baseDirPath); err != nil {
+			err = errors.Wrapf(err, "locking %s failed", baseDirPath)
+			return
+		}
+		defer l.unlock()
+	}
+	if *restore {
+		ok = true
+		if err = commandRestore(baseDirPath, o); err != nil {
+			err = errors.Wrap(err, "restoring failed")
+			return
+		}
+		return
+	} else if *importJSON != "" {
+		ok = true
+		if err = commandImportJSON(baseDirPath, o); err != nil {
+			err = errors.Wrap(err, "importing JSON failed")
+			return
+		}
+		return
+	}
+
+	// Get command
+	var fn func(d *Data) error
+	switch {
+	case *changePassphrase, *encrypt:
+		fn = commandSetPassphrase
+	case *decrypt:
+		fn = commandDecrypt
+	case *decryptTo != "":
+		fn = commandDecryptTo
+	case *exportJSON != "":
+		fn = commandExportJSON
+	default:
+		return
+	}
+	ok = true
+
+	// Import data
+	var d *Data
+	if d, err = NewData(baseDirPath, o); err != nil {
+		err = errors.Wrap(err, "importing data failed")
+		return
+	}
+	defer d.Close()
+
+	// Run command
+	if err = fn(d); err != nil {
+		err = errors.Wrap(err, "running command failed")
+		return
+	}
+	return
+}
+
+// commandSetPassphrase sets a new passphrase
+func commandSetPassphrase(d *Data) (err error) {
+	// Ask new passphrase
+	var p []byte
+	if p, err = askNewPassphrase(); err != nil {
+		err = errors.Wrap(err, "asking new passphrase failed")
+		return
+	}
+
+	// Set passphrase
+	if err = d.SetPassphrase(p); err != nil {
+		err = errors.Wrap(err, "setting passphrase failed")
+		return
+	}
+	fmt.Println("Data has been encrypted with the new passphrase")
+	return
+}
+
+// commandDecrypt decrypts the data file
+func commandDecrypt(d *Data) (err error) {
+	if err = d.SetPassphrase(nil); err != nil {
+		err = errors.Wrap(err, "removing passphrase failed")
+		return
+	}
+	fmt.Println("Data has been decrypted")
+	return
+}
+
+// commandDecryptTo exports a decrypted copy of the data
+func commandDecryptTo(d *Data) (err error) {
+	if err = d.ExportDataFile(*decryptTo); err != nil {
+		err = errors.Wrapf(err, "exporting data to %s failed", *decryptTo)
+		return
+	}
+	fmt.Printf("Data has been exported to %s\n", *decryptTo)
+	return
+}
+
+// commandExportJSON exports the data as JSON
+func commandExportJSON(d *Data) (err error) {
+	if err = d.ExportJSON(*exportJSON); err != nil {
+		err = errors.Wrapf(err, "exporting data to %s failed", *exportJSON)
+		return
+	}
+	fmt.Printf("Data has been exported to %s\n", *exportJSON)
+	return
+}
+
+// commandImportJSON replaces the data with JSON data
+// The new data is written in a temp store which replaces the current data once the latter has been backed up. If the
+// current data is encrypted, the new data is encrypted with the same passphrase.
+func commandImportJSON(baseDirPath string, o DataOptions) (err error) {
+	// Open file
+	var f *os.File
+	if f, err = os.Open(*importJSON); err != nil {
+		err = errors.Wrapf(err, "opening %s failed", *importJSON)
+		return
+	}
+	defer f.Close()
+
+	// Read JSON data
+	var ds dataStored
+	if ds, err = readDataJSON(f); err != nil {
+		err = errors.Wrapf(err, "reading %s failed", *importJSON)
+		return
+	}
+
+	// Fetch passphrase of current data before it's moved
+	var p = storePath(baseDirPath, o.StoreType)
+	var passphrase []byte
+	if o.StoreType != storeTypeBolt {
+		if passphrase, err = dataFilePassphrase(p, o.Passphrase); err != nil {
+			err = errors.Wrapf(err, "fetching passphrase of %s failed", p)
+			return
+		}
+	}
+
+	// Write new data next to the current data so that the latter is left untouched if writing fails
+	var tp = p + ".import"
+	if err = writeImportedStore(tp, ds, passphrase, o); err != nil {
+		err = errors.Wrapf(err, "writing %s failed", tp)
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tp)
+		}
+	}()
+
+	// Back up current data
+	// The journal applies to the data that is replaced and is therefore copied next to its backup
+	if _, errStat := os.Stat(p); errStat == nil {
+		if err = os.MkdirAll(backupsDirPath(p), 0700); err != nil {
+			err = errors.Wrapf(err, "mkdirall %s failed", backupsDirPath(p))
+			return
+		}
+		var bp = newBackupPath(p, time.Now())
+		if err = copyFileAtomic(p, bp); err != nil {
+			err = errors.Wrapf(err, "backing up %s failed", p)
+			return
+		}
+		if _, errStat = os.Stat(journalPath(p)); errStat == nil {
+			if err = copyFileAtomic(journalPath(p), journalPath(bp)); err != nil {
+				err = errors.Wrapf(err, "backing up %s failed", journalPath(p))
+				return
+			}
+		}
+		fmt.Printf("Current data has been backed up to %s\n", bp)
+	}
+
+	// Replace current data
+	if err = os.Rename(tp, p); err != nil {
+		err = errors.Wrapf(err, "renaming %s into %s failed", tp, p)
+		return
+	}
+	syncDir(filepath.Dir(p))
+
+	// The journal applies to the data that has been replaced
+	if err = os.Remove(journalPath(p)); err != nil && !os.IsNotExist(err) {
+		err = errors.Wrapf(err, "removing %s failed", journalPath(p))
+		return
+	}
+	err = nil
+	fmt.Printf("%d account(s) have been imported from %s\n", len(ds.Accounts), *importJSON)
+	if len(passphrase) > 0 {
+		fmt.Println("Data has been encrypted with the passphrase of the replaced data")
+	}
+	return
+}
+
+// writeImportedStore writes imported data in a new store
+// The store is encrypted with the passphrase of the data it replaces, if any
+func writeImportedStore(path string, ds dataStored, passphrase []byte, o DataOptions) (err error) {
+	// Remove leftovers of a previous import
+	for _, p := range []string{path, journalPath(path)} {
+		if err = os.Remove(p); err != nil && !os.IsNotExist(err) {
+			err = errors.Wrapf(err, "removing %s failed", p)
+			return
+		}
+	}
+
+	// Create store
+	var s Store
+	if s, err = newStore(path, o, false); err != nil {
+		err = errors.Wrap(err, "creating store failed")
+		return
+	}
+
+	// Encrypt
+	if fs, ok := s.(*fileStore); ok && len(passphrase) > 0 {
+		if err = fs.setPassphrase(passphrase); err != nil {
+			s.Close()
+			err = errors.Wrap(err, "setting passphrase failed")
+			return
+		}
+	}
+
+	// Write
+	if err = writeStore(s, ds); err != nil {
+		s.Close()
+		err = errors.Wrap(err, "writing store failed")
+		return
+	}
+
+	// Close
+	// The store must be closed before being renamed
+	if err = s.Close(); err != nil {
+		err = errors.Wrap(err, "closing store failed")
+		return
+	}
+
+	// The journal has been emptied by the snapshot
+	if err = os.Remove(journalPath(path)); err != nil && !os.IsNotExist(err) {
+		err = errors.Wrapf(err, "removing %s failed", journalPath(path))
+		return
+	}
+	return
+}
+
+// commandRestore lists the backups and restores the one chosen by the user
+func commandRestore(baseDirPath string, o DataOptions) (err error) {
+	// List backups
+	var p = storePath(baseDirPath, o.StoreType)
+	var bs []backup
+	if bs, err = listBackups(p); err != nil {
+		err = errors.Wrap(err, "listing backups failed")
+		return
+	} else if len(bs) == 0 {
+		fmt.Println("No backups found")
+		return
+	}
+
+	// Loop through backups
+	for idx, b := range bs {
+		var info string
+		if countAccounts, countOperations, errCount := countBackup(b.path, o); errCount != nil {
+			info = errors.Cause(errCount).Error()
+		} else {
+			info = fmt.Sprintf("%d account(s), %d operation(s)", countAccounts, countOperations)
+		}
+		fmt.Printf("[%d] %s: %s\n", idx+1, b.time.Format("2006-01-02 15:04:05"), info)
+	}
+
+	// Ask backup
+	fmt.Print("Backup to restore: ")
+	var l string
+	if l, err = bufio.NewReader(os.Stdin).ReadString('\n'); err != nil {
+		err = errors.Wrap(err, "reading backup failed")
+		return
+	}
+	var idx int
+	if idx, err = strconv.Atoi(strings.TrimSpace(l)); err != nil || idx < 1 || idx > len(bs) {
+		err = fmt.Errorf("%s is not a valid backup", strings.TrimSpace(l))
+		return
+	}
+	var b = bs[idx-1]
+
+	// Back up current data so that restoring can be undone
+	// The journal applies to the data that is replaced and is therefore moved next to its backup
+	if _, errStat := os.Stat(p); errStat == nil {
+		var bp = newBackupPath(p, time.Now())
+		if err = copyFileAtomic(p, bp); err != nil {
+			err = errors.Wrapf(err, "backing up %s failed", p)
+			return
+		}
+		if err = os.Rename(journalPath(p), journalPath(bp)); err != nil && !os.IsNotExist(err) {
+			err = errors.Wrapf(err, "moving %s to %s failed", journalPath(p), journalPath(bp))
+			return
+		}
+	}
+
+	// Restore
+	if err = copyFileAtomic(b.path, p); err != nil {
+		err = errors.Wrapf(err, "copying %s to %s failed", b.path, p)
+		return
+	}
+
+	// Restore journal
+	if _, errStat := os.Stat(journalPath(b.path)); errStat == nil {
+		if err = copyFileAtomic(journalPath(b.path), journalPath(p)); err != nil {
+			err = errors.Wrapf(err, "copying %s to %s failed", journalPath(b.path), journalPath(p))
+			return
+		}
+	} else if err = os.Remove(journalPath(p)); err != nil && !os.IsNotExist(err) {
+		err = errors.Wrapf(err, "removing %s failed", journalPath(p))
+		return
+	}
+	err = nil
+	fmt.Printf("Backup of %s has been restored\n", b.time.Format("2006-01-02 15:04:05"))
+	return
+}
+
+// countBackup counts the accounts and operations of a backup
+func countBackup(path string, o DataOptions) (countAccounts, countOperations int, err error) {
+	// Create store
+	var s Store
+	if s, err = newStore(path, o, true); err != nil {
+		err = errors.Wrap(err, "creating store failed")
+		return
+	}
+	defer s.Close()
+
+	// Load
+	var ds dataStored
+	if ds, err = s.Load(); err != nil {
+		err = errors.Wrap(err, "loading failed")
+		return
+	}
+
+	// Count
+	countAccounts = len(ds.Accounts)
+	for _, as := range ds.Accounts {
+		countOperations += len(as.Operations)
+	}
+	return
+}
+
+// cachePassphrase makes sure a passphrase is only asked once
+func cachePassphrase(fn func() ([]byte, error)) func() ([]byte, error) {
+	var p []byte
+	return func() (_ []byte, err error) {
+		if p == nil {
+			if p, err = fn(); err != nil {
+				return
+			}
+		}
+		return p, nil
+	}
+}
+
+// askPassphrase asks the passphrase of the data file
+// It is read from the environment first so that it can be provided when there's no terminal
+func askPassphrase() (p []byte, err error) {
+	if v := os.Getenv(envPassphrase); v != "" {
+		p = []byte(v)
+		return
+	}
+	return readPassphrase("Passphrase: ")
+}
+
+// askNewPassphrase asks a new passphrase twice
+func askNewPassphrase() (p []byte, err error) {
+	// Read passphrase
+	if p, err = readPassphrase("New passphrase: "); err != nil {
+		return
+	} else if len(p) == 0 {
+		err = errMissingPassphrase
+		return
+	}
+
+	// Read confirmation
+	var c []byte
+	if c, err = readPassphrase("Confirm new passphrase: "); err != nil {
+		return
+	} else if !bytes.Equal(p, c) {
+		err = errors.New("passphrases don't match")
+		return
+	}
+	return
+}
+
+// readPassphrase reads a passphrase from the terminal
+func readPassphrase(prompt string) (p []byte, err error) {
+	// No terminal
+	var fd = int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		err = errors.Wrapf(errMissingPassphrase, "no terminal to read the passphrase from, set it in $%s", envPassphrase)
+		return
+	}
+
+	// Read
+	fmt.Fprint(os.Stderr, prompt)
+	p, err = term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		err = errors.Wrap(err, "reading password failed")
+		return
+	}
+	return
+}
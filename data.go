@@ -1,18 +1,45 @@
 package main
 
 import (
-	"encoding/gob"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/asticode/go-astilog"
 	"github.com/pkg/errors"
 )
 
+// Constants
+const (
+	dataFlushDelay = 3 * time.Second
+)
+
 // Data represents data
 type Data struct {
-	Accounts *accountPool
-	path     string
+	Accounts    *accountPool
+	backedUp    bool
+	backups     BackupOptions
+	chanChanged chan bool
+	chanDone    chan bool
+	chanStop    chan bool
+	history     *history
+	lock        *dirLock
+	metadata    map[string][]byte
+	mutex       *sync.Mutex
+	readOnly    bool
+	store       Store
+}
+
+// DataOptions represents data options
+type DataOptions struct {
+	Backups BackupOptions
+	// Passphrase is called when the data file is encrypted
+	Passphrase func() ([]byte, error)
+	// ReadOnly opens data without locking it and prevents any change
+	ReadOnly  bool
+	StoreType string
 }
 
 // dataPath returns the data path
@@ -21,71 +48,657 @@ func dataPath(baseDirPath string) string {
 }
 
 // NewData creates new data
-func NewData(baseDirPath string) (d *Data, err error) {
+func NewData(baseDirPath string, o DataOptions) (d *Data, err error) {
 	// Init
 	d = &Data{
-		Accounts: newAccountPool(),
-		path:     dataPath(baseDirPath),
+		Accounts:    newAccountPool(),
+		backups:     o.Backups,
+		chanChanged: make(chan bool, 1),
+		chanDone:    make(chan bool),
+		chanStop:    make(chan bool),
+		history:     newHistory(historySize),
+		metadata:    make(map[string][]byte),
+		mutex:       &sync.Mutex{},
+		readOnly:    o.ReadOnly,
 	}
 
-	// Open data file
-	var f *os.File
-	if f, err = os.Open(d.path); os.IsNotExist(err) {
-		astilog.Debugf("%s doesn't exist, working with new data", d.path)
-		err = nil
+	// Lock dir so that another instance can't overwrite our changes
+	if !o.ReadOnly {
+		if d.lock, err = lockDir(baseDirPath); err != nil {
+			err = errors.Wrapf(err, "locking %s failed", baseDirPath)
+			return
+		}
+	}
+
+	// Clean up on error
+	defer func() {
+		if err != nil {
+			if d.store != nil {
+				d.store.Close()
+			}
+			if d.lock != nil {
+				d.lock.unlock()
+			}
+		}
+	}()
+
+	// Pick store
+	// In read-only mode, a store that doesn't exist yet can't be initialized with the data file which is therefore
+	// loaded instead
+	var so, sp = o, storePath(baseDirPath, o.StoreType)
+	if _, errStat := os.Stat(sp); o.ReadOnly && sp != dataPath(baseDirPath) && os.IsNotExist(errStat) {
+		so.StoreType, sp = storeTypeFile, dataPath(baseDirPath)
+	}
+
+	// Create store
+	// It's only set once created since it couldn't be closed otherwise
+	var s Store
+	if s, err = newStore(sp, so, o.ReadOnly); err != nil {
+		err = errors.Wrapf(err, "creating %s store failed", so.StoreType)
+		return
+	}
+	d.store = s
+
+	// Load data
+	var ds dataStored
+	if ds, err = d.store.Load(); err != nil {
+		err = errors.Wrap(err, "loading data failed")
 		return
-	} else if err != nil {
-		err = errors.Wrapf(err, "stating %s failed", d.path)
+	}
+
+	// Store is empty but a data file exists: initialize the store with it so that switching stores doesn't lose data
+	// An encrypted data file is not used since the store would hold its data in clear
+	if _, ok := d.store.(snapshotStore); !ok && len(ds.Accounts) == 0 && !o.ReadOnly {
+		if _, errStat := os.Stat(dataPath(baseDirPath)); errStat == nil {
+			var encrypted bool
+			if encrypted, err = dataFileEncrypted(dataPath(baseDirPath)); err != nil {
+				err = errors.Wrapf(err, "checking whether %s is encrypted failed", dataPath(baseDirPath))
+				return
+			} else if encrypted {
+				err = errors.Wrapf(errEncryptionUnsupported, "%s is encrypted, decrypt it with the file store first", dataPath(baseDirPath))
+				return
+			}
+			if ds, err = d.initStoreFromFile(newFileStore(dataPath(baseDirPath), o.Passphrase, true)); err != nil {
+				err = errors.Wrapf(err, "initializing store from %s failed", dataPath(baseDirPath))
+				return
+			}
+		}
+	}
+	if err = d.set(ds); err != nil {
+		err = errors.Wrap(err, "setting data failed")
 		return
 	}
-	defer f.Close()
 
-	// Decode data
-	astilog.Debugf("Importing data from %s", d.path)
-	var ass []AccountStored
-	if err = gob.NewDecoder(f).Decode(&ass); err != nil {
-		err = errors.Wrapf(err, "decoding %s failed", d.path)
+	// Start flusher
+	go d.flusher()
+	return
+}
+
+// initStoreFromFile writes the content of a file store in the store
+func (d *Data) initStoreFromFile(s *fileStore) (ds dataStored, err error) {
+	// Load data file
+	astilog.Debugf("Initializing store with %s", s.path)
+	if ds, err = s.Load(); err != nil {
+		err = errors.Wrapf(err, "loading %s failed", s.path)
 		return
 	}
 
+	// Write
+	if err = d.store.Write(newStoreChanges(ds)); err != nil {
+		err = errors.Wrap(err, "writing changes failed")
+		return
+	}
+	return
+}
+
+// set sets stored data
+// Operations must be in the currency of their account since their amounts are added to its balance
+func (d *Data) set(ds dataStored) (err error) {
 	// Loop through accounts
-	for _, as := range ass {
+	for _, as := range ds.Accounts {
 		// Set account
+		as.setDefaults()
 		var a = d.Accounts.Set(as.init())
 
 		// Loop through operations
 		for _, o := range as.Operations {
-			a.Operations.Add(o)
+			if err = checkOperationCurrency(a, o); err != nil {
+				err = errors.Wrapf(err, "checking operation %d failed", o.ID)
+				return
+			}
+			a.Operations.set(o)
 		}
+
+		// Operations stored before fingerprints existed get one
+		var ops []*Operation
+		if ops, _, err = a.Operations.ByDate(); err != nil {
+			err = errors.Wrapf(err, "sorting operations of account %s failed", a.ID)
+			return
+		}
+		setFingerprints(ops)
+	}
+
+	// Loop through metadata
+	for k, v := range ds.Metadata {
+		d.metadata[k] = v
+	}
+	return
+}
+
+// stored returns the data as stored
+func (d *Data) stored() (ds dataStored) {
+	ds.Metadata = make(map[string][]byte)
+	for k, v := range d.metadata {
+		ds.Metadata[k] = v
+	}
+	for _, a := range d.Accounts.All() {
+		var as = AccountStored{Account: a}
+		for _, o := range a.Operations.All() {
+			as.Operations = append(as.Operations, o)
+		}
+		ds.Accounts = append(ds.Accounts, as)
 	}
 	return
 }
 
+// Changed signals that data has changed and schedules a save
+func (d *Data) Changed() {
+	select {
+	case d.chanChanged <- true:
+	default:
+	}
+}
+
+// flusher saves data in the background once it has changed
+// The delay starts with the first change so that the data on disk is never more than dataFlushDelay behind
+func (d *Data) flusher() {
+	defer close(d.chanDone)
+	var scheduled bool
+	var t = time.NewTimer(dataFlushDelay)
+	t.Stop()
+	for {
+		select {
+		case <-d.chanChanged:
+			if !scheduled {
+				scheduled = true
+				t.Reset(dataFlushDelay)
+			}
+		case <-t.C:
+			scheduled = false
+			if err := d.Save(); err != nil {
+				astilog.Error(errors.Wrap(err, "saving data failed"))
+			}
+		case <-d.chanStop:
+			t.Stop()
+			return
+		}
+	}
+}
+
 // Close closes the data properly
 func (d *Data) Close() (err error) {
+	// Stop flusher
+	close(d.chanStop)
+	<-d.chanDone
+
+	// Save
+	if err = d.Save(); err != nil {
+		err = errors.Wrap(err, "saving data failed")
+		return
+	}
+
+	// Close store
+	if err = d.store.Close(); err != nil {
+		err = errors.Wrap(err, "closing store failed")
+		return
+	}
+
+	// Unlock
+	if d.lock != nil {
+		if err = d.lock.unlock(); err != nil {
+			err = errors.Wrap(err, "unlocking failed")
+			return
+		}
+	}
+	return
+}
+
+// Save saves a snapshot of the data if the store needs one
+func (d *Data) Save() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.save()
+}
+
+// save saves a snapshot of the data if the store needs one
+// Data must be locked
+func (d *Data) save() (err error) {
+	// Store doesn't need snapshots
+	s, ok := d.store.(snapshotStore)
+	if !ok || d.readOnly {
+		return
+	}
+
+	// Back up
+	d.backup()
+
+	// Snapshot
+	if err = s.Snapshot(d.stored()); err != nil {
+		err = errors.Wrap(err, "snapshotting failed")
+		return
+	}
+	return
+}
+
+// SetPassphrase sets the passphrase used to encrypt the data and saves it
+// An empty passphrase disables encryption
+func (d *Data) SetPassphrase(p []byte) (err error) {
+	// Lock
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// Read-only
+	if d.readOnly {
+		err = errReadOnly
+		return
+	}
+
+	// Only the file store supports encryption
+	s, ok := d.store.(*fileStore)
+	if !ok {
+		err = errEncryptionUnsupported
+		return
+	}
+
+	// Set passphrase
+	if err = s.setPassphrase(p); err != nil {
+		err = errors.Wrap(err, "setting passphrase failed")
+		return
+	}
+
+	// Save
+	if err = d.save(); err != nil {
+		err = errors.Wrap(err, "saving failed")
+		return
+	}
+	return
+}
+
+// ExportDataFile exports the data in clear to a data file
+func (d *Data) ExportDataFile(path string) (err error) {
+	// Lock
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
 	// Create file
 	var f *os.File
-	if f, err = os.Create(d.path); err != nil {
-		err = errors.Wrapf(err, "creating %s failed", d.path)
+	if f, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600); err != nil {
+		err = errors.Wrapf(err, "creating %s failed", path)
 		return
 	}
 	defer f.Close()
 
-	// Build data
-	var ass []AccountStored
-	for _, a := range d.Accounts.All() {
-		var as = AccountStored{Account: a}
-		for _, o := range a.Operations.All() {
-			as.Operations = append(as.Operations, o)
+	// Write data file
+	if err = writeDataFile(f, d.stored()); err != nil {
+		err = errors.Wrapf(err, "writing data file %s failed", path)
+		return
+	}
+	return
+}
+
+// backup backs up the store before it's modified for the first time
+// Failing to back up must not prevent saving data, therefore errors are only logged
+// Data must be locked
+func (d *Data) backup() {
+	// Already backed up or disabled
+	if d.backedUp || !d.backups.enabled() {
+		return
+	}
+	d.backedUp = true
+
+	// Store can't be backed up
+	s, ok := d.store.(backupStore)
+	if !ok {
+		return
+	}
+
+	// Back up
+	if err := createBackup(s, d.backups); err != nil {
+		astilog.Error(errors.Wrap(err, "backing up failed"))
+	}
+}
+
+// ExportJSON exports the data as JSON
+func (d *Data) ExportJSON(path string) (err error) {
+	// Lock
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// Create file
+	var f *os.File
+	if f, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600); err != nil {
+		err = errors.Wrapf(err, "creating %s failed", path)
+		return
+	}
+	defer f.Close()
+
+	// Write JSON data
+	if err = writeDataJSON(f, d.stored()); err != nil {
+		err = errors.Wrapf(err, "writing JSON data to %s failed", path)
+		return
+	}
+	return
+}
+
+// write writes changes in the store
+// Data must be locked
+func (d *Data) write(cs ...StoreChange) (err error) {
+	d.backup()
+	if err = d.store.Write(cs); err != nil {
+		err = errors.Wrap(err, "writing changes in store failed")
+		return
+	}
+	d.Changed()
+	return
+}
+
+// checkOperationCurrency checks that the amount of an operation is in the currency of its account
+func checkOperationCurrency(a *Account, o *Operation) error {
+	o.setDefaults()
+	if o.Amount.Currency != a.Currency {
+		return fmt.Errorf("amount currency %s of operation differs from currency %s of account %s", o.Amount.Currency, a.Currency, a.ID)
+	}
+	return nil
+}
+
+// AddOperation adds an operation to an account and updates its balance
+// Operations added with the same non-empty batch, such as during an import, are undone together. The account is only
+// modified once changes have been written.
+func (d *Data) AddOperation(a *Account, o *Operation, batch string) (err error) {
+	// Lock
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// Read-only
+	if d.readOnly {
+		err = errReadOnly
+		return
+	}
+
+	// Check currency
+	if err = checkOperationCurrency(a, o); err != nil {
+		return
+	}
+
+	// Operations that are not imported get a fingerprint as well
+	if o.Fingerprint == "" {
+		var k, n = fingerprintKey(o), 0
+		for _, c := range a.Operations.All() {
+			if fingerprintKey(c) == k {
+				n++
+			}
+		}
+		o.Fingerprint = newFingerprint(k, n)
+	}
+
+	// Build new state
+	// Ids are given the way the operation pool would
+	o.ID = a.Operations.Counter + 1
+	var u = *a
+	if u.Balance, err = a.Balance.Add(o.Amount); err != nil {
+		err = errors.Wrap(err, "adding amount to balance failed")
+		return
+	}
+
+	// Write
+	if err = d.write(
+		newStoreChangeOperation(storeChangeKindOperationAdded, a.ID, o),
+		newStoreChangeAccount(storeChangeKindAccountUpdated, &u),
+	); err != nil {
+		return
+	}
+
+	// Apply
+	a.Operations.set(o)
+	a.Balance = u.Balance
+
+	// Update history
+	var name = "operation addition"
+	if batch != "" {
+		name = "import"
+	}
+	d.history.push(historyEntry{Batch: batch, Changes: []operationChange{newOperationChange(a.ID, nil, o)}, Name: name})
+	return
+}
+
+// UpdateOperation updates an operation of an account and its balance
+// The account and the operation are only modified once changes have been written
+func (d *Data) UpdateOperation(a *Account, o, n *Operation) (err error) {
+	// Lock
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// Read-only
+	if d.readOnly {
+		err = errReadOnly
+		return
+	}
+
+	// Check currency
+	if err = checkOperationCurrency(a, n); err != nil {
+		return
+	}
+
+	// Fingerprint identifies the operation as imported and is therefore kept
+	if n.Fingerprint == "" {
+		n.Fingerprint = o.Fingerprint
+	}
+
+	// Build new state
+	var c = newOperationChange(a.ID, o, n)
+	var u = *a
+	if u.Balance, err = a.Balance.Sub(o.Amount); err != nil {
+		err = errors.Wrap(err, "subtracting amount from balance failed")
+		return
+	}
+	if u.Balance, err = u.Balance.Add(n.Amount); err != nil {
+		err = errors.Wrap(err, "adding amount to balance failed")
+		return
+	}
+
+	// Write
+	if err = d.write(
+		newStoreChangeOperation(storeChangeKindOperationUpdated, a.ID, n),
+		newStoreChangeAccount(storeChangeKindAccountUpdated, &u),
+	); err != nil {
+		return
+	}
+
+	// Apply
+	*o = *n
+	a.Operations.set(o)
+	a.Balance = u.Balance
+
+	// Update history
+	d.history.push(historyEntry{Changes: []operationChange{c}, Name: "operation update"})
+	return
+}
+
+// DeleteOperation deletes an operation of an account and updates its balance
+// The account is only modified once changes have been written
+func (d *Data) DeleteOperation(a *Account, o *Operation) (err error) {
+	// Lock
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// Read-only
+	if d.readOnly {
+		err = errReadOnly
+		return
+	}
+
+	// Build new state
+	var u = *a
+	if u.Balance, err = a.Balance.Sub(o.Amount); err != nil {
+		err = errors.Wrap(err, "subtracting amount from balance failed")
+		return
+	}
+
+	// Write
+	if err = d.write(
+		newStoreChangeOperation(storeChangeKindOperationDeleted, a.ID, o),
+		newStoreChangeAccount(storeChangeKindAccountUpdated, &u),
+	); err != nil {
+		return
+	}
+
+	// Apply
+	a.Operations.Delete(o.ID)
+	a.Balance = u.Balance
+
+	// Update history
+	d.history.push(historyEntry{Changes: []operationChange{newOperationChange(a.ID, o, nil)}, Name: "operation deletion"})
+	return
+}
+
+// Undo undoes the last change made to operations
+// Only operations are reverted: accounts created by an import that is undone are left without its operations
+func (d *Data) Undo() (e historyEntry, err error) {
+	// Lock
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// Read-only
+	if d.readOnly {
+		err = errReadOnly
+		return
+	}
+
+	// Get entry
+	if e, err = d.history.nextUndo(); err != nil {
+		return
+	}
+
+	// Apply
+	if err = d.applyOperationChanges(e.reversed()); err != nil {
+		err = errors.Wrapf(err, "undoing %s failed", e.Name)
+		return
+	}
+	d.history.undone()
+	return
+}
+
+// Redo redoes the last change that has been undone
+func (d *Data) Redo() (e historyEntry, err error) {
+	// Lock
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// Read-only
+	if d.readOnly {
+		err = errReadOnly
+		return
+	}
+
+	// Get entry
+	if e, err = d.history.nextRedo(); err != nil {
+		return
+	}
+
+	// Apply
+	if err = d.applyOperationChanges(e.Changes); err != nil {
+		err = errors.Wrapf(err, "redoing %s failed", e.Name)
+		return
+	}
+	d.history.redone()
+	return
+}
+
+// applyOperationChanges applies operation changes and updates the balances of their accounts
+// Accounts and operations are only modified once changes have been written
+// Data must be locked
+func (d *Data) applyOperationChanges(cs []operationChange) (err error) {
+	// Check changes first so that they're either all applied or none of them
+	var as = make(map[string]*Account)
+	for _, c := range cs {
+		// Fetch account
+		var a *Account
+		if a, err = d.Accounts.One(c.AccountID); err != nil {
+			err = errors.Wrapf(err, "fetching account %s failed", c.AccountID)
+			return
+		}
+		as[a.ID] = a
+
+		// Fetch operation
+		if c.Before != nil && c.After != nil {
+			if _, err = a.Operations.One(c.Before.ID); err != nil {
+				err = errors.Wrapf(err, "fetching operation %d failed", c.Before.ID)
+				return
+			}
 		}
-		ass = append(ass, as)
 	}
 
-	// Encode data
-	astilog.Debugf("Exporting data to %s", d.path)
-	if err = gob.NewEncoder(f).Encode(ass); err != nil {
-		err = errors.Wrapf(err, "encoding %s failed", d.path)
+	// Loop through changes
+	var bs = make(map[string]Money)
+	var scs []StoreChange
+	for _, c := range cs {
+		var a = as[c.AccountID]
+		if _, ok := bs[a.ID]; !ok {
+			bs[a.ID] = a.Balance
+		}
+		var b = bs[a.ID]
+		if c.Before != nil {
+			if b, err = b.Sub(c.Before.Amount); err != nil {
+				err = errors.Wrapf(err, "subtracting amount of operation %d from balance of account %s failed", c.Before.ID, a.ID)
+				return
+			}
+		}
+		if c.After != nil {
+			if b, err = b.Add(c.After.Amount); err != nil {
+				err = errors.Wrapf(err, "adding amount of operation %d to balance of account %s failed", c.After.ID, a.ID)
+				return
+			}
+		}
+		bs[a.ID] = b
+		switch {
+		case c.After == nil:
+			scs = append(scs, newStoreChangeOperation(storeChangeKindOperationDeleted, a.ID, c.Before))
+		case c.Before == nil:
+			scs = append(scs, newStoreChangeOperation(storeChangeKindOperationAdded, a.ID, c.After))
+		default:
+			scs = append(scs, newStoreChangeOperation(storeChangeKindOperationUpdated, a.ID, c.After))
+		}
+	}
+
+	// Loop through accounts
+	for _, a := range as {
+		var u = *a
+		u.Balance = bs[a.ID]
+		scs = append(scs, newStoreChangeAccount(storeChangeKindAccountUpdated, &u))
+	}
+
+	// Write
+	if err = d.write(scs...); err != nil {
 		return
 	}
+
+	// Apply
+	for _, c := range cs {
+		var a = as[c.AccountID]
+		switch {
+		case c.After == nil:
+			a.Operations.Delete(c.Before.ID)
+		case c.Before == nil:
+			var o = *c.After
+			a.Operations.set(&o)
+		default:
+			var o, _ = a.Operations.One(c.Before.ID)
+			*o = *c.After
+			a.Operations.set(o)
+		}
+	}
+	for id, b := range bs {
+		as[id].Balance = b
+	}
 	return
 }
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Data file format
+// A data file starts with dataMagic followed by the version as a big endian uint32 and by the gob encoded payload
+// Files written before the format was versioned contain only the payload and are considered as version 0
+const (
+	dataVersion = 2
+)
+
+// Vars
+var (
+	dataMagic = []byte("ASTIBANK")
+)
+
+// dataStored represents stored data
+type dataStored struct {
+	Accounts []AccountStored
+	Metadata map[string][]byte
+}
+
+// readDataFile reads a data file and returns its payload migrated to the current version
+func readDataFile(b []byte) (ds dataStored, version int, err error) {
+	// Parse header
+	var payload []byte
+	if version, payload, err = parseDataHeader(b); err != nil {
+		err = errors.Wrap(err, "parsing header failed")
+		return
+	}
+
+	// Migrate
+	if payload, err = migrateData(version, payload); err != nil {
+		err = errors.Wrap(err, "migrating data failed")
+		return
+	}
+
+	// Decode
+	if err = gob.NewDecoder(bytes.NewReader(payload)).Decode(&ds); err != nil {
+		err = errors.Wrap(err, "decoding payload failed")
+		return
+	}
+	return
+}
+
+// parseDataHeader parses the header of a data file
+func parseDataHeader(b []byte) (version int, payload []byte, err error) {
+	// No header
+	if !bytes.HasPrefix(b, dataMagic) {
+		payload = b
+		return
+	}
+
+	// Parse version
+	b = b[len(dataMagic):]
+	if len(b) < 4 {
+		err = errors.New("header is truncated")
+		return
+	}
+	version = int(binary.BigEndian.Uint32(b[:4]))
+	payload = b[4:]
+
+	// Check version
+	if version > dataVersion {
+		err = fmt.Errorf("data version %d is more recent than supported version %d", version, dataVersion)
+		return
+	}
+	return
+}
+
+// writeDataFile writes a data file in the current version
+func writeDataFile(w io.Writer, ds dataStored) (err error) {
+	// Write magic
+	if _, err = w.Write(dataMagic); err != nil {
+		err = errors.Wrap(err, "writing magic failed")
+		return
+	}
+
+	// Write version
+	if err = binary.Write(w, binary.BigEndian, uint32(dataVersion)); err != nil {
+		err = errors.Wrap(err, "writing version failed")
+		return
+	}
+
+	// Encode payload
+	if err = gob.NewEncoder(w).Encode(ds); err != nil {
+		err = errors.Wrap(err, "encoding payload failed")
+		return
+	}
+	return
+}
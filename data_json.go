@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Constants
+// Amounts were plain numbers in version 1 and are read in the default currency
+const (
+	dataJSONVersion    = 2
+	dataJSONVersionMin = 1
+)
+
+// DataJSON represents data as human-readable JSON
+type DataJSON struct {
+	Accounts   []AccountJSON              `json:"accounts"`
+	ExportedAt time.Time                  `json:"exported_at"`
+	Metadata   map[string]json.RawMessage `json:"metadata,omitempty"`
+	Version    int                        `json:"version"`
+}
+
+// AccountJSON represents an account with its operations as JSON
+type AccountJSON struct {
+	*Account
+	Operations []*Operation `json:"operations"`
+}
+
+// newDataJSON creates new JSON data out of stored data
+func newDataJSON(ds dataStored) (dj DataJSON, err error) {
+	// Init
+	dj = DataJSON{
+		Accounts:   []AccountJSON{},
+		ExportedAt: time.Now(),
+		Version:    dataJSONVersion,
+	}
+
+	// Loop through accounts
+	for _, as := range ds.Accounts {
+		var aj = AccountJSON{Account: as.Account, Operations: as.Operations}
+		if aj.Operations == nil {
+			aj.Operations = []*Operation{}
+		}
+		dj.Accounts = append(dj.Accounts, aj)
+	}
+
+	// Loop through metadata
+	for k, v := range ds.Metadata {
+		if !json.Valid(v) {
+			err = fmt.Errorf("metadata %s is not valid JSON", k)
+			return
+		}
+		if dj.Metadata == nil {
+			dj.Metadata = make(map[string]json.RawMessage)
+		}
+		dj.Metadata[k] = json.RawMessage(v)
+	}
+	return
+}
+
+// writeDataJSON writes data as indented JSON
+func writeDataJSON(w io.Writer, ds dataStored) (err error) {
+	// Build JSON data
+	var dj DataJSON
+	if dj, err = newDataJSON(ds); err != nil {
+		err = errors.Wrap(err, "building JSON data failed")
+		return
+	}
+
+	// Encode
+	var e = json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	if err = e.Encode(dj); err != nil {
+		err = errors.Wrap(err, "encoding JSON failed")
+		return
+	}
+	return
+}
+
+// readDataJSON reads and validates JSON data
+func readDataJSON(r io.Reader) (ds dataStored, err error) {
+	// Decode
+	var dj DataJSON
+	if err = json.NewDecoder(r).Decode(&dj); err != nil {
+		err = errors.Wrap(err, "decoding JSON failed")
+		return
+	}
+
+	// Set defaults of fields that older exports don't have
+	for _, aj := range dj.Accounts {
+		if aj.Account != nil {
+			aj.setDefaults()
+		}
+		for _, o := range aj.Operations {
+			if o != nil {
+				o.setDefaults()
+			}
+		}
+	}
+
+	// Validate
+	if err = dj.validate(); err != nil {
+		err = errors.Wrap(err, "validating JSON failed")
+		return
+	}
+
+	// Loop through accounts
+	for _, aj := range dj.Accounts {
+		ds.Accounts = append(ds.Accounts, AccountStored{Account: aj.Account, Operations: aj.Operations})
+	}
+
+	// Loop through metadata
+	// Metadata has been indented during the export
+	ds.Metadata = make(map[string][]byte)
+	for k, v := range dj.Metadata {
+		var buf = &bytes.Buffer{}
+		if err = json.Compact(buf, v); err != nil {
+			err = errors.Wrapf(err, "compacting metadata %s failed", k)
+			return
+		}
+		ds.Metadata[k] = buf.Bytes()
+	}
+	return
+}
+
+// validate validates JSON data
+func (dj DataJSON) validate() (err error) {
+	// Check version
+	if dj.Version < dataJSONVersionMin || dj.Version > dataJSONVersion {
+		err = fmt.Errorf("version %d is not supported, expected %d to %d", dj.Version, dataJSONVersionMin, dataJSONVersion)
+		return
+	}
+
+	// Loop through accounts
+	var accountIDs = make(map[string]bool)
+	for idx, aj := range dj.Accounts {
+		// Check account
+		if aj.Account == nil || aj.ID == "" {
+			err = fmt.Errorf("account #%d has no id", idx+1)
+			return
+		} else if _, ok := accountIDs[aj.ID]; ok {
+			err = fmt.Errorf("account id %s is duplicated", aj.ID)
+			return
+		} else if !validCurrency(aj.Currency) {
+			err = fmt.Errorf("currency %s of account %s is not valid", aj.Currency, aj.ID)
+			return
+		} else if aj.Balance.Currency != aj.Currency {
+			err = fmt.Errorf("balance currency %s of account %s differs from the account currency", aj.Balance.Currency, aj.ID)
+			return
+		} else if aj.UpdatedAt.IsZero() {
+			err = fmt.Errorf("account %s has no update date", aj.ID)
+			return
+		}
+		accountIDs[aj.ID] = true
+
+		// Loop through operations
+		var operationIDs = make(map[int]bool)
+		for _, o := range aj.Operations {
+			if o == nil || o.ID <= 0 {
+				err = fmt.Errorf("account %s has an operation with an invalid id", aj.ID)
+				return
+			} else if _, ok := operationIDs[o.ID]; ok {
+				err = fmt.Errorf("operation id %d of account %s is duplicated", o.ID, aj.ID)
+				return
+			} else if o.Date.IsZero() {
+				err = fmt.Errorf("operation %d of account %s has no date", o.ID, aj.ID)
+				return
+			} else if o.Amount.Currency != aj.Currency {
+				err = fmt.Errorf("currency %s of operation %d of account %s differs from the account currency", o.Amount.Currency, o.ID, aj.ID)
+				return
+			} else if !validCurrency(o.OriginalAmount.Currency) {
+				err = fmt.Errorf("original currency %s of operation %d of account %s is not valid", o.OriginalAmount.Currency, o.ID, aj.ID)
+				return
+			}
+			operationIDs[o.ID] = true
+		}
+	}
+	return
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// dataMigration upgrades a payload from one version to the next one
+// Migrations must not rely on the current types since they'll evolve: each of them declares the types it needs
+type dataMigration func(in []byte) (out []byte, err error)
+
+// dataMigrations are indexed by the version they upgrade from
+var dataMigrations = map[int]dataMigration{
+	0: migrateDataV0ToV1,
+	1: migrateDataV1ToV2,
+}
+
+// journalMigrations upgrade journal records and are indexed by the version they upgrade from
+var journalMigrations = map[int]dataMigration{
+	1: migrateJournalRecordV1ToV2,
+}
+
+// migrateData migrates a payload step by step up to the current version
+func migrateData(version int, payload []byte) ([]byte, error) {
+	return migratePayload(dataMigrations, version, payload)
+}
+
+// migratePayload migrates a payload step by step up to the current version with a set of migrations
+func migratePayload(ms map[int]dataMigration, version int, payload []byte) (out []byte, err error) {
+	out = payload
+	for v := version; v < dataVersion; v++ {
+		// Fetch migration
+		m, ok := ms[v]
+		if !ok {
+			err = fmt.Errorf("no migration from version %d", v)
+			return
+		}
+
+		// Migrate
+		astilog.Debugf("Migrating data from version %d to %d", v, v+1)
+		if out, err = m(out); err != nil {
+			err = errors.Wrapf(err, "migrating from version %d to %d failed", v, v+1)
+			return
+		}
+	}
+	return
+}
+
+// dataV0 represents data in version 0
+type dataV0 []accountStoredV0
+
+// accountStoredV0 represents a stored account in version 0
+type accountStoredV0 struct {
+	Account    *accountV0
+	Operations []*operationV0
+}
+
+// accountV0 represents an account in version 0
+type accountV0 struct {
+	Balance   float64
+	ID        string
+	UpdatedAt time.Time
+}
+
+// operationV0 represents an operation in version 0
+type operationV0 struct {
+	Amount   float64
+	Category string
+	Date     time.Time
+	ID       int
+	Label    string
+	RawLabel string
+	Subject  string
+}
+
+// dataV1 represents data in version 1
+// Accounts and operations didn't change from version 0
+type dataV1 struct {
+	Accounts []accountStoredV0
+	Metadata map[string][]byte
+}
+
+// migrateDataV0ToV1 wraps the accounts in a struct so that fields can be added next to them
+func migrateDataV0ToV1(in []byte) (out []byte, err error) {
+	// Decode
+	var d dataV0
+	if err = gob.NewDecoder(bytes.NewReader(in)).Decode(&d); err != nil {
+		err = errors.Wrap(err, "decoding failed")
+		return
+	}
+
+	// Encode
+	var buf = &bytes.Buffer{}
+	if err = gob.NewEncoder(buf).Encode(dataV1{Accounts: d}); err != nil {
+		err = errors.Wrap(err, "encoding failed")
+		return
+	}
+	out = buf.Bytes()
+	return
+}
+
+// dataV2 represents data in version 2
+type dataV2 struct {
+	Accounts []accountStoredV2
+	Metadata map[string][]byte
+}
+
+// accountStoredV2 represents a stored account in version 2
+type accountStoredV2 struct {
+	Account    *accountV2
+	Operations []*operationV2
+}
+
+// accountV2 represents an account in version 2
+type accountV2 struct {
+	Balance   moneyV2
+	ID        string
+	UpdatedAt time.Time
+}
+
+// operationV2 represents an operation in version 2
+type operationV2 struct {
+	Amount   moneyV2
+	Category string
+	Date     time.Time
+	ID       int
+	Label    string
+	RawLabel string
+	Subject  string
+}
+
+// moneyV2 represents money in version 2
+type moneyV2 struct {
+	Currency string
+	Units    int64
+}
+
+// newMoneyV2 converts a float amount of version 1, which was always in euros, to money of version 2
+// Units are ten-thousandths of euros and the amount is rounded to the closest unit
+func newMoneyV2(f float64) (m moneyV2, err error) {
+	var u = math.Round(f * 10000)
+	if math.IsNaN(u) || u >= math.MaxInt64 || u < math.MinInt64 {
+		err = fmt.Errorf("%v is not a valid amount", f)
+		return
+	}
+	m = moneyV2{Currency: "EUR", Units: int64(u)}
+	return
+}
+
+// migrateAccountV1ToV2 converts an account of version 1 to version 2
+func migrateAccountV1ToV2(a *accountV0) (o *accountV2, err error) {
+	if a == nil {
+		return
+	}
+	o = &accountV2{ID: a.ID, UpdatedAt: a.UpdatedAt}
+	if o.Balance, err = newMoneyV2(a.Balance); err != nil {
+		err = errors.Wrapf(err, "converting balance of account %s failed", a.ID)
+		return
+	}
+	return
+}
+
+// migrateOperationV1ToV2 converts an operation of version 1 to version 2
+func migrateOperationV1ToV2(op *operationV0) (o *operationV2, err error) {
+	if op == nil {
+		return
+	}
+	o = &operationV2{
+		Category: op.Category,
+		Date:     op.Date,
+		ID:       op.ID,
+		Label:    op.Label,
+		RawLabel: op.RawLabel,
+		Subject:  op.Subject,
+	}
+	if o.Amount, err = newMoneyV2(op.Amount); err != nil {
+		err = errors.Wrapf(err, "converting amount of operation %d failed", op.ID)
+		return
+	}
+	return
+}
+
+// migrateDataV1ToV2 replaces float amounts with fixed-point money
+// Amounts are rounded to the closest unit which removes the rounding errors accumulated so far
+func migrateDataV1ToV2(in []byte) (out []byte, err error) {
+	// Decode
+	var d dataV1
+	if err = gob.NewDecoder(bytes.NewReader(in)).Decode(&d); err != nil {
+		err = errors.Wrap(err, "decoding failed")
+		return
+	}
+
+	// Loop through accounts
+	var o = dataV2{Metadata: d.Metadata}
+	for _, as := range d.Accounts {
+		// Convert account
+		var aso accountStoredV2
+		if aso.Account, err = migrateAccountV1ToV2(as.Account); err != nil {
+			return
+		}
+
+		// Loop through operations
+		for _, op := range as.Operations {
+			var opo *operationV2
+			if opo, err = migrateOperationV1ToV2(op); err != nil {
+				return
+			}
+			aso.Operations = append(aso.Operations, opo)
+		}
+		o.Accounts = append(o.Accounts, aso)
+	}
+
+	// Encode
+	var buf = &bytes.Buffer{}
+	if err = gob.NewEncoder(buf).Encode(o); err != nil {
+		err = errors.Wrap(err, "encoding failed")
+		return
+	}
+	out = buf.Bytes()
+	return
+}
+
+// journalRecordV1 represents a journal record in version 1
+type journalRecordV1 struct {
+	Changes []storeChangeV1
+	Time    time.Time
+}
+
+// storeChangeV1 represents a store change in version 1
+type storeChangeV1 struct {
+	Account   *accountV0
+	AccountID string
+	Key       string
+	Kind      string
+	Operation *operationV0
+	Value     []byte
+}
+
+// journalRecordV2 represents a journal record in version 2
+type journalRecordV2 struct {
+	Changes []storeChangeV2
+	Time    time.Time
+	Version int
+}
+
+// storeChangeV2 represents a store change in version 2
+type storeChangeV2 struct {
+	Account   *accountV2
+	AccountID string
+	Key       string
+	Kind      string
+	Operation *operationV2
+	Value     []byte
+}
+
+// migrateJournalRecordV1ToV2 replaces float amounts with fixed-point money in a journal record
+func migrateJournalRecordV1ToV2(in []byte) (out []byte, err error) {
+	// Decode
+	var r journalRecordV1
+	if err = gob.NewDecoder(bytes.NewReader(in)).Decode(&r); err != nil {
+		err = errors.Wrap(err, "decoding failed")
+		return
+	}
+
+	// Loop through changes
+	var o = journalRecordV2{Time: r.Time, Version: 2}
+	for _, c := range r.Changes {
+		var co = storeChangeV2{AccountID: c.AccountID, Key: c.Key, Kind: c.Kind, Value: c.Value}
+		if co.Account, err = migrateAccountV1ToV2(c.Account); err != nil {
+			return
+		}
+		if co.Operation, err = migrateOperationV1ToV2(c.Operation); err != nil {
+			return
+		}
+		o.Changes = append(o.Changes, co)
+	}
+
+	// Encode
+	var buf = &bytes.Buffer{}
+	if err = gob.NewEncoder(buf).Encode(o); err != nil {
+		err = errors.Wrap(err, "encoding failed")
+		return
+	}
+	out = buf.Bytes()
+	return
+}
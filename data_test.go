@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// openTestData opens data stored in a dir
+func openTestData(t *testing.T, dir string) *Data {
+	d, err := NewData(dir, DataOptions{StoreType: storeTypeFile})
+	if err != nil {
+		t.Fatalf("opening data failed: %v", err)
+	}
+	return d
+}
+
+// newTestData creates data in a temp dir which is closed once the test is done
+func newTestData(t *testing.T) *Data {
+	var d = openTestData(t, t.TempDir())
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+func TestNewDataEncryptedFileToBolt(t *testing.T) {
+	// Encrypt data file
+	var dir = t.TempDir()
+	d, err := NewData(dir, DataOptions{StoreType: storeTypeFile})
+	if err != nil {
+		t.Fatalf("creating data failed: %v", err)
+	}
+	if err = d.SetPassphrase([]byte("passphrase")); err != nil {
+		t.Fatalf("setting passphrase failed: %v", err)
+	}
+	if err = d.Close(); err != nil {
+		t.Fatalf("closing data failed: %v", err)
+	}
+
+	// Bolt store can't be initialized with it
+	var passphrase = func() ([]byte, error) { return []byte("passphrase"), nil }
+	if _, err = NewData(dir, DataOptions{Passphrase: passphrase, StoreType: storeTypeBolt}); errors.Cause(err) != errEncryptionUnsupported {
+		t.Fatalf("expected %v, got %v", errEncryptionUnsupported, err)
+	}
+}
+
+func TestNewDataReadOnlyBoltWithoutDB(t *testing.T) {
+	// Write data file
+	var dir = t.TempDir()
+	var a = newAccount()
+	a.ID = "a"
+	a.setDefaults()
+	var s = newFileStore(dataPath(dir), nil, false)
+	if err := writeStore(s, dataStored{Accounts: []AccountStored{{Account: a}}}); err != nil {
+		t.Fatalf("writing store failed: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("closing store failed: %v", err)
+	}
+
+	// Read-only bolt store is not created and data file is loaded instead
+	d, err := NewData(dir, DataOptions{ReadOnly: true, StoreType: storeTypeBolt})
+	if err != nil {
+		t.Fatalf("opening data failed: %v", err)
+	}
+	defer d.Close()
+	if _, err = d.Accounts.One("a"); err != nil {
+		t.Fatalf("expected account a to be loaded, got %v", err)
+	}
+	if _, err = os.Stat(storePath(dir, storeTypeBolt)); !os.IsNotExist(err) {
+		t.Fatalf("expected %s not to exist, got %v", storePath(dir, storeTypeBolt), err)
+	}
+}
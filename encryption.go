@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encryption
+// Encrypted content starts with encryptionMagic followed by the scrypt salt, the AES-GCM nonce and the sealed content
+const (
+	encryptionKeySize  = 32
+	encryptionSaltSize = 16
+	scryptN            = 1 << 15
+	scryptP            = 1
+	scryptR            = 8
+)
+
+// Vars
+var (
+	encryptionMagic          = []byte("ASTIBENC")
+	errInvalidPassphrase     = errors.New("invalid passphrase")
+	errMissingPassphrase     = errors.New("passphrase is required")
+	errTruncatedEncryption   = errors.New("encrypted content is truncated")
+	errEncryptionUnsupported = errors.New("encryption is only supported by the file store")
+)
+
+// encrypter represents an object capable of encrypting and decrypting content with a key derived from a passphrase
+type encrypter struct {
+	aead cipher.AEAD
+	salt []byte
+}
+
+// newEncrypter creates a new encrypter
+// If salt is nil, a random one is generated
+func newEncrypter(passphrase, salt []byte) (e *encrypter, err error) {
+	// Check passphrase
+	if len(passphrase) == 0 {
+		err = errMissingPassphrase
+		return
+	}
+
+	// Generate salt
+	if salt == nil {
+		salt = make([]byte, encryptionSaltSize)
+		if _, err = io.ReadFull(rand.Reader, salt); err != nil {
+			err = errors.Wrap(err, "generating salt failed")
+			return
+		}
+	}
+
+	// Derive key
+	var k []byte
+	if k, err = scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, encryptionKeySize); err != nil {
+		err = errors.Wrap(err, "deriving key failed")
+		return
+	}
+
+	// Create cipher
+	var b cipher.Block
+	if b, err = aes.NewCipher(k); err != nil {
+		err = errors.Wrap(err, "creating cipher failed")
+		return
+	}
+
+	// Create aead
+	e = &encrypter{salt: salt}
+	if e.aead, err = cipher.NewGCM(b); err != nil {
+		err = errors.Wrap(err, "creating gcm failed")
+		return
+	}
+	return
+}
+
+// newEncrypterForContent creates a new encrypter able to decrypt a specific content
+func newEncrypterForContent(passphrase, b []byte) (e *encrypter, err error) {
+	if len(b) < len(encryptionMagic)+encryptionSaltSize {
+		err = errTruncatedEncryption
+		return
+	}
+	return newEncrypter(passphrase, b[len(encryptionMagic):len(encryptionMagic)+encryptionSaltSize])
+}
+
+// isEncrypted checks whether content is encrypted
+func isEncrypted(b []byte) bool {
+	return bytes.HasPrefix(b, encryptionMagic)
+}
+
+// seal encrypts content
+func (e *encrypter) seal(plain []byte) (b []byte, err error) {
+	// Generate nonce
+	var nonce = make([]byte, e.aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		err = errors.Wrap(err, "generating nonce failed")
+		return
+	}
+
+	// Seal
+	b = append(b, encryptionMagic...)
+	b = append(b, e.salt...)
+	b = append(b, nonce...)
+	b = e.aead.Seal(b, nonce, plain, nil)
+	return
+}
+
+// open decrypts content
+func (e *encrypter) open(b []byte) (plain []byte, err error) {
+	// Check header
+	var headerSize = len(encryptionMagic) + encryptionSaltSize + e.aead.NonceSize()
+	if !isEncrypted(b) {
+		err = errors.New("content is not encrypted")
+		return
+	} else if len(b) < headerSize {
+		err = errTruncatedEncryption
+		return
+	}
+
+	// Open
+	if plain, err = e.aead.Open(nil, b[headerSize-e.aead.NonceSize():headerSize], b[headerSize:], nil); err != nil {
+		err = errInvalidPassphrase
+		return
+	}
+	return
+}
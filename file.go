@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// writeFileAtomic writes a file atomically: the content is written in a temp file which is synced and then renamed
+func writeFileAtomic(path string, b []byte) (err error) {
+	// Create temp file in the same dir so that the rename is atomic
+	var f *os.File
+	if f, err = ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp"); err != nil {
+		err = errors.Wrapf(err, "creating temp file for %s failed", path)
+		return
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	// Write
+	if _, err = f.Write(b); err != nil {
+		err = errors.Wrapf(err, "writing %s failed", f.Name())
+		return
+	}
+
+	// Sync
+	if err = f.Sync(); err != nil {
+		err = errors.Wrapf(err, "syncing %s failed", f.Name())
+		return
+	}
+
+	// Close
+	if err = f.Close(); err != nil {
+		err = errors.Wrapf(err, "closing %s failed", f.Name())
+		return
+	}
+
+	// Rename
+	if err = os.Rename(f.Name(), path); err != nil {
+		err = errors.Wrapf(err, "renaming %s into %s failed", f.Name(), path)
+		return
+	}
+
+	// Sync dir so that the rename is persisted as well
+	syncDir(filepath.Dir(path))
+	return
+}
+
+// copyFileAtomic copies a file atomically
+func copyFileAtomic(src, dst string) (err error) {
+	// Read
+	var b []byte
+	if b, err = ioutil.ReadFile(src); err != nil {
+		err = errors.Wrapf(err, "reading %s failed", src)
+		return
+	}
+
+	// Write
+	if err = writeFileAtomic(dst, b); err != nil {
+		err = errors.Wrapf(err, "writing %s failed", dst)
+		return
+	}
+	return
+}
+
+// syncDir syncs a dir so that entries created or renamed in it are persisted
+// Errors are ignored since some OSes don't allow syncing dirs
+func syncDir(path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	f.Sync()
+	f.Close()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Operations of the same amount whose dates are this close are possible duplicates
+const possibleDuplicateMaxDays = 3
+
+// fingerprintKey returns what identifies an operation of a statement, apart from its occurrence
+func fingerprintKey(o *Operation) string {
+	return strings.Join([]string{
+		o.Date.Format("2006-01-02"),
+		o.Amount.Currency,
+		strconv.FormatInt(o.Amount.Units, 10),
+		normalizeRawLabel(o.RawLabel),
+	}, "|")
+}
+
+// newFingerprint creates a new fingerprint out of a key and the number of operations with the same key before it
+func newFingerprint(key string, occurrence int) string {
+	var h = sha256.Sum256([]byte(key + "|" + strconv.Itoa(occurrence)))
+	return hex.EncodeToString(h[:16])
+}
+
+// setFingerprints sets the fingerprints of the operations that don't have one
+// Occurrences are counted in the order of the operations which must therefore be the order of their statement
+func setFingerprints(ops []*Operation) {
+	var occurrences = make(map[string]int)
+	for _, o := range ops {
+		var k = fingerprintKey(o)
+		if o.Fingerprint == "" {
+			o.Fingerprint = newFingerprint(k, occurrences[k])
+		}
+		occurrences[k]++
+	}
+}
+
+// normalizeRawLabel normalizes a raw label so that changes in case, spacing or punctuation don't matter
+func normalizeRawLabel(l string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToUpper(l), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// possibleDuplicates returns the operations that may be duplicates of an operation although their fingerprints differ
+func possibleDuplicates(ops []*Operation, o *Operation) (ds []*Operation) {
+	for _, c := range ops {
+		if c.Amount == o.Amount && c.Fingerprint != o.Fingerprint && absDuration(c.Date.Sub(o.Date)) <= possibleDuplicateMaxDays*24*time.Hour {
+			ds = append(ds, c)
+		}
+	}
+	return
+}
+
+// absDuration returns the absolute value of a duration
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFingerprintKey(t *testing.T) {
+	var d = time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC)
+	var o = &Operation{Amount: Money{Currency: "EUR", Units: -105000}, Date: d, RawLabel: "CB  Shop-Co 02/01"}
+
+	// Case, spacing and punctuation don't matter
+	for _, l := range []string{"cb shop co 02 01", " CB Shop.Co  02/01 ", "CB*SHOP*CO*02*01"} {
+		if k := fingerprintKey(&Operation{Amount: o.Amount, Date: d, RawLabel: l}); k != fingerprintKey(o) {
+			t.Errorf("expected %q to have key %s, got %s", l, fingerprintKey(o), k)
+		}
+	}
+
+	// Date, amount, currency and words do
+	for _, c := range []*Operation{
+		{Amount: o.Amount, Date: d.Add(24 * time.Hour), RawLabel: o.RawLabel},
+		{Amount: Money{Currency: "EUR", Units: -105001}, Date: d, RawLabel: o.RawLabel},
+		{Amount: Money{Currency: "USD", Units: -105000}, Date: d, RawLabel: o.RawLabel},
+		{Amount: o.Amount, Date: d, RawLabel: "CB Shop 02/01"},
+	} {
+		if fingerprintKey(c) == fingerprintKey(o) {
+			t.Errorf("expected %+v to have a key different from %s", c, fingerprintKey(o))
+		}
+	}
+}
+
+func TestSetFingerprints(t *testing.T) {
+	// Identical operations of the same day
+	var newOperations = func() []*Operation {
+		var d = time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC)
+		return []*Operation{
+			{Amount: Money{Currency: "EUR", Units: -20000}, Date: d, RawLabel: "Coffee"},
+			{Amount: Money{Currency: "EUR", Units: -20000}, Date: d, RawLabel: "COFFEE"},
+			{Amount: Money{Currency: "EUR", Units: -50000}, Date: d, RawLabel: "Shop"},
+		}
+	}
+	var ops = newOperations()
+	setFingerprints(ops)
+	if ops[0].Fingerprint == ops[1].Fingerprint {
+		t.Fatal("expected identical operations to have different fingerprints")
+	}
+
+	// Fingerprints are stable
+	var again = newOperations()
+	setFingerprints(again)
+	for idx := range ops {
+		if again[idx].Fingerprint != ops[idx].Fingerprint {
+			t.Errorf("operation #%d: expected fingerprint %s, got %s", idx+1, ops[idx].Fingerprint, again[idx].Fingerprint)
+		}
+	}
+
+	// Existing fingerprints are kept but still counted
+	var kept = newOperations()
+	kept[0].Fingerprint = "kept"
+	setFingerprints(kept)
+	if kept[0].Fingerprint != "kept" || kept[1].Fingerprint != ops[1].Fingerprint {
+		t.Errorf("expected fingerprints kept and %s, got %s and %s", ops[1].Fingerprint, kept[0].Fingerprint, kept[1].Fingerprint)
+	}
+}
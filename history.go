@@ -0,0 +1,114 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Constants
+const (
+	historySize = 100
+)
+
+// Vars
+var (
+	errNothingToRedo = errors.New("nothing to redo")
+	errNothingToUndo = errors.New("nothing to undo")
+)
+
+// history represents a bounded history of the changes made to operations
+type history struct {
+	redos []historyEntry
+	size  int
+	undos []historyEntry
+}
+
+// historyEntry represents a set of changes that are undone and redone together
+// Entries sharing the same batch, such as the operations added during an import, are merged
+type historyEntry struct {
+	Batch   string            `json:"-"`
+	Changes []operationChange `json:"-"`
+	Name    string            `json:"name"`
+}
+
+// operationChange represents the change of an operation
+// Before is nil when the operation has been added and After is nil when it has been deleted
+type operationChange struct {
+	AccountID string
+	After     *Operation
+	Before    *Operation
+}
+
+// newHistory creates a new history
+func newHistory(size int) *history {
+	return &history{size: size}
+}
+
+// newOperationChange creates a new operation change out of copies of the operations
+func newOperationChange(accountID string, before, after *Operation) (c operationChange) {
+	c.AccountID = accountID
+	if before != nil {
+		var o = *before
+		c.Before = &o
+	}
+	if after != nil {
+		var o = *after
+		c.After = &o
+	}
+	return
+}
+
+// reversed returns the changes needed to revert the entry
+func (e historyEntry) reversed() (cs []operationChange) {
+	for idx := len(e.Changes) - 1; idx >= 0; idx-- {
+		cs = append(cs, operationChange{AccountID: e.Changes[idx].AccountID, After: e.Changes[idx].Before, Before: e.Changes[idx].After})
+	}
+	return
+}
+
+// push pushes a new entry and forgets about the entries that could be redone
+func (h *history) push(e historyEntry) {
+	// Merge batch
+	h.redos = nil
+	if l := len(h.undos); e.Batch != "" && l > 0 && h.undos[l-1].Batch == e.Batch {
+		h.undos[l-1].Changes = append(h.undos[l-1].Changes, e.Changes...)
+		return
+	}
+
+	// Append
+	h.undos = append(h.undos, e)
+	if len(h.undos) > h.size {
+		h.undos = h.undos[len(h.undos)-h.size:]
+	}
+}
+
+// nextUndo returns the entry to undo
+func (h *history) nextUndo() (e historyEntry, err error) {
+	if len(h.undos) == 0 {
+		err = errNothingToUndo
+		return
+	}
+	e = h.undos[len(h.undos)-1]
+	return
+}
+
+// undone moves the entry that has been undone to the entries that can be redone
+func (h *history) undone() {
+	h.redos = append(h.redos, h.undos[len(h.undos)-1])
+	h.undos = h.undos[:len(h.undos)-1]
+}
+
+// nextRedo returns the entry to redo
+func (h *history) nextRedo() (e historyEntry, err error) {
+	if len(h.redos) == 0 {
+		err = errNothingToRedo
+		return
+	}
+	e = h.redos[len(h.redos)-1]
+	return
+}
+
+// redone moves the entry that has been redone to the entries that can be undone
+func (h *history) redone() {
+	h.undos = append(h.undos, h.redos[len(h.redos)-1])
+	h.redos = h.redos[:len(h.redos)-1]
+}
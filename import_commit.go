@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// importCommit represents what an import changes in an account
+// Account is the account of the statements when it doesn't exist yet and Points are the reconciliation points of
+// the statements that have a balance
+type importCommit struct {
+	account    *Account
+	operations []*Operation
+	points     []reconciliationPoint
+}
+
+// importSummary represents what an import has changed
+type importSummary struct {
+	Accounts []importSummaryAccount `json:"accounts"`
+}
+
+// importSummaryAccount represents what an import has changed in an account
+// Total is the sum of the amounts of the operations that have been added
+type importSummaryAccount struct {
+	Balance    Money  `json:"balance"`
+	Created    bool   `json:"created"`
+	ID         string `json:"id"`
+	Operations int    `json:"operations"`
+	Total      Money  `json:"total"`
+}
+
+// commitImport adds the operations of an import to their accounts, creates the accounts that don't exist yet and
+// records the reconciliation points of their statements along with metadata changes
+// Everything is checked before anything is changed and changes are written at once so that either all of them are
+// applied or none of them. Operations added with the same batch are undone together but undoing them leaves the
+// accounts created by the import, since accounts can't be deleted, as well as its reconciliation points.
+// Data must be locked
+func (d *Data) commitImport(cs []importCommit, batch string, ms map[string][]byte) (s importSummary, err error) {
+	// Read-only
+	if d.readOnly {
+		err = errReadOnly
+		return
+	}
+
+	// Loop through commits
+	// Accounts in data are not modified until changes have been written, their new state being built on copies
+	type accountChange struct {
+		account *Account
+		created bool
+		key     string
+		points  []byte
+		updated Account
+	}
+	var acs []accountChange
+	var ids = make(map[string]bool)
+	var hcs []operationChange
+	var scs []StoreChange
+	var now = time.Now()
+	s.Accounts = []importSummaryAccount{}
+	for _, c := range cs {
+		// Check account
+		if ids[c.account.ID] {
+			err = fmt.Errorf("account %s is committed twice", c.account.ID)
+			return
+		}
+		ids[c.account.ID] = true
+
+		// Fetch account
+		var ac = accountChange{key: reconciliationMetadataKey(c.account.ID)}
+		var errOne error
+		if ac.account, errOne = d.Accounts.One(c.account.ID); errOne != nil {
+			ac.account, ac.created = c.account, true
+			ac.account.setDefaults()
+		}
+		ac.updated = *ac.account
+		ac.updated.UpdatedAt = now
+
+		// Index fingerprints
+		var fingerprints = make(map[string]bool)
+		for _, o := range ac.account.Operations.All() {
+			fingerprints[o.Fingerprint] = true
+		}
+
+		// Loop through operations
+		// Ids are given the way the operation pool would
+		var ocs []StoreChange
+		var id = ac.account.Operations.Counter
+		var sa = importSummaryAccount{Created: ac.created, ID: ac.account.ID, Total: Money{Currency: ac.account.Currency}}
+		for _, o := range c.operations {
+			// Check currency
+			if err = checkOperationCurrency(ac.account, o); err != nil {
+				return
+			}
+
+			// Check duplicate
+			if fingerprints[o.Fingerprint] {
+				err = fmt.Errorf("operation %s of %s has already been imported in account %s", o.RawLabel, o.Date.Format("2006-01-02"), ac.account.ID)
+				return
+			}
+			fingerprints[o.Fingerprint] = true
+
+			// Add
+			id++
+			o.ID = id
+			if ac.updated.Balance, err = ac.updated.Balance.Add(o.Amount); err != nil {
+				err = errors.Wrapf(err, "adding amount of operation %s to balance of account %s failed", o.RawLabel, ac.account.ID)
+				return
+			}
+			if sa.Total, err = sa.Total.Add(o.Amount); err != nil {
+				err = errors.Wrapf(err, "adding amount of operation %s to total of account %s failed", o.RawLabel, ac.account.ID)
+				return
+			}
+			sa.Operations++
+			ocs = append(ocs, newStoreChangeOperation(storeChangeKindOperationAdded, ac.account.ID, o))
+			hcs = append(hcs, newOperationChange(ac.account.ID, nil, o))
+		}
+		sa.Balance = ac.updated.Balance
+
+		// Add reconciliation points
+		if len(c.points) > 0 {
+			var ps []reconciliationPoint
+			if ps, err = d.reconciliationPoints(ac.account.ID); err != nil {
+				err = errors.Wrapf(err, "fetching reconciliation points of account %s failed", ac.account.ID)
+				return
+			}
+			for _, p := range c.points {
+				ps = appendReconciliationPoint(ps, p)
+			}
+			if ac.points, err = json.Marshal(ps); err != nil {
+				err = errors.Wrap(err, "marshaling reconciliation points failed")
+				return
+			}
+		}
+
+		// Add store changes
+		// Accounts are written before their operations
+		var kind = storeChangeKindAccountUpdated
+		if ac.created {
+			kind = storeChangeKindAccountCreated
+		}
+		scs = append(scs, newStoreChangeAccount(kind, &ac.updated))
+		scs = append(scs, ocs...)
+		if ac.points != nil {
+			scs = append(scs, newStoreChangeMetadata(ac.key, ac.points))
+		}
+		acs = append(acs, ac)
+		s.Accounts = append(s.Accounts, sa)
+	}
+
+	// Add metadata changes
+	for k, v := range ms {
+		scs = append(scs, newStoreChangeMetadata(k, v))
+	}
+
+	// Write
+	if err = d.write(scs...); err != nil {
+		return
+	}
+
+	// Apply
+	for idx, ac := range acs {
+		if ac.created {
+			d.Accounts.Set(ac.account)
+		}
+		ac.account.Balance, ac.account.UpdatedAt = ac.updated.Balance, ac.updated.UpdatedAt
+		for _, o := range cs[idx].operations {
+			ac.account.Operations.set(o)
+		}
+		if ac.points != nil {
+			d.metadata[ac.key] = ac.points
+		}
+	}
+	for k, v := range ms {
+		d.metadata[k] = v
+	}
+
+	// Update history
+	if len(hcs) > 0 {
+		d.history.push(historyEntry{Batch: batch, Changes: hcs, Name: "import"})
+	}
+	return
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// Importer represents a bank statement format
+type Importer interface {
+	// Detect checks whether content is in the format of the importer
+	Detect(b []byte) bool
+	// Extensions returns the file extensions usually used by the format, such as ".csv"
+	Extensions() []string
+	// Name returns the name of the format
+	Name() string
+	// Parse parses content in the format of the importer
+	Parse(b []byte) (bankStatement, error)
+}
+
+// importers are tried in this order
+var importers = []Importer{
+	lbpImporter{},
+	ofxImporter{},
+	qifImporter{},
+	camtImporter{},
+	mt940Importer{},
+}
+
+// bankStatement represents a parsed bank statement
+// The balance of the account is the one before the operations of the statement whereas Balance is the one at Date
+// NoBalance is set when the format doesn't state any balance, such as QIF, in which case balances are meaningless
+// Errors are the lines that couldn't be parsed and whose operations are therefore missing
+// Format and Text are set by parseBankStatement as well as the account id, which is the name of the file, when the
+// statement doesn't state it
+type bankStatement struct {
+	Account    *Account
+	Balance    Money
+	Date       time.Time
+	Errors     []lineError
+	Format     string
+	NoBalance  bool
+	Operations []*Operation
+	Text       textInfo
+}
+
+// loadImporters returns the importers of the CSV profiles followed by the built-in importers
+// User defined formats come first since they're more specific
+func loadImporters(csvProfilesPath string) (is []Importer, err error) {
+	// Load CSV profiles
+	var ps []csvProfile
+	if ps, err = loadCSVProfiles(csvProfilesPath); err != nil {
+		err = errors.Wrap(err, "loading CSV profiles failed")
+		return
+	}
+
+	// Append
+	is = append(newCSVImporters(ps), importers...)
+	return
+}
+
+// lineError represents an error on a line of a statement which doesn't prevent the other lines from being imported
+// Line starts at 1
+type lineError struct {
+	Content string `json:"content"`
+	Error   string `json:"error"`
+	Line    int    `json:"line"`
+}
+
+// newLineError creates a new line error out of the lines of a part of a statement starting at a specific line offset
+// Line is relative to that part and starts at 1
+func newLineError(lines []string, line, offset int, err error) (e lineError) {
+	e = lineError{Error: err.Error(), Line: line + offset}
+	if line > 0 && line <= len(lines) {
+		e.Content = lines[line-1]
+	}
+	return
+}
+
+// findImporter returns the first importer that recognizes the content of a file
+// Importers whose extensions match the one of the file are tried first but content always has the last word since
+// extensions can be wrong
+func findImporter(is []Importer, path string, b []byte) (i Importer, err error) {
+	// Importers matching the extension
+	var ext = strings.ToLower(filepath.Ext(path))
+	for _, i = range is {
+		if hasExtension(i, ext) && i.Detect(b) {
+			return
+		}
+	}
+
+	// Other importers
+	for _, i = range is {
+		if !hasExtension(i, ext) && i.Detect(b) {
+			return
+		}
+	}
+	i = nil
+	err = fmt.Errorf("format of %s is not supported", path)
+	return
+}
+
+// hasExtension checks whether an extension is one of the extensions of an importer
+func hasExtension(i Importer, ext string) bool {
+	for _, e := range i.Extensions() {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// parseBankStatement parses a bank statement with the first of several importers that recognizes it
+// Content is normalized first so that importers only deal with UTF-8 and "\n" line endings
+func parseBankStatement(is []Importer, path string) (s bankStatement, err error) {
+	// Open file
+	var b []byte
+	if b, err = ioutil.ReadFile(path); err != nil {
+		err = errors.Wrapf(err, "opening %s failed", path)
+		return
+	}
+
+	// Normalize
+	var t textInfo
+	if b, t, err = normalizeText(b); err != nil {
+		err = errors.Wrapf(err, "normalizing %s failed", path)
+		return
+	}
+
+	// Find importer
+	var i Importer
+	if i, err = findImporter(is, path, b); err != nil {
+		return
+	}
+
+	// Parse
+	astilog.Debugf("Parsing bank statement %s as %s in %s", path, i.Name(), t.Encoding)
+	if s, err = i.Parse(b); err != nil {
+		err = errors.Wrapf(err, "parsing %s as %s failed", path, i.Name())
+		return
+	}
+	s.Format, s.Text = i.Name(), t
+	if s.Account.ID == "" {
+		s.Account.ID = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return
+}
+
+// mapRawLabel sets the subject, the category and the label of an operation based on its raw label
+// The raw label is padded so that keywords at its edges are matched as well
+func mapRawLabel(o *Operation) {
+	o.Subject = parseRawLabel(" " + o.RawLabel + " ")
+	if c, ok := mappingSubjectToCategory[o.Subject]; ok {
+		o.Category = c
+	}
+	if l, ok := mappingSubjectToLabel[o.Subject]; ok {
+		o.Label = l
+	}
+}
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CAMT balance types
+const (
+	camtBalanceTypeClosingBooked          = "CLBD"
+	camtBalanceTypeInterimBooked          = "ITBD"
+	camtBalanceTypeOpeningBooked          = "OPBD"
+	camtBalanceTypePreviouslyClosedBooked = "PRCD"
+)
+
+// CAMT entry statuses
+const (
+	camtCreditDebitIndicatorDebit = "DBIT"
+	camtEntryStatusBooked         = "BOOK"
+)
+
+// camtImporter represents the importer of ISO 20022 CAMT.053 statements and CAMT.052 reports
+// Only the statements of the account of the first statement are imported, and only their booked entries.
+// Opening and closing balances are checked against the sum of the entries, unless some of them are invalid.
+type camtImporter struct{}
+
+// camtDocument represents a CAMT document
+// Namespaces are ignored so that every version of the messages is parsed
+type camtDocument struct {
+	Reports    []camtStatement `xml:"BkToCstmrAcctRpt>Rpt"`
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+// camtStatement represents a CAMT statement or report
+type camtStatement struct {
+	Account  camtAccount   `xml:"Acct"`
+	Balances []camtBalance `xml:"Bal"`
+	Entries  []camtEntry   `xml:"Ntry"`
+	ID       string        `xml:"Id"`
+}
+
+// camtAccount represents a CAMT account
+type camtAccount struct {
+	Currency string `xml:"Ccy"`
+	IBAN     string `xml:"Id>IBAN"`
+	OtherID  string `xml:"Id>Othr>Id"`
+}
+
+// camtAmount represents a CAMT amount
+type camtAmount struct {
+	Currency string `xml:"Ccy,attr"`
+	Value    string `xml:",chardata"`
+}
+
+// camtBalance represents a CAMT balance
+type camtBalance struct {
+	Amount               camtAmount `xml:"Amt"`
+	CreditDebitIndicator string     `xml:"CdtDbtInd"`
+	Date                 camtDate   `xml:"Dt"`
+	Type                 string     `xml:"Tp>CdOrPrtry>Cd"`
+}
+
+// camtDate represents a CAMT date which is either a date or a date time
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+// camtEntry represents a CAMT entry
+// Line is the line of its opening tag
+type camtEntry struct {
+	AccountServicerReference string            `xml:"AcctSvcrRef"`
+	AdditionalInformation    string            `xml:"AddtlNtryInf"`
+	Amount                   camtAmount        `xml:"Amt"`
+	BookingDate              camtDate          `xml:"BookgDt"`
+	CreditDebitIndicator     string            `xml:"CdtDbtInd"`
+	Status                   camtStatus        `xml:"Sts"`
+	Transactions             []camtTransaction `xml:"NtryDtls>TxDtls"`
+	ValueDate                camtDate          `xml:"ValDt"`
+	line                     int
+}
+
+// UnmarshalXML implements the xml.Unmarshaler interface
+// It keeps the line of the opening tag of the entry
+func (e *camtEntry) UnmarshalXML(d *xml.Decoder, start xml.StartElement) (err error) {
+	// Entry has the fields of camtEntry but not this method so that it's decoded the default way
+	type entry camtEntry
+	var line, _ = d.InputPos()
+	var v entry
+	if err = d.DecodeElement(&v, &start); err != nil {
+		return
+	}
+	*e = camtEntry(v)
+	e.line = line
+	return
+}
+
+// camtStatus represents the status of a CAMT entry
+// It is a code in recent versions of the messages
+type camtStatus struct {
+	Code  string `xml:"Cd"`
+	Value string `xml:",chardata"`
+}
+
+// camtTransaction represents the details of a CAMT transaction
+// Related parties' names are nested in a party in recent versions of the messages
+type camtTransaction struct {
+	CreditorName            string     `xml:"RltdPties>Cdtr>Nm"`
+	CreditorPartyName       string     `xml:"RltdPties>Cdtr>Pty>Nm"`
+	DebtorName              string     `xml:"RltdPties>Dbtr>Nm"`
+	DebtorPartyName         string     `xml:"RltdPties>Dbtr>Pty>Nm"`
+	InstructedAmount        camtAmount `xml:"AmtDtls>InstdAmt>Amt"`
+	StructuredReferences    []string   `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+	UnstructuredRemittances []string   `xml:"RmtInf>Ustrd"`
+}
+
+// Detect implements the Importer interface
+func (camtImporter) Detect(b []byte) bool {
+	return bytes.Contains(b, []byte("BkToCstmrStmt>")) || bytes.Contains(b, []byte("BkToCstmrAcctRpt>"))
+}
+
+// Extensions implements the Importer interface
+func (camtImporter) Extensions() []string {
+	return []string{".xml"}
+}
+
+// Name implements the Importer interface
+func (camtImporter) Name() string {
+	return "CAMT"
+}
+
+// Parse implements the Importer interface
+func (camtImporter) Parse(b []byte) (s bankStatement, err error) {
+	// Unmarshal
+	// Content has already been converted to UTF-8 whatever the encoding it declares
+	var d camtDocument
+	var dc = xml.NewDecoder(bytes.NewReader(b))
+	dc.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+	if err = dc.Decode(&d); err != nil {
+		err = errors.Wrap(err, "unmarshaling failed")
+		return
+	}
+
+	// Fetch statements
+	var sts = append(d.Statements, d.Reports...)
+	if len(sts) == 0 {
+		err = errors.New("no statement")
+		return
+	}
+
+	// Parse account
+	var a = newAccount()
+	if a.ID = sts[0].Account.id(); a.ID == "" {
+		err = errors.New("no account id")
+		return
+	}
+	if a.Currency = strings.ToUpper(sts[0].Account.Currency); a.Currency == "" && len(sts[0].Balances) > 0 {
+		a.Currency = strings.ToUpper(sts[0].Balances[0].Amount.Currency)
+	}
+	if !validCurrency(a.Currency) {
+		err = fmt.Errorf("%s is not a valid currency", a.Currency)
+		return
+	}
+	s.Account = a
+
+	// Loop through statements
+	var content = strings.Split(string(b), "\n")
+	var ps []camtParsedStatement
+	for _, st := range sts {
+		// Statement of another account
+		if st.Account.id() != a.ID {
+			continue
+		}
+
+		// Parse statement
+		var p camtParsedStatement
+		if p, err = parseCAMTStatement(st, a.Currency, content); err != nil {
+			err = errors.Wrapf(err, "parsing statement %s failed", st.ID)
+			return
+		}
+		ps = append(ps, p)
+		s.Errors = append(s.Errors, p.errors...)
+	}
+
+	// Statements are not necessarily sorted
+	sort.SliceStable(ps, func(i, j int) bool { return ps[i].date().Before(ps[j].date()) })
+
+	// Merge statements
+	var total = Money{Currency: a.Currency}
+	for _, p := range ps {
+		s.Operations = append(s.Operations, p.operations...)
+		if total, err = total.Add(p.total); err != nil {
+			err = errors.Wrap(err, "adding total of statement failed")
+			return
+		}
+	}
+	sort.SliceStable(s.Operations, func(i, j int) bool { return s.Operations[i].Date.Before(s.Operations[j].Date) })
+
+	// Balances
+	// The most recent closing balance is used first and then the oldest opening balance, the entries of the other
+	// statements being added or removed
+	s.NoBalance = true
+	for i := len(ps) - 1; i >= 0 && s.NoBalance; i-- {
+		if ps[i].closing == nil {
+			continue
+		}
+		s.Balance, s.Date, s.NoBalance = *ps[i].closing, ps[i].closingDate, false
+		for _, p := range ps[i+1:] {
+			if s.Balance, err = s.Balance.Add(p.total); err != nil {
+				err = errors.Wrap(err, "adding total of statement to closing balance failed")
+				return
+			}
+		}
+		if i < len(ps)-1 {
+			s.Date = time.Time{}
+		}
+	}
+	for i := 0; i < len(ps) && s.NoBalance; i++ {
+		if ps[i].opening == nil {
+			continue
+		}
+		if s.Balance, err = ps[i].opening.Add(total); err != nil {
+			err = errors.Wrap(err, "adding total to opening balance failed")
+			return
+		}
+		s.NoBalance = false
+		for _, p := range ps[:i] {
+			if s.Balance, err = s.Balance.Sub(p.total); err != nil {
+				err = errors.Wrap(err, "subtracting total of statement from opening balance failed")
+				return
+			}
+		}
+	}
+	if s.NoBalance {
+		s.Balance = Money{Currency: a.Currency}
+	}
+	if a.Balance, err = s.Balance.Sub(total); err != nil {
+		err = errors.Wrap(err, "subtracting total from balance failed")
+		return
+	}
+	if s.Date.IsZero() && len(s.Operations) > 0 {
+		s.Date = s.Operations[len(s.Operations)-1].Date
+	}
+	return
+}
+
+// id returns the id of a CAMT account
+func (a camtAccount) id() string {
+	if a.IBAN != "" {
+		return strings.Replace(a.IBAN, " ", "", -1)
+	}
+	return strings.TrimSpace(a.OtherID)
+}
+
+// day returns the day of a CAMT date
+func (d camtDate) day() (t time.Time, err error) {
+	var v = strings.TrimSpace(d.Date)
+	if v == "" {
+		v = strings.TrimSpace(d.DateTime)
+	}
+	if len(v) < 10 {
+		err = fmt.Errorf("%s is not a valid date", v)
+		return
+	}
+	if t, err = time.Parse("2006-01-02", v[:10]); err != nil {
+		err = fmt.Errorf("%s is not a valid date", v)
+		return
+	}
+	return
+}
+
+// money returns the money of a CAMT amount
+func (a camtAmount) money(creditDebitIndicator string) (m Money, err error) {
+	if m, err = parseMoney(strings.TrimSpace(a.Value), strings.ToUpper(a.Currency)); err != nil {
+		return
+	}
+	if creditDebitIndicator == camtCreditDebitIndicatorDebit {
+		m = m.Neg()
+	}
+	return
+}
+
+// camtParsedStatement represents a parsed CAMT statement
+// Balances are nil when the statement doesn't state them
+type camtParsedStatement struct {
+	closing     *Money
+	closingDate time.Time
+	errors      []lineError
+	opening     *Money
+	openingDate time.Time
+	operations  []*Operation
+	total       Money
+}
+
+// date returns the date a parsed CAMT statement is sorted by
+func (p camtParsedStatement) date() time.Time {
+	if !p.openingDate.IsZero() {
+		return p.openingDate
+	}
+	if len(p.operations) > 0 {
+		return p.operations[0].Date
+	}
+	return p.closingDate
+}
+
+// parseCAMTStatement parses a CAMT statement and checks its balances against the sum of its entries
+// Invalid entries are reported as line errors of the content the statement has been unmarshaled from
+func parseCAMTStatement(st camtStatement, currency string, content []string) (p camtParsedStatement, err error) {
+	// Loop through balances
+	var closingBooked bool
+	for _, b := range st.Balances {
+		// Parse balance
+		var m Money
+		if m, err = b.Amount.money(b.CreditDebitIndicator); err != nil {
+			err = errors.Wrapf(err, "parsing %s balance failed", b.Type)
+			return
+		}
+		if m.Currency != currency {
+			err = fmt.Errorf("currency %s of %s balance differs from account currency %s", m.Currency, b.Type, currency)
+			return
+		}
+		var d time.Time
+		if d, err = b.Date.day(); err != nil {
+			err = errors.Wrapf(err, "parsing %s balance date failed", b.Type)
+			return
+		}
+
+		// Process balance
+		// Reports have interim balances instead of a closing one, the last one being the most recent
+		switch b.Type {
+		case camtBalanceTypeOpeningBooked, camtBalanceTypePreviouslyClosedBooked:
+			if p.opening == nil {
+				p.opening, p.openingDate = &m, d
+			}
+		case camtBalanceTypeClosingBooked:
+			p.closing, p.closingDate, closingBooked = &m, d, true
+		case camtBalanceTypeInterimBooked:
+			if !closingBooked {
+				p.closing, p.closingDate = &m, d
+			}
+		}
+	}
+
+	// Loop through entries
+	p.total = Money{Currency: currency}
+	for _, e := range st.Entries {
+		// Only booked entries are part of the balances
+		if c := e.Status.code(); c != "" && c != camtEntryStatusBooked {
+			continue
+		}
+
+		// Parse entry
+		var o *Operation
+		var errParse error
+		if o, errParse = parseCAMTEntry(e, currency); errParse != nil {
+			p.errors = append(p.errors, newLineError(content, e.line, 0, errParse))
+			continue
+		}
+		if p.total, errParse = p.total.Add(o.Amount); errParse != nil {
+			p.errors = append(p.errors, newLineError(content, e.line, 0, errParse))
+			continue
+		}
+		p.operations = append(p.operations, o)
+	}
+	sort.SliceStable(p.operations, func(i, j int) bool { return p.operations[i].Date.Before(p.operations[j].Date) })
+
+	// Check balances
+	// They can't add up when entries are missing
+	if p.opening != nil && p.closing != nil && len(p.errors) == 0 {
+		if e, errAdd := p.opening.Add(p.total); errAdd != nil || e.Units != p.closing.Units || e.Currency != p.closing.Currency {
+			err = fmt.Errorf("opening balance %s and entries totalling %s don't add up to closing balance %s", p.opening, p.total, p.closing)
+			return
+		}
+	}
+	return
+}
+
+// code returns the code of the status of a CAMT entry
+func (s camtStatus) code() string {
+	if s.Code != "" {
+		return strings.TrimSpace(s.Code)
+	}
+	return strings.TrimSpace(s.Value)
+}
+
+// parseCAMTEntry parses a CAMT entry
+func parseCAMTEntry(e camtEntry, currency string) (o *Operation, err error) {
+	// Init
+	o = &Operation{ExternalID: strings.TrimSpace(e.AccountServicerReference)}
+
+	// Parse amount
+	if o.Amount, err = e.Amount.money(e.CreditDebitIndicator); err != nil {
+		err = errors.Wrap(err, "parsing amount failed")
+		return
+	}
+	if o.Amount.Currency != currency {
+		err = fmt.Errorf("amount currency %s differs from account currency %s", o.Amount.Currency, currency)
+		return
+	}
+	o.OriginalAmount = o.Amount
+
+	// Parse dates
+	// The booking date falls back on the value date since it's optional in reports
+	var vd, verr = e.ValueDate.day()
+	if verr == nil {
+		o.ValueDate = &vd
+	}
+	if o.Date, err = e.BookingDate.day(); err != nil {
+		if verr != nil {
+			err = errors.Wrap(err, "parsing booking date failed")
+			return
+		}
+		o.Date, err = vd, nil
+	}
+
+	// Parse transaction details
+	// Entries batching several transactions only keep the additional information
+	var labels []string
+	if len(e.Transactions) == 1 {
+		// Counterparty is the creditor of debits and the debtor of credits
+		var t = e.Transactions[0]
+		if e.CreditDebitIndicator == camtCreditDebitIndicatorDebit {
+			labels = append(labels, t.CreditorName, t.CreditorPartyName)
+		} else {
+			labels = append(labels, t.DebtorName, t.DebtorPartyName)
+		}
+
+		// Remittance information
+		labels = append(labels, t.UnstructuredRemittances...)
+		labels = append(labels, t.StructuredReferences...)
+
+		// Original amount
+		if t.InstructedAmount.Value != "" && !strings.EqualFold(t.InstructedAmount.Currency, currency) {
+			if o.OriginalAmount, err = t.InstructedAmount.money(e.CreditDebitIndicator); err != nil {
+				err = errors.Wrap(err, "parsing instructed amount failed")
+				return
+			}
+		}
+	}
+	if o.RawLabel = joinLabels(labels); o.RawLabel == "" {
+		o.RawLabel = strings.TrimSpace(e.AdditionalInformation)
+	}
+
+	// Parse raw label
+	mapRawLabel(o)
+	return
+}
+
+// joinLabels joins the non empty parts of a label
+func joinLabels(ls []string) string {
+	var vs []string
+	for _, l := range ls {
+		if l = strings.Join(strings.Fields(l), " "); l != "" {
+			vs = append(vs, l)
+		}
+	}
+	return strings.Join(vs, " ")
+}
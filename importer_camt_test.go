@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// camtTestDocument builds a CAMT.053 document out of entries written one per line
+// Entries start on line 9
+func camtTestDocument(opening, closing string, entries ...string) string {
+	var s = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+<BkToCstmrStmt>
+<Stmt>
+<Id>S1</Id>
+<Acct><Id><IBAN>FR76 3000 6000 0112 3456 7890 189</IBAN></Id><Ccy>EUR</Ccy></Acct>
+` + fmt.Sprintf(`<Bal><Tp><CdOrPrtry><Cd>OPBD</Cd></CdOrPrtry></Tp><Amt Ccy="EUR">%s</Amt><CdtDbtInd>CRDT</CdtDbtInd><Dt><Dt>2018-01-01</Dt></Dt></Bal>
+<Bal><Tp><CdOrPrtry><Cd>CLBD</Cd></CdOrPrtry></Tp><Amt Ccy="EUR">%s</Amt><CdtDbtInd>CRDT</CdtDbtInd><Dt><Dt>2018-01-31</Dt></Dt></Bal>
+`, opening, closing)
+	for _, e := range entries {
+		s += e + "\n"
+	}
+	return s + "</Stmt>\n</BkToCstmrStmt>\n</Document>"
+}
+
+func TestCAMTImporter(t *testing.T) {
+	testImporter(t, camtImporter{}, []testStatement{
+		{
+			content: camtTestDocument("100", "189.50",
+				`<Ntry><Amt Ccy="EUR">10.50</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>BOOK</Sts><BookgDt><Dt>2018-01-02</Dt></BookgDt><AcctSvcrRef>R1</AcctSvcrRef><NtryDtls><TxDtls><RltdPties><Cdtr><Nm>Shop</Nm></Cdtr></RltdPties><RmtInf><Ustrd>Card  payment</Ustrd></RmtInf></TxDtls></NtryDtls></Ntry>`,
+				`<Ntry><Amt Ccy="EUR">100</Amt><CdtDbtInd>CRDT</CdtDbtInd><Sts><Cd>BOOK</Cd></Sts><BookgDt><DtTm>2018-01-03T10:00:00</DtTm></BookgDt><AcctSvcrRef>R2</AcctSvcrRef><AddtlNtryInf>Salary</AddtlNtryInf></Ntry>`,
+				`<Ntry><Amt Ccy="EUR">5</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>PDNG</Sts><BookgDt><Dt>2018-01-04</Dt></BookgDt><AcctSvcrRef>R3</AcctSvcrRef></Ntry>`,
+			),
+			name: "statement",
+			operations: []testOperation{
+				{amount: -105000, date: "2018-01-02", externalID: "R1", rawLabel: "Shop Card payment"},
+				{amount: 1000000, date: "2018-01-03", externalID: "R2", rawLabel: "Salary"},
+			},
+		},
+		{
+			content: camtTestDocument("100", "0",
+				`<Ntry><Amt Ccy="EUR">ten</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>BOOK</Sts><BookgDt><Dt>2018-01-02</Dt></BookgDt><AcctSvcrRef>R1</AcctSvcrRef></Ntry>`,
+				`<Ntry><Amt Ccy="USD">1</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>BOOK</Sts><BookgDt><Dt>2018-01-02</Dt></BookgDt><AcctSvcrRef>R2</AcctSvcrRef></Ntry>`,
+				`<Ntry><Amt Ccy="EUR">1</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>BOOK</Sts><BookgDt><Dt>2018-13-02</Dt></BookgDt><AcctSvcrRef>R3</AcctSvcrRef></Ntry>`,
+				`<Ntry><Amt Ccy="EUR">2</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>BOOK</Sts><ValDt><Dt>2018-01-05</Dt></ValDt><AcctSvcrRef>R4</AcctSvcrRef><AddtlNtryInf>Fees</AddtlNtryInf></Ntry>`,
+			),
+			errorLines: []int{9, 10, 11},
+			name:       "malformed entries",
+			operations: []testOperation{
+				{amount: -20000, date: "2018-01-05", externalID: "R4", rawLabel: "Fees"},
+			},
+		},
+		{
+			content: camtTestDocument("100", "50",
+				`<Ntry><Amt Ccy="EUR">10</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>BOOK</Sts><BookgDt><Dt>2018-01-02</Dt></BookgDt></Ntry>`,
+			),
+			err:  true,
+			name: "balances don't add up",
+		},
+		{
+			content: `<Document><BkToCstmrStmt></BkToCstmrStmt></Document>`,
+			err:     true,
+			name:    "no statement",
+		},
+	})
+}
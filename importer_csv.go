@@ -0,0 +1,509 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// CSV profiles
+// The CSV profiles file is shared by all profiles since it describes formats rather than data
+const (
+	csvProfilesFileName = "csvprofiles.json"
+	csvSignInverted     = "inverted"
+	csvSignNormal       = "normal"
+)
+
+// csvProfile represents a user defined CSV format
+// Columns are either 0-based indexes or names looked up in the last header row, and cells are 0-based positions in
+// header rows. Amounts are either in one column, whose sign may be inverted, or in separate debit and credit columns.
+// The balance is either in a header cell or in a column, in which case it's the one after the most recent operation.
+// Empty separators mean that the last of "," and "." in an amount is the decimal separator.
+type csvProfile struct {
+	Account            csvProfileAccount `json:"account"`
+	Columns            csvProfileColumns `json:"columns"`
+	DateLayout         string            `json:"date_layout"`
+	DecimalSeparator   string            `json:"decimal_separator,omitempty"`
+	Delimiter          string            `json:"delimiter"`
+	Detect             string            `json:"detect,omitempty"`
+	HeaderRows         int               `json:"header_rows"`
+	Name               string            `json:"name"`
+	NewestFirst        bool              `json:"newest_first"`
+	Sign               string            `json:"sign,omitempty"`
+	ThousandsSeparator string            `json:"thousands_separator,omitempty"`
+}
+
+// csvProfileAccount represents where the account of a CSV profile comes from
+// Fixed values are used when cells are not set and the id defaults to the name of the profile
+type csvProfileAccount struct {
+	BalanceCell  *csvProfileCell `json:"balance_cell,omitempty"`
+	Currency     string          `json:"currency,omitempty"`
+	CurrencyCell *csvProfileCell `json:"currency_cell,omitempty"`
+	ID           string          `json:"id,omitempty"`
+	IDCell       *csvProfileCell `json:"id_cell,omitempty"`
+}
+
+// csvProfileCell represents a header cell
+type csvProfileCell struct {
+	Column int `json:"column"`
+	Row    int `json:"row"`
+}
+
+// csvProfileColumns represents the columns of a CSV profile
+// Label columns are joined
+type csvProfileColumns struct {
+	Amount     string   `json:"amount,omitempty"`
+	Balance    string   `json:"balance,omitempty"`
+	Credit     string   `json:"credit,omitempty"`
+	Date       string   `json:"date"`
+	Debit      string   `json:"debit,omitempty"`
+	ExternalID string   `json:"external_id,omitempty"`
+	Label      []string `json:"label"`
+	ValueDate  string   `json:"value_date,omitempty"`
+}
+
+// csvProfilesPath returns the CSV profiles file path of a data dir
+func csvProfilesPath(dataDirPath string) string {
+	return filepath.Join(dataDirPath, csvProfilesFileName)
+}
+
+// loadCSVProfiles loads the CSV profiles file
+// A missing file means there are no profiles
+func loadCSVProfiles(path string) (ps []csvProfile, err error) {
+	// Read
+	var b []byte
+	if b, err = ioutil.ReadFile(path); os.IsNotExist(err) {
+		ps = []csvProfile{}
+		err = nil
+		return
+	} else if err != nil {
+		err = errors.Wrapf(err, "reading %s failed", path)
+		return
+	}
+
+	// Unmarshal
+	if err = json.Unmarshal(b, &ps); err != nil {
+		err = errors.Wrapf(err, "unmarshaling %s failed", path)
+		return
+	}
+	return
+}
+
+// saveCSVProfiles saves the CSV profiles file
+func saveCSVProfiles(path string, ps []csvProfile) (err error) {
+	// Sort
+	sort.Slice(ps, func(i, j int) bool { return ps[i].Name < ps[j].Name })
+
+	// Marshal
+	var b []byte
+	if b, err = json.MarshalIndent(ps, "", "  "); err != nil {
+		err = errors.Wrap(err, "marshaling failed")
+		return
+	}
+
+	// Write
+	if err = writeFileAtomic(path, b); err != nil {
+		err = errors.Wrapf(err, "writing %s failed", path)
+		return
+	}
+	return
+}
+
+// validate validates a CSV profile
+func (p csvProfile) validate() error {
+	// General
+	if strings.TrimSpace(p.Name) == "" {
+		return errors.New("name is empty")
+	} else if r, _ := utf8.DecodeRuneInString(p.Delimiter); utf8.RuneCountInString(p.Delimiter) != 1 || r == '"' || r == '\r' || r == '\n' {
+		return fmt.Errorf("%q is not a valid delimiter", p.Delimiter)
+	} else if p.HeaderRows < 0 {
+		return fmt.Errorf("%d is not a valid number of header rows", p.HeaderRows)
+	} else if p.DateLayout == "" {
+		return errors.New("date layout is empty")
+	} else if p.Sign != "" && p.Sign != csvSignNormal && p.Sign != csvSignInverted {
+		return fmt.Errorf("%s is not a valid sign, only %s and %s are allowed", p.Sign, csvSignNormal, csvSignInverted)
+	} else if p.DecimalSeparator != "" && p.DecimalSeparator != "," && p.DecimalSeparator != "." {
+		return fmt.Errorf("%s is not a valid decimal separator, only , and . are allowed", p.DecimalSeparator)
+	} else if utf8.RuneCountInString(p.ThousandsSeparator) > 1 || (p.ThousandsSeparator != "" && p.ThousandsSeparator == p.DecimalSeparator) {
+		return fmt.Errorf("%s is not a valid thousands separator", p.ThousandsSeparator)
+	}
+
+	// Columns
+	if p.Columns.Date == "" {
+		return errors.New("date column is empty")
+	} else if len(p.Columns.Label) == 0 {
+		return errors.New("label columns are empty")
+	} else if (p.Columns.Amount == "") == (p.Columns.Debit == "" && p.Columns.Credit == "") {
+		return errors.New("either an amount column or debit and credit columns are needed")
+	}
+
+	// Account
+	if p.Account.Currency != "" && !validCurrency(p.Account.Currency) {
+		return fmt.Errorf("%s is not a valid currency", p.Account.Currency)
+	}
+	for _, c := range []*csvProfileCell{p.Account.BalanceCell, p.Account.CurrencyCell, p.Account.IDCell} {
+		if c != nil && (c.Row < 0 || c.Row >= p.HeaderRows || c.Column < 0) {
+			return fmt.Errorf("cell %d:%d is not in header rows", c.Row, c.Column)
+		}
+	}
+	return nil
+}
+
+// csvImporter represents the importer of a CSV profile
+type csvImporter struct {
+	p csvProfile
+}
+
+// newCSVImporters creates the importers of CSV profiles
+func newCSVImporters(ps []csvProfile) (is []Importer) {
+	for _, p := range ps {
+		is = append(is, csvImporter{p: p})
+	}
+	return
+}
+
+// Detect implements the Importer interface
+// Content is parsed since a CSV file has no signature, unless the profile has a string to look for, and most of its
+// rows must be valid operations
+func (i csvImporter) Detect(b []byte) bool {
+	if i.p.Detect != "" && !bytes.Contains(b, []byte(i.p.Detect)) {
+		return false
+	}
+	s, err := i.Parse(b)
+	return err == nil && len(s.Operations) > len(s.Errors)
+}
+
+// Extensions implements the Importer interface
+func (i csvImporter) Extensions() []string {
+	return []string{".csv", ".txt"}
+}
+
+// Name implements the Importer interface
+func (i csvImporter) Name() string {
+	return i.p.Name
+}
+
+// Parse implements the Importer interface
+func (i csvImporter) Parse(b []byte) (s bankStatement, err error) {
+	// Validate
+	if err = i.p.validate(); err != nil {
+		err = errors.Wrapf(err, "validating profile %s failed", i.p.Name)
+		return
+	}
+
+	// Read rows
+	// Rows that can't be read are reported as line errors once the header rows have been read
+	var r = csv.NewReader(bytes.NewReader(b))
+	r.Comma, _ = utf8.DecodeRuneInString(i.p.Delimiter)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	var content = strings.Split(string(b), "\n")
+	var header, body [][]string
+	var lines []int
+	for {
+		var row []string
+		var errRead error
+		if row, errRead = r.Read(); errRead == io.EOF {
+			break
+		} else if errRead != nil {
+			if len(header) < i.p.HeaderRows {
+				err = errors.Wrap(errRead, "reading header rows failed")
+				return
+			}
+			var line int
+			if e, ok := errRead.(*csv.ParseError); ok {
+				line = e.StartLine
+			}
+			s.Errors = append(s.Errors, newLineError(content, line, 0, errRead))
+			continue
+		}
+		if len(header) < i.p.HeaderRows {
+			header = append(header, row)
+			continue
+		}
+		var line, _ = r.FieldPos(0)
+		body = append(body, row)
+		lines = append(lines, line)
+	}
+	if len(header) < i.p.HeaderRows {
+		err = fmt.Errorf("%d rows is less than %d header rows", len(header), i.p.HeaderRows)
+		return
+	}
+
+	// Parse account
+	var a = newAccount()
+	if a.ID, err = i.value(header, i.p.Account.IDCell, i.p.Account.ID); err != nil {
+		err = errors.Wrap(err, "fetching account id failed")
+		return
+	} else if a.ID == "" {
+		a.ID = i.p.Name
+	}
+	var currency string
+	if currency, err = i.value(header, i.p.Account.CurrencyCell, i.p.Account.Currency); err != nil {
+		err = errors.Wrap(err, "fetching account currency failed")
+		return
+	}
+	a.Currency = parseCurrency(currency)
+	s.Account = a
+
+	// Resolve columns
+	var cs = make(map[string]int)
+	for k, v := range map[string]string{
+		"amount":      i.p.Columns.Amount,
+		"balance":     i.p.Columns.Balance,
+		"credit":      i.p.Columns.Credit,
+		"date":        i.p.Columns.Date,
+		"debit":       i.p.Columns.Debit,
+		"external_id": i.p.Columns.ExternalID,
+		"value_date":  i.p.Columns.ValueDate,
+	} {
+		if cs[k], err = i.column(header, v); err != nil {
+			err = errors.Wrapf(err, "resolving %s column failed", k)
+			return
+		}
+	}
+	var ls []int
+	for _, v := range i.p.Columns.Label {
+		var c int
+		if c, err = i.column(header, v); err != nil {
+			err = errors.Wrap(err, "resolving label column failed")
+			return
+		}
+		ls = append(ls, c)
+	}
+
+	// Loop through rows
+	var balances []Money
+	for idx, row := range body {
+		// Parse row
+		var o *Operation
+		var balance Money
+		var errParse error
+		if o, balance, errParse = i.parseRow(row, cs, ls, a.Currency); errParse != nil {
+			s.Errors = append(s.Errors, newLineError(content, lines[idx], 0, errParse))
+			continue
+		}
+		s.Operations = append(s.Operations, o)
+		balances = append(balances, balance)
+	}
+
+	// Order operations
+	if i.p.NewestFirst {
+		for l, r := 0, len(s.Operations)-1; l < r; l, r = l+1, r-1 {
+			s.Operations[l], s.Operations[r] = s.Operations[r], s.Operations[l]
+			balances[l], balances[r] = balances[r], balances[l]
+		}
+	}
+	var idxs = make([]int, len(s.Operations))
+	for idx := range idxs {
+		idxs[idx] = idx
+	}
+	sort.SliceStable(idxs, func(x, y int) bool { return s.Operations[idxs[x]].Date.Before(s.Operations[idxs[y]].Date) })
+	var sorted = make([]*Operation, len(idxs))
+	for x, idx := range idxs {
+		sorted[x] = s.Operations[idx]
+	}
+	s.Operations = sorted
+
+	// Balance
+	var total = Money{Currency: a.Currency}
+	for _, o := range s.Operations {
+		if total, err = total.Add(o.Amount); err != nil {
+			err = errors.Wrap(err, "adding amount to total failed")
+			return
+		}
+	}
+	switch {
+	case i.p.Account.BalanceCell != nil:
+		var v string
+		if v, err = i.value(header, i.p.Account.BalanceCell, ""); err != nil {
+			err = errors.Wrap(err, "fetching balance failed")
+			return
+		}
+		if s.Balance, err = i.parseAmount(v, a.Currency); err != nil {
+			err = errors.Wrapf(err, "parsing balance %s failed", v)
+			return
+		}
+	case cs["balance"] >= 0 && len(idxs) > 0:
+		s.Balance = balances[idxs[len(idxs)-1]]
+	default:
+		s.NoBalance = true
+		s.Balance = Money{Currency: a.Currency}
+	}
+	if a.Balance, err = s.Balance.Sub(total); err != nil {
+		err = errors.Wrap(err, "subtracting total from balance failed")
+		return
+	}
+	if len(s.Operations) > 0 {
+		s.Date = s.Operations[len(s.Operations)-1].Date
+	}
+	return
+}
+
+// parseRow parses a CSV row into an operation and the balance after it
+func (i csvImporter) parseRow(row []string, cs map[string]int, ls []int, currency string) (o *Operation, balance Money, err error) {
+	// Cell returns the value of a column or an empty string when the column is not set
+	var cell = func(c int) (string, error) {
+		if c < 0 {
+			return "", nil
+		} else if c >= len(row) {
+			return "", fmt.Errorf("column %d is out of range", c)
+		}
+		return strings.TrimSpace(row[c]), nil
+	}
+
+	// Parse date
+	var v string
+	if v, err = cell(cs["date"]); err != nil {
+		return
+	}
+	o = &Operation{}
+	if o.Date, err = time.Parse(i.p.DateLayout, v); err != nil {
+		err = fmt.Errorf("%s is not a valid date", v)
+		return
+	}
+	if v, err = cell(cs["value_date"]); err != nil {
+		return
+	} else if v != "" {
+		var vd time.Time
+		if vd, err = time.Parse(i.p.DateLayout, v); err != nil {
+			err = fmt.Errorf("%s is not a valid value date", v)
+			return
+		}
+		o.ValueDate = &vd
+	}
+
+	// Parse amount
+	if cs["amount"] >= 0 {
+		if v, err = cell(cs["amount"]); err != nil {
+			return
+		}
+		if o.Amount, err = i.parseAmount(v, currency); err != nil {
+			err = errors.Wrapf(err, "parsing amount %s failed", v)
+			return
+		}
+		if i.p.Sign == csvSignInverted {
+			o.Amount = o.Amount.Neg()
+		}
+	} else {
+		// Debits may or may not be written with a minus sign
+		o.Amount = Money{Currency: currency}
+		for _, k := range []string{"credit", "debit"} {
+			if v, err = cell(cs[k]); err != nil {
+				return
+			}
+			var m Money
+			if m, err = i.parseAmount(v, currency); err != nil {
+				err = errors.Wrapf(err, "parsing %s %s failed", k, v)
+				return
+			}
+			if m.Units < 0 {
+				m = m.Neg()
+			}
+			if k == "debit" {
+				m = m.Neg()
+			}
+			if o.Amount, err = o.Amount.Add(m); err != nil {
+				err = errors.Wrapf(err, "adding %s %s failed", k, v)
+				return
+			}
+		}
+	}
+	o.OriginalAmount = o.Amount
+
+	// Parse balance
+	if v, err = cell(cs["balance"]); err != nil {
+		return
+	}
+	if balance, err = i.parseAmount(v, currency); err != nil {
+		err = errors.Wrapf(err, "parsing balance %s failed", v)
+		return
+	}
+
+	// Parse labels
+	var vs []string
+	for _, c := range ls {
+		if v, err = cell(c); err != nil {
+			return
+		}
+		vs = append(vs, v)
+	}
+	o.RawLabel = joinLabels(vs)
+	if o.ExternalID, err = cell(cs["external_id"]); err != nil {
+		return
+	}
+
+	// Parse raw label
+	mapRawLabel(o)
+	return
+}
+
+// parseAmount parses an amount with the separators of the profile
+// Once the decimal separator is known, the other one can only separate thousands. Empty amounts are zero.
+func (i csvImporter) parseAmount(v, currency string) (m Money, err error) {
+	if v = strings.TrimSpace(v); v == "" {
+		m = Money{Currency: currency}
+		return
+	}
+	if i.p.ThousandsSeparator != "" {
+		v = strings.Replace(v, i.p.ThousandsSeparator, "", -1)
+	}
+	switch i.p.DecimalSeparator {
+	case ",":
+		v = strings.Replace(strings.Replace(v, ".", "", -1), ",", ".", -1)
+	case ".":
+		v = strings.Replace(v, ",", "", -1)
+	}
+	return parseMoney(v, currency)
+}
+
+// column resolves a column reference
+// It returns -1 when the column is not set
+func (i csvImporter) column(header [][]string, ref string) (int, error) {
+	// Not set
+	if ref = strings.TrimSpace(ref); ref == "" {
+		return -1, nil
+	}
+
+	// Index
+	if c, err := strconv.Atoi(ref); err == nil {
+		if c < 0 {
+			return 0, fmt.Errorf("%d is not a valid column", c)
+		}
+		return c, nil
+	}
+
+	// Name
+	if len(header) == 0 {
+		return 0, fmt.Errorf("column %s can't be found without header rows", ref)
+	}
+	for c, v := range header[len(header)-1] {
+		if strings.EqualFold(strings.TrimSpace(v), ref) {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("column %s not found", ref)
+}
+
+// value returns the value of a header cell or a fixed value when the cell is not set
+func (i csvImporter) value(header [][]string, c *csvProfileCell, fixed string) (string, error) {
+	if c == nil {
+		return fixed, nil
+	}
+	if c.Row >= len(header) || c.Column >= len(header[c.Row]) {
+		return "", fmt.Errorf("cell %d:%d is out of range", c.Row, c.Column)
+	}
+	return strings.TrimSpace(header[c.Row][c.Column]), nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import "testing"
+
+// testCSVProfile returns a valid CSV profile with named columns
+func testCSVProfile() csvProfile {
+	return csvProfile{
+		Account:    csvProfileAccount{Currency: "EUR"},
+		Columns:    csvProfileColumns{Amount: "Amount", Date: "Date", Label: []string{"Label"}},
+		DateLayout: "02/01/2006",
+		Delimiter:  ";",
+		HeaderRows: 1,
+		Name:       "Bank",
+	}
+}
+
+func TestCSVImporter(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		profile    func(p *csvProfile)
+		statements []testStatement
+	}{
+		{
+			name: "named columns",
+			profile: func(p *csvProfile) {
+				p.Columns.ExternalID = "Ref"
+				p.Columns.Label = []string{"Label", "Details"}
+			},
+			statements: []testStatement{
+				{
+					account: &testAccount{currency: "EUR", id: "Bank", noBalance: true},
+					content: "Ref;Amount;Details;Date;Label\nR1;-10.50;Card;02/01/2018;Shop\nR2;100;;03/01/2018;Salary\n",
+					name:    "default",
+					operations: []testOperation{
+						{amount: -105000, date: "2018-01-02", externalID: "R1", rawLabel: "Shop Card"},
+						{amount: 1000000, date: "2018-01-03", externalID: "R2", rawLabel: "Salary"},
+					},
+				},
+				{
+					content: "Ref;Amount;Date\nR1;-10.50;02/01/2018\n",
+					err:     true,
+					name:    "missing column",
+				},
+			},
+		},
+		{
+			name: "indexed columns",
+			profile: func(p *csvProfile) {
+				p.Columns = csvProfileColumns{Amount: "3", Date: "0", Label: []string{"2", "1"}}
+				p.HeaderRows = 0
+			},
+			statements: []testStatement{
+				{
+					content: "02/01/2018;Card;Shop;-10.50\n03/01/2018;;Salary;100\n",
+					name:    "default",
+					operations: []testOperation{
+						{amount: -105000, date: "2018-01-02", rawLabel: "Shop Card"},
+						{amount: 1000000, date: "2018-01-03", rawLabel: "Salary"},
+					},
+				},
+			},
+		},
+		{
+			name: "header cells",
+			profile: func(p *csvProfile) {
+				p.Account = csvProfileAccount{
+					BalanceCell:  &csvProfileCell{Column: 1, Row: 1},
+					CurrencyCell: &csvProfileCell{Column: 3, Row: 0},
+					IDCell:       &csvProfileCell{Column: 1, Row: 0},
+				}
+				p.HeaderRows = 3
+			},
+			statements: []testStatement{
+				{
+					account: &testAccount{balance: 12345000, currency: "USD", id: "FR123"},
+					content: "Account;FR123;Currency;usd\nBalance;1234.50\nDate;Label;Amount\n02/01/2018;Shop;-10.50\n",
+					name:    "default",
+					operations: []testOperation{
+						{amount: -105000, date: "2018-01-02", rawLabel: "Shop"},
+					},
+				},
+				{
+					content: "Account;FR123\nBalance;1234.50\nDate;Label;Amount\n02/01/2018;Shop;-10.50\n",
+					err:     true,
+					name:    "cell out of range",
+				},
+			},
+		},
+		{
+			name: "newest first with a balance column",
+			profile: func(p *csvProfile) {
+				p.Columns.Balance = "Balance"
+				p.NewestFirst = true
+			},
+			statements: []testStatement{
+				{
+					account: &testAccount{balance: 940000, currency: "EUR", id: "Bank"},
+					content: "Date;Label;Amount;Balance\n03/01/2018;Bakery;-1;94\n03/01/2018;Shop;-5;95\n02/01/2018;Salary;100;100\n",
+					name:    "default",
+					operations: []testOperation{
+						{amount: 1000000, date: "2018-01-02", rawLabel: "Salary"},
+						{amount: -50000, date: "2018-01-03", rawLabel: "Shop"},
+						{amount: -10000, date: "2018-01-03", rawLabel: "Bakery"},
+					},
+				},
+			},
+		},
+		{
+			name: "debit and credit columns",
+			profile: func(p *csvProfile) {
+				p.Columns.Amount = ""
+				p.Columns.Credit = "Credit"
+				p.Columns.Debit = "Debit"
+			},
+			statements: []testStatement{
+				{
+					content: "Date;Label;Debit;Credit\n02/01/2018;Shop;10.50;\n03/01/2018;Refund;;5\n",
+					name:    "without minus sign",
+					operations: []testOperation{
+						{amount: -105000, date: "2018-01-02", rawLabel: "Shop"},
+						{amount: 50000, date: "2018-01-03", rawLabel: "Refund"},
+					},
+				},
+				{
+					content: "Date;Label;Debit;Credit\n02/01/2018;Shop;-10.50;\n03/01/2018;Refund;;5\n",
+					name:    "with minus sign",
+					operations: []testOperation{
+						{amount: -105000, date: "2018-01-02", rawLabel: "Shop"},
+						{amount: 50000, date: "2018-01-03", rawLabel: "Refund"},
+					},
+				},
+			},
+		},
+		{
+			name:    "inverted sign",
+			profile: func(p *csvProfile) { p.Sign = csvSignInverted },
+			statements: []testStatement{
+				{
+					content: "Date;Label;Amount\n02/01/2018;Shop;10.50\n03/01/2018;Payment;-100\n",
+					name:    "default",
+					operations: []testOperation{
+						{amount: -105000, date: "2018-01-02", rawLabel: "Shop"},
+						{amount: 1000000, date: "2018-01-03", rawLabel: "Payment"},
+					},
+				},
+			},
+		},
+		{
+			name: "thousands separator",
+			profile: func(p *csvProfile) {
+				p.DecimalSeparator = ","
+				p.ThousandsSeparator = "."
+			},
+			statements: []testStatement{
+				{
+					content: "Date;Label;Amount\n02/01/2018;Rent;-1.234,56\n03/01/2018;Salary;2.000\n",
+					name:    "default",
+					operations: []testOperation{
+						{amount: -12345600, date: "2018-01-02", rawLabel: "Rent"},
+						{amount: 20000000, date: "2018-01-03", rawLabel: "Salary"},
+					},
+				},
+			},
+		},
+		{
+			name:    "empty decimal separator",
+			profile: func(p *csvProfile) {},
+			statements: []testStatement{
+				{
+					content: "Date;Label;Amount\n02/01/2018;Rent;-1.234,56\n03/01/2018;Salary;2,000.5\n",
+					name:    "default",
+					operations: []testOperation{
+						{amount: -12345600, date: "2018-01-02", rawLabel: "Rent"},
+						{amount: 20005000, date: "2018-01-03", rawLabel: "Salary"},
+					},
+				},
+			},
+		},
+		{
+			name:    "bad rows",
+			profile: func(p *csvProfile) {},
+			statements: []testStatement{
+				{
+					content:    "Date;Label;Amount\n02/01/2018;Shop;-10.50\n2018-01-03;Bad date;1\n04/01/2018;Bad amount;ten\n05/01/2018;Short\n06/01/2018;Salary;100\n",
+					errorLines: []int{3, 4, 5},
+					name:       "default",
+					operations: []testOperation{
+						{amount: -105000, date: "2018-01-02", rawLabel: "Shop"},
+						{amount: 1000000, date: "2018-01-06", rawLabel: "Salary"},
+					},
+				},
+				{
+					content: "",
+					err:     true,
+					name:    "no header row",
+				},
+			},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var p = testCSVProfile()
+			c.profile(&p)
+			testImporter(t, csvImporter{p: p}, c.statements)
+		})
+	}
+}
+
+func TestCSVProfileValidate(t *testing.T) {
+	// Valid
+	if err := testCSVProfile().validate(); err != nil {
+		t.Fatalf("expected profile to be valid, got %v", err)
+	}
+
+	// Invalid
+	for _, c := range []struct {
+		name    string
+		profile func(p *csvProfile)
+	}{
+		{name: "empty name", profile: func(p *csvProfile) { p.Name = " " }},
+		{name: "long delimiter", profile: func(p *csvProfile) { p.Delimiter = ";;" }},
+		{name: "quote delimiter", profile: func(p *csvProfile) { p.Delimiter = `"` }},
+		{name: "negative header rows", profile: func(p *csvProfile) { p.HeaderRows = -1 }},
+		{name: "empty date layout", profile: func(p *csvProfile) { p.DateLayout = "" }},
+		{name: "invalid sign", profile: func(p *csvProfile) { p.Sign = "reversed" }},
+		{name: "invalid decimal separator", profile: func(p *csvProfile) { p.DecimalSeparator = " " }},
+		{name: "same separators", profile: func(p *csvProfile) { p.DecimalSeparator, p.ThousandsSeparator = ",", "," }},
+		{name: "long thousands separator", profile: func(p *csvProfile) { p.ThousandsSeparator = ".." }},
+		{name: "empty date column", profile: func(p *csvProfile) { p.Columns.Date = "" }},
+		{name: "empty label columns", profile: func(p *csvProfile) { p.Columns.Label = nil }},
+		{name: "amount and debit columns", profile: func(p *csvProfile) { p.Columns.Debit = "Debit" }},
+		{name: "no amount column", profile: func(p *csvProfile) { p.Columns.Amount = "" }},
+		{name: "invalid currency", profile: func(p *csvProfile) { p.Account.Currency = "euro" }},
+		{name: "cell out of header rows", profile: func(p *csvProfile) { p.Account.IDCell = &csvProfileCell{Row: 1} }},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var p = testCSVProfile()
+			c.profile(&p)
+			if err := p.validate(); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Vars
+var (
+	lbpSeparator = []byte("\n\n")
+)
+
+// lbpImporter represents the importer of La Banque Postale CSV statements
+// A header made of "key;value" lines is followed by an empty line and by the operations, newest first
+// Files are exported with "\r\n" line endings which are normalized before parsing
+type lbpImporter struct{}
+
+// lbpRow represents a body row along with its line number in the body
+type lbpRow struct {
+	fields []string
+	line   int
+}
+
+// Detect implements the Importer interface
+func (lbpImporter) Detect(b []byte) bool {
+	// Split header from body
+	var items = bytes.Split(b, lbpSeparator)
+	if len(items) == 1 {
+		return false
+	}
+
+	// Read header lines
+	var r = csv.NewReader(bytes.NewReader(items[0]))
+	r.Comma = ';'
+	r.FieldsPerRecord = 2
+	lines, err := r.ReadAll()
+	return err == nil && len(lines) >= 6
+}
+
+// Extensions implements the Importer interface
+func (lbpImporter) Extensions() []string {
+	return []string{".csv"}
+}
+
+// Name implements the Importer interface
+func (lbpImporter) Name() string {
+	return "La Banque Postale CSV"
+}
+
+// Parse implements the Importer interface
+func (lbpImporter) Parse(b []byte) (s bankStatement, err error) {
+	// Split header from body
+	var items = bytes.Split(b, lbpSeparator)
+	if len(items) == 1 {
+		err = fmt.Errorf("no body detected in content %s", b)
+		return
+	}
+
+	// Build header csv reader
+	var hr = csv.NewReader(bytes.NewReader(items[0]))
+	hr.Comma = ';'
+	hr.FieldsPerRecord = 2
+
+	// Read header lines
+	var lines [][]string
+	if lines, err = hr.ReadAll(); err != nil {
+		err = errors.Wrap(err, "reading header lines failed")
+		return
+	}
+	if len(lines) < 6 {
+		err = fmt.Errorf("not enough lines in header %s", items[0])
+		return
+	}
+
+	// Parse account fields
+	var a = newAccount()
+	a.ID = fmt.Sprintf("%s %s", lines[1][1], lines[0][1])
+	a.Currency = parseCurrency(lines[2][1])
+	if s.Balance, err = parseMoney(lines[4][1], a.Currency); err != nil {
+		err = errors.Wrapf(err, "parsing balance %s failed", lines[4][1])
+		return
+	}
+	a.Balance = s.Balance
+	s.Account = a
+
+	// Parse statement date
+	// It falls back on the date of the last operation when it's not valid
+	s.Date, _ = time.Parse("02/01/2006", strings.TrimSpace(lines[3][1]))
+
+	// Loop through body lines
+	// Lines are parsed one by one so that an invalid one doesn't prevent the others from being imported
+	var rows []lbpRow
+	var offset = bytes.Count(items[0], []byte("\n")) + 2
+	var content = strings.Split(string(items[1]), "\n")
+	var br = csv.NewReader(bytes.NewReader(items[1]))
+	br.Comma = ';'
+	br.FieldsPerRecord = -1
+	for {
+		// Read line
+		var l []string
+		var errRead error
+		if l, errRead = br.Read(); errRead == io.EOF {
+			break
+		} else if errRead != nil {
+			var line int
+			if e, ok := errRead.(*csv.ParseError); ok {
+				line = e.StartLine
+			}
+			s.Errors = append(s.Errors, newLineError(content, line, offset, errRead))
+			continue
+		}
+
+		// First line contains column names
+		var line, _ = br.FieldPos(0)
+		if line == 1 {
+			continue
+		}
+		rows = append(rows, lbpRow{fields: l, line: line})
+	}
+
+	// Loop through rows
+	for i := len(rows) - 1; i >= 0; i-- {
+		// Parse row
+		var op *Operation
+		var errParse error
+		if op, errParse = parseLBPRow(rows[i].fields, a.Currency); errParse != nil {
+			s.Errors = append(s.Errors, newLineError(content, rows[i].line, offset, errParse))
+			continue
+		}
+
+		// Update account balance
+		if a.Balance, errParse = a.Balance.Sub(op.Amount); errParse != nil {
+			s.Errors = append(s.Errors, newLineError(content, rows[i].line, offset, errParse))
+			continue
+		}
+
+		// Add operation
+		s.Operations = append(s.Operations, op)
+	}
+
+	// Default statement date
+	if s.Date.IsZero() && len(s.Operations) > 0 {
+		s.Date = s.Operations[len(s.Operations)-1].Date
+	}
+	return
+}
+
+// parseLBPRow parses a body row
+func parseLBPRow(fields []string, currency string) (op *Operation, err error) {
+	// Check fields
+	if len(fields) != 4 {
+		err = fmt.Errorf("%d fields instead of 4", len(fields))
+		return
+	}
+
+	// Parse date
+	op = &Operation{RawLabel: fields[1]}
+	if op.Date, err = time.Parse("02/01/2006", fields[0]); err != nil {
+		err = fmt.Errorf("%s is not a valid date", fields[0])
+		return
+	}
+
+	// Parse amount
+	if op.Amount, err = parseMoney(fields[2], currency); err != nil {
+		err = errors.Wrapf(err, "parsing amount %s failed", fields[2])
+		return
+	}
+	op.OriginalAmount = op.Amount
+
+	// Parse raw label
+	mapRawLabel(op)
+	return
+}
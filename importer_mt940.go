@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Vars
+var (
+	mt940RegexpBalance     = regexp.MustCompile(`^([CD])(\d{6})([A-Z]{3})([\d,]+)$`)
+	mt940RegexpStatement   = regexp.MustCompile(`^(\d{6})(\d{4})?(R?[CD])[A-Z]?([\d,]+)[A-Z][A-Z0-9]{3}([^\n]*?)(?://([^\n]*))?(?:\n(.*))?$`)
+	mt940RegexpTag         = regexp.MustCompile(`^:(\d{2}[A-Z]?):`)
+	mt940TagAccount        = "25"
+	mt940TagClosingBalance = []string{"62F", "62M"}
+	mt940TagInformation    = "86"
+	mt940TagOpeningBalance = []string{"60F", "60M"}
+	mt940TagReference      = "20"
+	mt940TagStatementLine  = "61"
+	mt940NoReference       = "NONREF"
+)
+
+// mt940Importer represents the importer of SWIFT MT940 statements
+// Only the statements of the account of the first statement are imported and the closing balance of each of them
+// is checked against its opening balance plus its movements, unless some of its statement lines are invalid
+type mt940Importer struct{}
+
+// mt940Field represents an MT940 field with its continuation lines
+type mt940Field struct {
+	line  int
+	tag   string
+	value string
+}
+
+// mt940Statement represents a parsed MT940 statement
+type mt940Statement struct {
+	account     string
+	closing     Money
+	closingDate time.Time
+	incomplete  bool
+	opening     Money
+	operations  []*Operation
+	reference   string
+}
+
+// Detect implements the Importer interface
+func (mt940Importer) Detect(b []byte) bool {
+	return bytes.Contains(b, []byte(":20:")) && bytes.Contains(b, []byte(":25:")) &&
+		(bytes.Contains(b, []byte(":60F:")) || bytes.Contains(b, []byte(":60M:")))
+}
+
+// Extensions implements the Importer interface
+func (mt940Importer) Extensions() []string {
+	return []string{".940", ".mt940", ".sta"}
+}
+
+// Name implements the Importer interface
+func (mt940Importer) Name() string {
+	return "MT940"
+}
+
+// Parse implements the Importer interface
+func (mt940Importer) Parse(b []byte) (s bankStatement, err error) {
+	// Parse statements
+	var sts []mt940Statement
+	if sts, s.Errors, err = parseMT940Statements(readMT940Fields(b), strings.Split(string(b), "\n")); err != nil {
+		err = errors.Wrap(err, "parsing statements failed")
+		return
+	}
+	if len(sts) == 0 {
+		err = errors.New("no statement")
+		return
+	}
+
+	// Build account
+	var a = newAccount()
+	a.ID = sts[0].account
+	a.Currency = sts[0].opening.Currency
+	a.Balance = sts[0].opening
+	s.Account = a
+
+	// Loop through statements
+	// Statements are expected in chronological order
+	for _, st := range sts {
+		// Statement of another account
+		if st.account != a.ID {
+			continue
+		}
+
+		// Check currency
+		if st.opening.Currency != a.Currency {
+			err = fmt.Errorf("currency %s of statement %s differs from currency %s of account", st.opening.Currency, st.reference, a.Currency)
+			return
+		}
+
+		// Add operations
+		s.Balance, s.Date = st.closing, st.closingDate
+		s.Operations = append(s.Operations, st.operations...)
+	}
+	return
+}
+
+// readMT940Fields reads MT940 fields
+// SWIFT block headers and trailers are ignored and continuation lines are added to the value of their field
+func readMT940Fields(b []byte) (fs []mt940Field) {
+	for idx, l := range strings.Split(string(b), "\n") {
+		// Clean line
+		l = strings.TrimRight(l, "\r")
+		if i := strings.Index(l, "{4:"); i > -1 {
+			l = l[i+3:]
+		}
+		if strings.TrimSpace(l) == "" || strings.HasPrefix(l, "-}") || strings.TrimSpace(l) == "-" || strings.HasPrefix(l, "{") {
+			continue
+		}
+
+		// New field
+		if m := mt940RegexpTag.FindStringSubmatch(l); m != nil {
+			fs = append(fs, mt940Field{line: idx + 1, tag: m[1], value: l[len(m[0]):]})
+			continue
+		}
+
+		// Continuation line
+		if len(fs) > 0 {
+			fs[len(fs)-1].value += "\n" + l
+		}
+	}
+	return
+}
+
+// parseMT940Statements parses MT940 statements
+// Invalid statement lines are reported as line errors of the content the fields have been read from
+func parseMT940Statements(fs []mt940Field, content []string) (sts []mt940Statement, les []lineError, err error) {
+	// Loop through fields
+	var st *mt940Statement
+	var o *Operation
+	for _, f := range fs {
+		// New statement
+		if f.tag == mt940TagReference {
+			if st != nil {
+				if err = st.check(); err != nil {
+					err = errors.Wrapf(err, "checking statement %s failed", st.reference)
+					return
+				}
+				sts = append(sts, *st)
+			}
+			st, o = &mt940Statement{reference: strings.TrimSpace(f.value)}, nil
+			continue
+		} else if st == nil {
+			continue
+		}
+
+		// Process field
+		switch {
+		case f.tag == mt940TagAccount:
+			st.account = strings.TrimSpace(f.value)
+		case mt940HasTag(mt940TagOpeningBalance, f.tag):
+			if st.opening, _, err = parseMT940Balance(f.value); err != nil {
+				err = errors.Wrapf(err, "parsing opening balance of statement %s failed", st.reference)
+				return
+			}
+		case mt940HasTag(mt940TagClosingBalance, f.tag):
+			if st.closing, st.closingDate, err = parseMT940Balance(f.value); err != nil {
+				err = errors.Wrapf(err, "parsing closing balance of statement %s failed", st.reference)
+				return
+			}
+		case f.tag == mt940TagStatementLine:
+			var errParse error
+			if o, errParse = parseMT940StatementLine(f.value, st.opening.Currency); errParse != nil {
+				les = append(les, newLineError(content, f.line, 0, errParse))
+				st.incomplete, o = true, nil
+				continue
+			}
+			st.operations = append(st.operations, o)
+		case f.tag == mt940TagInformation && o != nil:
+			o.RawLabel = joinMT940Lines(f.value)
+			mapRawLabel(o)
+		}
+
+		// Information only follows the statement line it's about
+		if f.tag != mt940TagStatementLine {
+			o = nil
+		}
+	}
+
+	// Last statement
+	if st != nil {
+		if err = st.check(); err != nil {
+			err = errors.Wrapf(err, "checking statement %s failed", st.reference)
+			return
+		}
+		sts = append(sts, *st)
+	}
+	return
+}
+
+// joinMT940Lines joins back lines that have been wrapped at a fixed width
+// Only line breaks are removed, unless a space is on either side of them in which case a single space is kept
+func joinMT940Lines(s string) string {
+	var ls = strings.Split(strings.TrimSpace(s), "\n")
+	var v = ls[0]
+	for _, l := range ls[1:] {
+		if strings.HasSuffix(v, " ") || strings.HasPrefix(l, " ") {
+			v = strings.TrimRight(v, " ") + " " + strings.TrimLeft(l, " ")
+		} else {
+			v += l
+		}
+	}
+	return v
+}
+
+// mt940HasTag checks whether a tag is one of several tags
+func mt940HasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// check checks that the closing balance of an MT940 statement matches its opening balance plus its movements
+// Balances of incomplete statements can't match and are therefore not checked
+func (st mt940Statement) check() error {
+	// Mandatory fields
+	if st.account == "" {
+		return errors.New("no account")
+	} else if st.opening.Currency == "" {
+		return errors.New("no opening balance")
+	} else if st.closing.Currency == "" {
+		return errors.New("no closing balance")
+	}
+
+	// Balances
+	if st.incomplete {
+		return nil
+	}
+	var e = st.opening
+	for _, o := range st.operations {
+		var err error
+		if e, err = e.Add(o.Amount); err != nil {
+			return errors.Wrap(err, "adding movement to opening balance failed")
+		}
+	}
+	if e.Units != st.closing.Units || e.Currency != st.closing.Currency {
+		return fmt.Errorf("opening balance %s plus movements is %s whereas closing balance is %s", st.opening, e, st.closing)
+	}
+	return nil
+}
+
+// parseMT940Balance parses an MT940 balance such as "C180131EUR1234,56"
+func parseMT940Balance(s string) (m Money, t time.Time, err error) {
+	// Match
+	var ms = mt940RegexpBalance.FindStringSubmatch(strings.TrimSpace(s))
+	if ms == nil {
+		err = fmt.Errorf("%s is not a valid balance", s)
+		return
+	}
+
+	// Parse
+	if t, err = time.Parse("060102", ms[2]); err != nil {
+		err = fmt.Errorf("%s is not a valid date", ms[2])
+		return
+	}
+	if m, err = parseMoney(ms[4], ms[3]); err != nil {
+		err = errors.Wrapf(err, "parsing amount %s failed", ms[4])
+		return
+	}
+	if ms[1] == "D" {
+		m = m.Neg()
+	}
+	return
+}
+
+// parseMT940StatementLine parses an MT940 statement line such as "1801310131D12,50NTRFNONREF//B123"
+// The entry date has no year and is therefore the closest one to the value date. Reversals of credits are debits
+// and reversals of debits are credits. The customer reference may contain slashes and ends at the first "//".
+func parseMT940StatementLine(s, currency string) (o *Operation, err error) {
+	// Match
+	var ms = mt940RegexpStatement.FindStringSubmatch(strings.TrimSpace(s))
+	if ms == nil {
+		err = fmt.Errorf("%s is not a valid statement line", s)
+		return
+	}
+
+	// Parse value date
+	var vd time.Time
+	if vd, err = time.Parse("060102", ms[1]); err != nil {
+		err = fmt.Errorf("%s is not a valid value date", ms[1])
+		return
+	}
+	o = &Operation{
+		Date:      vd,
+		ValueDate: &vd,
+	}
+
+	// Bank reference is the external id unless it's missing
+	if r := strings.TrimSpace(ms[6]); r != mt940NoReference {
+		o.ExternalID = r
+	}
+
+	// Parse entry date
+	if ms[2] != "" {
+		var ed time.Time
+		if ed, err = time.Parse("0102", ms[2]); err != nil {
+			err = fmt.Errorf("%s is not a valid entry date", ms[2])
+			return
+		}
+		o.Date = time.Date(vd.Year(), ed.Month(), ed.Day(), 0, 0, 0, 0, time.UTC)
+		if d := o.Date.Sub(vd); d > 180*24*time.Hour {
+			o.Date = o.Date.AddDate(-1, 0, 0)
+		} else if d < -180*24*time.Hour {
+			o.Date = o.Date.AddDate(1, 0, 0)
+		}
+	}
+
+	// Parse amount
+	if o.Amount, err = parseMoney(ms[4], currency); err != nil {
+		err = errors.Wrapf(err, "parsing amount %s failed", ms[4])
+		return
+	}
+	if ms[3] == "D" || ms[3] == "RC" {
+		o.Amount = o.Amount.Neg()
+	}
+	o.OriginalAmount = o.Amount
+
+	// Default raw label is the reference and the supplementary details since the narrative is optional
+	o.RawLabel = joinLabels([]string{ms[5], ms[7]})
+	mapRawLabel(o)
+	return
+}
@@ -0,0 +1,74 @@
+package main
+
+import "testing"
+
+func TestMT940Importer(t *testing.T) {
+	testImporter(t, mt940Importer{}, []testStatement{
+		{
+			content: "{1:F01BANKFRPPAXXX0000000000}{2:I940BANKFRPPXXXXN}{4:\r\n" +
+				":20:STMT1\r\n" +
+				":25:12345678\r\n" +
+				":28C:1/1\r\n" +
+				":60F:C180101EUR100,00\r\n" +
+				":61:1801020102D10,00NTRFINV/2018/01//B1\r\n" +
+				":86:CARD PAYMENT SHOP\r\n" +
+				"PING CENTER \r\n" +
+				" PARIS\r\n" +
+				":61:1801030103C50,00NTRFNONREF//B2\r\n" +
+				":86:SALARY\r\n" +
+				":61:1801050105D1,00NTRFINV/2018/02\r\n" +
+				":62F:C180131EUR139,00\r\n" +
+				"-}",
+			name: "statement",
+			operations: []testOperation{
+				{amount: -100000, date: "2018-01-02", externalID: "B1", rawLabel: "CARD PAYMENT SHOPPING CENTER PARIS"},
+				{amount: 500000, date: "2018-01-03", externalID: "B2", rawLabel: "SALARY"},
+				{amount: -10000, date: "2018-01-05", rawLabel: "INV/2018/02"},
+			},
+		},
+		{
+			content: ":20:STMT1\n" +
+				":25:12345678\n" +
+				":60F:C180101EUR100,00\n" +
+				":61:1801020102D10,00NTRFNONREF\n" +
+				":86:SHOP\n" +
+				":61:18010XD5,00NTRFNONREF\n" +
+				":86:BAD DATE\n" +
+				":61:1801040104Dten\n" +
+				":62F:C180131EUR0,00\n",
+			errorLines: []int{6, 8},
+			name:       "malformed statement lines",
+			operations: []testOperation{
+				{amount: -100000, date: "2018-01-02", rawLabel: "SHOP"},
+			},
+		},
+		{
+			content: ":20:STMT1\n:25:12345678\n:60F:C180101EUR100,00\n:61:1801020102D10,00NTRFNONREF\n:62F:C180131EUR100,00\n",
+			err:     true,
+			name:    "balances don't add up",
+		},
+		{
+			content: ":20:STMT1\n:25:12345678\n:62F:C180131EUR100,00\n",
+			err:     true,
+			name:    "no opening balance",
+		},
+	})
+}
+
+func TestJoinMT940Lines(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want string
+	}{
+		{in: "SHOP", want: "SHOP"},
+		{in: "SHOP\nPING", want: "SHOPPING"},
+		{in: "CARD \nSHOP", want: "CARD SHOP"},
+		{in: "CARD\n SHOP", want: "CARD SHOP"},
+		{in: "CARD  \n  SHOP", want: "CARD SHOP"},
+		{in: " CARD\nSHOP\n", want: "CARDSHOP"},
+	} {
+		if v := joinMT940Lines(c.in); v != c.want {
+			t.Errorf("joining %q: expected %q, got %q", c.in, c.want, v)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Vars
+var (
+	ofxEntities = strings.NewReplacer("&amp;", "&", "&apos;", "'", "&gt;", ">", "&lt;", "<", "&quot;", `"`)
+)
+
+// ofxAggregates are the elements that have children
+// Other elements are leaves which, in SGML, are neither closed nor necessarily followed by a value
+var ofxAggregates = map[string]bool{
+	"AVAILBAL":           true,
+	"BAL":                true,
+	"BALLIST":            true,
+	"BANKACCTFROM":       true,
+	"BANKACCTTO":         true,
+	"BANKMSGSRSV1":       true,
+	"BANKTRANLIST":       true,
+	"CCACCTFROM":         true,
+	"CCACCTTO":           true,
+	"CCSTMTRS":           true,
+	"CCSTMTTRNRS":        true,
+	"CREDITCARDMSGSRSV1": true,
+	"CURRENCY":           true,
+	"FI":                 true,
+	"LEDGERBAL":          true,
+	"OFX":                true,
+	"ORIGCURRENCY":       true,
+	"PAYEE":              true,
+	"SIGNONMSGSRSV1":     true,
+	"SONRS":              true,
+	"STATUS":             true,
+	"STMTRS":             true,
+	"STMTTRN":            true,
+	"STMTTRNRS":          true,
+}
+
+// ofxImporter represents the importer of OFX and QFX statements
+// Version 1 is SGML where leaf elements are not closed whereas version 2 is XML, both are parsed the same way
+// Only the first statement of the file is imported
+type ofxImporter struct{}
+
+// ofxNode represents an OFX element
+// Aggregates have children whereas leaf elements have a value
+// Line is the line of its opening tag
+type ofxNode struct {
+	children []*ofxNode
+	line     int
+	name     string
+	value    string
+}
+
+// Detect implements the Importer interface
+func (ofxImporter) Detect(b []byte) bool {
+	var u = bytes.ToUpper(b)
+	return bytes.Contains(u, []byte("OFXHEADER")) || bytes.Contains(u, []byte("<OFX>"))
+}
+
+// Extensions implements the Importer interface
+func (ofxImporter) Extensions() []string {
+	return []string{".ofx", ".qfx"}
+}
+
+// Name implements the Importer interface
+func (ofxImporter) Name() string {
+	return "OFX"
+}
+
+// Parse implements the Importer interface
+func (ofxImporter) Parse(b []byte) (s bankStatement, err error) {
+	// Parse elements
+	var root *ofxNode
+	if root, err = parseOFX(b); err != nil {
+		err = errors.Wrap(err, "parsing elements failed")
+		return
+	}
+
+	// Fetch statement
+	// Credit card statements have their own aggregates
+	var accountType string
+	var st, from *ofxNode
+	if st = root.find("STMTRS"); st != nil {
+		if from = st.find("BANKACCTFROM"); from == nil {
+			err = errors.New("no BANKACCTFROM")
+			return
+		}
+		accountType = from.childValue("ACCTTYPE")
+	} else if st = root.find("CCSTMTRS"); st != nil {
+		if from = st.find("CCACCTFROM"); from == nil {
+			err = errors.New("no CCACCTFROM")
+			return
+		}
+		accountType = "CREDITCARD"
+	} else {
+		err = errors.New("no statement")
+		return
+	}
+
+	// Parse account
+	var a = newAccount()
+	if a.ID = strings.TrimSpace(accountType + " " + from.childValue("ACCTID")); from.childValue("ACCTID") == "" {
+		err = errors.New("no ACCTID")
+		return
+	}
+	if a.Currency = strings.ToUpper(st.childValue("CURDEF")); !validCurrency(a.Currency) {
+		err = fmt.Errorf("%s is not a valid currency", st.childValue("CURDEF"))
+		return
+	}
+	s.Account = a
+
+	// Parse ledger balance
+	var lb = st.find("LEDGERBAL")
+	if lb == nil {
+		err = errors.New("no LEDGERBAL")
+		return
+	}
+	if s.Balance, err = parseMoney(lb.childValue("BALAMT"), a.Currency); err != nil {
+		err = errors.Wrapf(err, "parsing balance %s failed", lb.childValue("BALAMT"))
+		return
+	}
+	if s.Date, err = parseOFXDate(lb.childValue("DTASOF")); err != nil {
+		err = errors.Wrap(err, "parsing balance date failed")
+		return
+	}
+
+	// Loop through transactions
+	// An invalid transaction is reported on the line of its opening tag
+	a.Balance = s.Balance
+	var content = strings.Split(string(b), "\n")
+	for _, n := range st.findAll("STMTTRN") {
+		// Parse transaction
+		var o *Operation
+		var errParse error
+		if o, errParse = parseOFXTransaction(n, a.Currency); errParse != nil {
+			s.Errors = append(s.Errors, newLineError(content, n.line, 0, errParse))
+			continue
+		}
+
+		// Update account balance
+		if a.Balance, errParse = a.Balance.Sub(o.Amount); errParse != nil {
+			s.Errors = append(s.Errors, newLineError(content, n.line, 0, errParse))
+			continue
+		}
+
+		// Add operation
+		s.Operations = append(s.Operations, o)
+	}
+
+	// Transactions are not necessarily sorted
+	sort.SliceStable(s.Operations, func(i, j int) bool { return s.Operations[i].Date.Before(s.Operations[j].Date) })
+	return
+}
+
+// parseOFXTransaction parses a STMTTRN aggregate
+// When the transaction has a CURRENCY aggregate its amount is in that currency, when it has an ORIGCURRENCY aggregate
+// its amount has been converted from that currency, and in both cases CURRATE is the rate from that currency to the
+// account currency
+func parseOFXTransaction(n *ofxNode, currency string) (o *Operation, err error) {
+	// Init
+	o = &Operation{
+		ExternalID: n.childValue("FITID"),
+		RawLabel:   strings.TrimSpace(n.childValue("NAME") + " " + n.childValue("MEMO")),
+	}
+
+	// Parse date
+	if o.Date, err = parseOFXDate(n.childValue("DTPOSTED")); err != nil {
+		err = errors.Wrap(err, "parsing date failed")
+		return
+	}
+
+	// Parse amount
+	var c, rate = currency, big.NewRat(1, 1)
+	var cn = n.child("CURRENCY")
+	if cn == nil {
+		cn = n.child("ORIGCURRENCY")
+	}
+	if cn != nil {
+		if c = strings.ToUpper(cn.childValue("CURSYM")); !validCurrency(c) {
+			err = fmt.Errorf("%s is not a valid currency", cn.childValue("CURSYM"))
+			return
+		}
+		var ok bool
+		if rate, ok = new(big.Rat).SetString(cn.childValue("CURRATE")); !ok || rate.Sign() <= 0 {
+			err = fmt.Errorf("%s is not a valid rate", cn.childValue("CURRATE"))
+			return
+		}
+	}
+	var amount Money
+	if amount, err = parseMoney(n.childValue("TRNAMT"), currency); err != nil {
+		err = errors.Wrapf(err, "parsing amount %s failed", n.childValue("TRNAMT"))
+		return
+	}
+
+	// Convert amount
+	switch {
+	case cn == nil:
+		o.Amount, o.OriginalAmount = amount, amount
+	case cn.name == "CURRENCY":
+		o.OriginalAmount = Money{Currency: c, Units: amount.Units}
+		if o.Amount, err = o.OriginalAmount.mulRat(rate, currency); err != nil {
+			err = errors.Wrap(err, "converting amount failed")
+			return
+		}
+	default:
+		o.Amount = amount
+		if o.OriginalAmount, err = amount.mulRat(new(big.Rat).Inv(rate), c); err != nil {
+			err = errors.Wrap(err, "converting original amount failed")
+			return
+		}
+	}
+
+	// Parse raw label
+	mapRawLabel(o)
+	return
+}
+
+// parseOFXDate parses an OFX date such as "20180131", "20180131120000" or "20180131120000.000[-5:EST]"
+// Only the day is kept, like for other formats
+func parseOFXDate(s string) (t time.Time, err error) {
+	if s = strings.TrimSpace(s); len(s) < 8 {
+		err = fmt.Errorf("%s is not a valid date", s)
+		return
+	}
+	if t, err = time.Parse("20060102", s[:8]); err != nil {
+		err = fmt.Errorf("%s is not a valid date", s)
+		return
+	}
+	return
+}
+
+// parseOFX parses OFX elements
+// Header, processing instructions and comments are skipped and leaf elements may or may not be closed, and may or may
+// not have a value
+func parseOFX(b []byte) (root *ofxNode, err error) {
+	// Skip header
+	var s = string(b)
+	var idx = strings.Index(strings.ToUpper(s), "<OFX>")
+	if idx < 0 {
+		err = errors.New("no OFX element")
+		return
+	}
+	var line = strings.Count(s[:idx], "\n") + 1
+	s = s[idx:]
+
+	// Loop through tags
+	root = &ofxNode{}
+	var stack = []*ofxNode{root}
+	for {
+		// Find next tag
+		var start = strings.IndexByte(s, '<')
+		if start < 0 {
+			break
+		}
+
+		// Text before a tag is the value of the last opened element which is therefore a leaf
+		// Leaf elements are closed right away since they're not necessarily closed in SGML
+		var v = strings.TrimSpace(s[:start])
+		if v != "" && len(stack) > 1 {
+			stack[len(stack)-1].value = ofxEntities.Replace(v)
+			stack = stack[:len(stack)-1]
+		}
+
+		// Parse tag
+		var end = strings.IndexByte(s[start:], '>')
+		if end < 0 {
+			err = errors.New("tag is not closed")
+			return
+		}
+		var tag = strings.TrimSpace(s[start+1 : start+end])
+		line += strings.Count(s[:start], "\n")
+		var tagLine = line
+		line += strings.Count(s[start:start+end+1], "\n")
+		s = s[start+end+1:]
+
+		// Process tag
+		switch {
+		case strings.HasPrefix(tag, "?"), strings.HasPrefix(tag, "!"):
+			continue
+		case strings.HasPrefix(tag, "/"):
+			// Closing tags of leaf elements don't match any opened element and are ignored
+			var name = strings.ToUpper(strings.TrimSpace(tag[1:]))
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].name == name {
+					stack = stack[:i]
+					break
+				}
+			}
+		default:
+			// An element directly followed by another one is an empty leaf unless it's an aggregate
+			if v == "" && len(stack) > 1 && !ofxAggregates[stack[len(stack)-1].name] {
+				stack = stack[:len(stack)-1]
+			}
+
+			// Open element
+			var n = &ofxNode{line: tagLine, name: strings.ToUpper(strings.TrimSuffix(tag, "/"))}
+			stack[len(stack)-1].children = append(stack[len(stack)-1].children, n)
+			if !strings.HasSuffix(tag, "/") {
+				stack = append(stack, n)
+			}
+		}
+	}
+	return
+}
+
+// child returns the first child with a specific name
+func (n *ofxNode) child(name string) *ofxNode {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// childValue returns the value of the first child with a specific name
+func (n *ofxNode) childValue(name string) string {
+	if c := n.child(name); c != nil {
+		return c.value
+	}
+	return ""
+}
+
+// find returns the first descendant with a specific name
+func (n *ofxNode) find(name string) *ofxNode {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+		if d := c.find(name); d != nil {
+			return d
+		}
+	}
+	return nil
+}
+
+// findAll returns the descendants with a specific name
+func (n *ofxNode) findAll(name string) (ns []*ofxNode) {
+	for _, c := range n.children {
+		if c.name == name {
+			ns = append(ns, c)
+			continue
+		}
+		ns = append(ns, c.findAll(name)...)
+	}
+	return
+}
@@ -0,0 +1,100 @@
+package main
+
+import "testing"
+
+func TestOFXImporter(t *testing.T) {
+	testImporter(t, ofxImporter{}, []testStatement{
+		{
+			content: `OFXHEADER:100
+DATA:OFXSGML
+
+<OFX>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>EUR
+<BANKACCTFROM><BANKID>1<ACCTID>123<ACCTTYPE>CHECKING</BANKACCTFROM>
+<BANKTRANLIST>
+<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20180102<TRNAMT>-10.50<FITID>A1<NAME>Shop &amp; Co<MEMO>Card</STMTTRN>
+<STMTTRN><TRNTYPE>CREDIT<DTPOSTED>20180103120000.000[-5:EST]<TRNAMT>100<FITID>A2<NAME>Salary</STMTTRN>
+</BANKTRANLIST>
+<LEDGERBAL><BALAMT>89.50<DTASOF>20180131</LEDGERBAL>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>`,
+			name: "sgml",
+			operations: []testOperation{
+				{amount: -105000, date: "2018-01-02", externalID: "A1", rawLabel: "Shop & Co Card"},
+				{amount: 1000000, date: "2018-01-03", externalID: "A2", rawLabel: "Salary"},
+			},
+		},
+		{
+			content: `OFXHEADER:100
+
+<OFX>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>EUR
+<BANKACCTFROM><BANKID><ACCTID>123<ACCTTYPE>CHECKING</BANKACCTFROM>
+<BANKTRANLIST>
+<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20180102<TRNAMT>-10<MEMO><FITID>ABC<NAME>Shop</STMTTRN>
+<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20180103<TRNAMT>-5<CHECKNUM><FITID>DEF<NAME>Bakery<MEMO></STMTTRN>
+</BANKTRANLIST>
+<LEDGERBAL><BALAMT>0<DTASOF>20180131</LEDGERBAL>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>`,
+			name: "sgml with empty leaves",
+			operations: []testOperation{
+				{amount: -100000, date: "2018-01-02", externalID: "ABC", rawLabel: "Shop"},
+				{amount: -50000, date: "2018-01-03", externalID: "DEF", rawLabel: "Bakery"},
+			},
+		},
+		{
+			content: `<?xml version="1.0"?>
+<?OFX OFXHEADER="200" VERSION="220"?>
+<OFX>
+ <CREDITCARDMSGSRSV1><CCSTMTTRNRS><CCSTMTRS>
+  <CURDEF>USD</CURDEF>
+  <CCACCTFROM><ACCTID>9</ACCTID></CCACCTFROM>
+  <BANKTRANLIST>
+   <STMTTRN><DTPOSTED>20180102</DTPOSTED><TRNAMT>5</TRNAMT><FITID>F1</FITID><NAME>Refund</NAME><MEMO/></STMTTRN>
+   <STMTTRN><DTPOSTED>20180103</DTPOSTED><TRNAMT>-2.5</TRNAMT><MEMO></MEMO><FITID>F2</FITID><NAME>Coffee</NAME></STMTTRN>
+  </BANKTRANLIST>
+  <LEDGERBAL><BALAMT>-1</BALAMT><DTASOF>20180131</DTASOF></LEDGERBAL>
+ </CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1>
+</OFX>`,
+			name: "xml",
+			operations: []testOperation{
+				{amount: 50000, date: "2018-01-02", externalID: "F1", rawLabel: "Refund"},
+				{amount: -25000, date: "2018-01-03", externalID: "F2", rawLabel: "Coffee"},
+			},
+		},
+		{
+			content: `OFXHEADER:100
+
+<OFX>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>EUR
+<BANKACCTFROM><ACCTID>123<ACCTTYPE>CHECKING</BANKACCTFROM>
+<BANKTRANLIST>
+<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20180102<TRNAMT>-10<FITID>A1<NAME>Shop</STMTTRN>
+<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20180103<TRNAMT>ten<FITID>A2<NAME>Bad amount</STMTTRN>
+<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>2018<TRNAMT>-1<FITID>A3<NAME>Bad date</STMTTRN>
+</BANKTRANLIST>
+<LEDGERBAL><BALAMT>0<DTASOF>20180131</LEDGERBAL>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>`,
+			errorLines: []int{9, 10},
+			name:       "malformed transactions",
+			operations: []testOperation{
+				{amount: -100000, date: "2018-01-02", externalID: "A1", rawLabel: "Shop"},
+			},
+		},
+		{
+			content: "OFXHEADER:100\n\n<OFX><BANKMSGSRSV1></BANKMSGSRSV1></OFX>",
+			err:     true,
+			name:    "no statement",
+		},
+		{
+			content: "OFXHEADER:100\n\nno element",
+			err:     true,
+			name:    "no ofx element",
+		},
+	})
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Vars
+var (
+	qifSections = map[string]bool{
+		"BANK":  true,
+		"CASH":  true,
+		"CCARD": true,
+	}
+)
+
+// Mapping QIF category --> category
+// Keys are lower cased and categories matching one of ours by name don't need to be listed
+var mappingQIFCategoryToCategory = map[string]string{
+	"bank charges":  categoryBank,
+	"charity":       categoryGift,
+	"clothing":      categoryClothes,
+	"dining":        categoryFood,
+	"entertainment": categoryPleasure,
+	"gifts":         categoryGift,
+	"groceries":     categoryFood,
+	"healthcare":    categoryHealth,
+	"insurance":     categoryAmenities,
+	"interest exp":  categoryBank,
+	"leisure":       categoryPleasure,
+	"medical":       categoryHealth,
+	"mortgage":      categoryLoan,
+	"recreation":    categoryPleasure,
+	"salary":        categoryWork,
+	"tax":           categoryTaxes,
+	"utilities":     categoryAmenities,
+	"vacation":      categoryPleasure,
+	"wages":         categoryWork,
+}
+
+// qifImporter represents the importer of QIF statements
+// Only the transactions of the first Bank, CCard or Cash section are imported and since QIF doesn't state any
+// balance, the statement has none. The account is the one named by the "!Account" header, if any.
+type qifImporter struct{}
+
+// qifTransaction represents a QIF transaction
+type qifTransaction struct {
+	amount   string
+	category string
+	date     string
+	line     int
+	memo     string
+	payee    string
+	splits   []qifSplit
+}
+
+// qifSplit represents a split line of a QIF transaction
+type qifSplit struct {
+	amount   string
+	category string
+	memo     string
+}
+
+// Detect implements the Importer interface
+func (qifImporter) Detect(b []byte) bool {
+	var l = bytes.ToUpper(bytes.TrimSpace(bytes.TrimPrefix(b, []byte("\xef\xbb\xbf"))))
+	return bytes.HasPrefix(l, []byte("!TYPE:")) || bytes.HasPrefix(l, []byte("!ACCOUNT")) || bytes.HasPrefix(l, []byte("!OPTION:"))
+}
+
+// Extensions implements the Importer interface
+func (qifImporter) Extensions() []string {
+	return []string{".qif"}
+}
+
+// Name implements the Importer interface
+func (qifImporter) Name() string {
+	return "QIF"
+}
+
+// Parse implements the Importer interface
+func (qifImporter) Parse(b []byte) (s bankStatement, err error) {
+	// Read transactions
+	var name string
+	var ts []qifTransaction
+	if name, ts, err = readQIF(b); err != nil {
+		err = errors.Wrap(err, "reading transactions failed")
+		return
+	}
+
+	// Build account
+	// Without "!Account" header, the account is named after the file by parseBankStatement
+	var a = newAccount()
+	a.ID = name
+	a.Currency = currencyDefault
+	a.Balance = Money{Currency: a.Currency}
+	s.Account = a
+	s.Balance, s.NoBalance = a.Balance, true
+
+	// Days and months are in an order that depends on the program that has exported the file
+	var dayFirst = qifDayFirst(ts)
+
+	// Loop through transactions
+	// An invalid transaction is reported on its first line and doesn't prevent the others from being imported
+	var content = strings.Split(string(b), "\n")
+	for _, t := range ts {
+		// Parse date
+		var d time.Time
+		var errParse error
+		if t.date == "" {
+			s.Errors = append(s.Errors, newLineError(content, t.line, 0, errors.New("no date")))
+			continue
+		} else if d, errParse = parseQIFDate(t.date, dayFirst); errParse != nil {
+			s.Errors = append(s.Errors, newLineError(content, t.line, 0, errParse))
+			continue
+		}
+
+		// Parse operations
+		var ops []*Operation
+		if ops, errParse = parseQIFTransaction(t, d, a.Currency); errParse != nil {
+			s.Errors = append(s.Errors, newLineError(content, t.line, 0, errParse))
+			continue
+		}
+		s.Operations = append(s.Operations, ops...)
+	}
+
+	// Transactions are not necessarily sorted
+	sort.SliceStable(s.Operations, func(i, j int) bool { return s.Operations[i].Date.Before(s.Operations[j].Date) })
+	if len(s.Operations) > 0 {
+		s.Date = s.Operations[len(s.Operations)-1].Date
+	}
+	return
+}
+
+// readQIF reads the transactions of the first supported section along with the name of its account
+// A transaction that is not terminated by "^" ends at the next header or at the end of the file
+func readQIF(b []byte) (name string, ts []qifTransaction, err error) {
+	// Flush adds the transaction being read, if any
+	var t qifTransaction
+	var flush = func() {
+		if t.line > 0 {
+			ts = append(ts, t)
+		}
+		t = qifTransaction{}
+	}
+
+	// Loop through lines
+	var inAccount, inSection bool
+	var section string
+	for idx, l := range strings.Split(strings.TrimPrefix(string(b), "\xef\xbb\xbf"), "\n") {
+		// Empty line
+		if l = strings.TrimRight(l, "\r"); strings.TrimSpace(l) == "" {
+			continue
+		}
+
+		// Header
+		if strings.HasPrefix(l, "!") {
+			if inSection {
+				flush()
+			}
+			var h = strings.ToUpper(strings.TrimSpace(l))
+			switch {
+			case h == "!ACCOUNT":
+				// A new account after the first supported section has been read
+				if len(ts) > 0 {
+					return
+				}
+				inAccount, inSection = true, false
+			case strings.HasPrefix(h, "!TYPE:"):
+				// A new section after the first supported section has been read
+				var v = strings.TrimSpace(l[6:])
+				if qifSections[strings.ToUpper(v)] && len(ts) > 0 {
+					return
+				}
+				if inAccount, inSection = false, qifSections[strings.ToUpper(v)]; inSection {
+					section = v
+				}
+			}
+			continue
+		}
+
+		// Account
+		if inAccount {
+			if l[0] == 'N' {
+				name = strings.TrimSpace(l[1:])
+			} else if l[0] == '^' {
+				inAccount = false
+			}
+			continue
+		}
+
+		// Unsupported section
+		if !inSection {
+			continue
+		}
+
+		// Transactions start at their first field
+		if t.line == 0 && l[0] != '^' {
+			t.line = idx + 1
+		}
+
+		// Parse field
+		var v = strings.TrimSpace(l[1:])
+		switch l[0] {
+		case 'D':
+			t.date = v
+		case 'T', 'U':
+			if t.amount == "" || l[0] == 'T' {
+				t.amount = v
+			}
+		case 'P':
+			t.payee = v
+		case 'M':
+			t.memo = v
+		case 'L':
+			t.category = v
+		case 'S':
+			t.splits = append(t.splits, qifSplit{category: v})
+		case 'E':
+			if len(t.splits) > 0 {
+				t.splits[len(t.splits)-1].memo = v
+			}
+		case '$':
+			if len(t.splits) > 0 {
+				t.splits[len(t.splits)-1].amount = v
+			}
+		case '^':
+			flush()
+		}
+	}
+	if inSection {
+		flush()
+	}
+
+	// No supported section
+	if section == "" {
+		err = errors.New("no Bank, CCard or Cash section")
+		return
+	}
+	return
+}
+
+// parseQIFTransaction parses a QIF transaction
+// Split transactions are turned into one operation per split line so that each of them has its own category. If the
+// split lines don't add up to the amount of the transaction, the remainder is an operation of its own.
+func parseQIFTransaction(t qifTransaction, d time.Time, currency string) (ops []*Operation, err error) {
+	// Parse amount
+	var amount Money
+	if t.amount == "" && len(t.splits) == 0 {
+		err = errors.New("no amount")
+		return
+	} else if t.amount != "" {
+		if amount, err = parseMoney(t.amount, currency); err != nil {
+			err = errors.Wrapf(err, "parsing amount %s failed", t.amount)
+			return
+		}
+	}
+
+	// Loop through split lines
+	var total = Money{Currency: currency}
+	for _, sp := range t.splits {
+		// Parse amount
+		var o = newQIFOperation(d, t.payee, sp.memo, sp.category)
+		if o.Amount, err = parseMoney(sp.amount, currency); err != nil {
+			err = errors.Wrapf(err, "parsing split amount %s failed", sp.amount)
+			return
+		}
+		o.OriginalAmount = o.Amount
+		if total, err = total.Add(o.Amount); err != nil {
+			err = errors.Wrapf(err, "adding split amount %s failed", sp.amount)
+			return
+		}
+		ops = append(ops, o)
+	}
+
+	// Remainder
+	var r Money
+	if r, err = amount.Sub(total); err != nil {
+		err = errors.Wrap(err, "subtracting split amounts failed")
+		return
+	}
+	if len(ops) == 0 || (t.amount != "" && !r.IsZero()) {
+		var o = newQIFOperation(d, t.payee, t.memo, t.category)
+		o.Amount, o.OriginalAmount = r, r
+		ops = append(ops, o)
+	}
+	return
+}
+
+// newQIFOperation creates a new operation out of QIF fields
+func newQIFOperation(d time.Time, payee, memo, category string) (o *Operation) {
+	o = &Operation{
+		Date:     d,
+		RawLabel: strings.TrimSpace(payee + " " + memo),
+	}
+	mapRawLabel(o)
+	if category != "" {
+		o.Category = parseQIFCategory(category)
+	}
+	return
+}
+
+// parseQIFCategory parses a QIF category such as "Food:Groceries/Class"
+// Transfers to other accounts, written "[Account]", and categories we don't know of are unknown
+func parseQIFCategory(s string) string {
+	// Remove class
+	if i := strings.Index(s, "/"); i > -1 {
+		s = s[:i]
+	}
+
+	// Transfer
+	if strings.HasPrefix(s, "[") {
+		return categoryUnknown
+	}
+
+	// Try the full category first and then each of its parts
+	for _, c := range append([]string{s}, strings.Split(s, ":")...) {
+		c = strings.TrimSpace(c)
+		for _, v := range categories {
+			if strings.EqualFold(v, c) {
+				return v
+			}
+		}
+		if v, ok := mappingQIFCategoryToCategory[strings.ToLower(c)]; ok {
+			return v
+		}
+	}
+	return categoryUnknown
+}
+
+// qifDayFirst checks whether QIF dates are written day first
+// Dates are written month first unless one of them can't be
+func qifDayFirst(ts []qifTransaction) bool {
+	for _, t := range ts {
+		var ps = splitQIFDate(t.date)
+		if len(ps) != 3 || len(ps[0]) == 4 {
+			continue
+		}
+		if v, err := strconv.Atoi(ps[0]); err == nil && v > 12 {
+			return true
+		}
+	}
+	return false
+}
+
+// splitQIFDate splits a QIF date into its parts
+func splitQIFDate(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		switch r {
+		case '/', '-', '.', '\'', ' ':
+			return true
+		}
+		return false
+	})
+}
+
+// parseQIFDate parses a QIF date such as "1/31/2018", "01/31/18", "1/31'18", "31/01/2018", "31.01.2018" or "2018-01-31"
+// Two digit years are in the 2000s when they follow an apostrophe or are lower than 70
+func parseQIFDate(s string, dayFirst bool) (t time.Time, err error) {
+	// Split
+	var ps = splitQIFDate(s)
+	if len(ps) != 3 {
+		err = fmt.Errorf("%s is not a valid date", s)
+		return
+	}
+
+	// Parse parts
+	var vs [3]int
+	for i, p := range ps {
+		if vs[i], err = strconv.Atoi(p); err != nil {
+			err = fmt.Errorf("%s is not a valid date", s)
+			return
+		}
+	}
+
+	// Order parts
+	var year, month, day int
+	switch {
+	case len(ps[0]) == 4:
+		year, month, day = vs[0], vs[1], vs[2]
+	case dayFirst:
+		day, month, year = vs[0], vs[1], vs[2]
+	default:
+		month, day, year = vs[0], vs[1], vs[2]
+	}
+
+	// Two digit year
+	if len(ps[2]) <= 2 && len(ps[0]) != 4 {
+		if strings.Contains(s, "'") || year < 70 {
+			year += 2000
+		} else {
+			year += 1900
+		}
+	}
+
+	// Validate
+	if t = time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC); t.Day() != day || int(t.Month()) != month {
+		err = fmt.Errorf("%s is not a valid date", s)
+		return
+	}
+	return
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestQIFImporter(t *testing.T) {
+	testImporter(t, qifImporter{}, []testStatement{
+		{
+			content: "!Type:Bank\nD01/02/2018\nT-10.50\nPShop\nMCard\n^\nD01/03'18\nT1,000.00\nPSalary\n^\n",
+			name:    "bank",
+			operations: []testOperation{
+				{amount: -105000, date: "2018-01-02", rawLabel: "Shop Card"},
+				{amount: 10000000, date: "2018-01-03", rawLabel: "Salary"},
+			},
+		},
+		{
+			content: "!Type:CCard\r\nD31/01/2018\r\nT-5\r\nPBakery\r\n^\r\nD15.01.2018\r\nT-2\r\nPCoffee\r\n^\r\n",
+			name:    "day first",
+			operations: []testOperation{
+				{amount: -20000, date: "2018-01-15", rawLabel: "Coffee"},
+				{amount: -50000, date: "2018-01-31", rawLabel: "Bakery"},
+			},
+		},
+		{
+			content: "!Type:Bank\nD01/02/2018\nT-30\nPShop\nSFood\n$-20\nSClothing\nEShirt\n$-5\n^\n",
+			name:    "split",
+			operations: []testOperation{
+				{amount: -200000, date: "2018-01-02", rawLabel: "Shop"},
+				{amount: -50000, date: "2018-01-02", rawLabel: "Shop Shirt"},
+				{amount: -50000, date: "2018-01-02", rawLabel: "Shop"},
+			},
+		},
+		{
+			content:    "!Type:Bank\nD01/02/2018\nPShop\n^\nD02/30/2018\nT-1\n^\nT-2\nPNo date\n^\nD01/03/2018\nTten\n^\nD01/04/2018\nT-3\nPBakery\n^\n",
+			errorLines: []int{2, 5, 8, 11},
+			name:       "malformed transactions",
+			operations: []testOperation{
+				{amount: -30000, date: "2018-01-04", rawLabel: "Bakery"},
+			},
+		},
+		{
+			content: "!Type:Bank\nD01/02/2018\nT-10.50\nPShop\n^\nD01/03/2018\nT-2\nPCoffee",
+			name:    "unterminated last transaction",
+			operations: []testOperation{
+				{amount: -105000, date: "2018-01-02", rawLabel: "Shop"},
+				{amount: -20000, date: "2018-01-03", rawLabel: "Coffee"},
+			},
+		},
+		{
+			account: &testAccount{currency: currencyDefault, id: "Checking", noBalance: true},
+			content: "!Account\nNChecking\nTBank\n^\n!Type:Bank\nD01/02/2018\nT-10.50\nPShop\n!Account\nNSavings\nTBank\n^\n!Type:Bank\nD01/03/2018\nT-2\nPCoffee\n^\n",
+			name:    "named accounts",
+			operations: []testOperation{
+				{amount: -105000, date: "2018-01-02", rawLabel: "Shop"},
+			},
+		},
+		{
+			content: "!Type:Invst\nD01/02/2018\nT-1\n^\n",
+			err:     true,
+			name:    "no supported section",
+		},
+	})
+}
+
+func TestParseBankStatementQIFAccount(t *testing.T) {
+	for _, c := range []struct {
+		content string
+		id      string
+		name    string
+	}{
+		{
+			content: "!Account\nNChecking\nTBank\n^\n!Type:Bank\nD01/02/2018\nT-1\n^\n",
+			id:      "Checking",
+			name:    "named account",
+		},
+		{
+			content: "!Type:Bank\nD01/02/2018\nT-1\n^\n",
+			id:      "savings 2018",
+			name:    "unnamed account",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			// Write
+			var p = filepath.Join(t.TempDir(), "savings 2018.qif")
+			if err := ioutil.WriteFile(p, []byte(c.content), 0600); err != nil {
+				t.Fatalf("writing %s failed: %v", p, err)
+			}
+
+			// Parse
+			s, err := parseBankStatement([]Importer{qifImporter{}}, p)
+			if err != nil {
+				t.Fatalf("parsing failed: %v", err)
+			} else if s.Account.ID != c.id {
+				t.Fatalf("expected account %s, got %s", c.id, s.Account.ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import "testing"
+
+// testAccount represents the account of a statement and its balance checked by tests
+// Balance is in units of the statement currency
+type testAccount struct {
+	balance   int64
+	currency  string
+	id        string
+	noBalance bool
+}
+
+// testOperation represents the fields of an imported operation checked by tests
+// Amount is in units of the statement currency
+type testOperation struct {
+	amount     int64
+	date       string
+	externalID string
+	rawLabel   string
+}
+
+// testStatement represents a statement to parse and what's expected from it
+// The account is only checked when set
+type testStatement struct {
+	account    *testAccount
+	content    string
+	err        bool
+	errorLines []int
+	name       string
+	operations []testOperation
+}
+
+// testImporter parses statements with an importer and checks their operations and line errors
+func testImporter(t *testing.T, i Importer, ss []testStatement) {
+	for _, s := range ss {
+		t.Run(s.name, func(t *testing.T) {
+			// Parse
+			st, err := i.Parse([]byte(s.content))
+			if s.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("parsing failed: %v", err)
+			}
+
+			// Check account
+			if a := s.account; a != nil {
+				if st.Account.ID != a.id || st.Account.Currency != a.currency {
+					t.Errorf("expected account %s in %s, got account %s in %s", a.id, a.currency, st.Account.ID, st.Account.Currency)
+				}
+				if st.NoBalance != a.noBalance || st.Balance.Units != a.balance || st.Balance.Currency != a.currency {
+					t.Errorf("expected balance %d %s units, got %d %s units", a.balance, a.currency, st.Balance.Units, st.Balance.Currency)
+				}
+			}
+
+			// Check operations
+			if len(st.Operations) != len(s.operations) {
+				t.Fatalf("expected %d operation(s), got %d", len(s.operations), len(st.Operations))
+			}
+			for idx, e := range s.operations {
+				var o = st.Operations[idx]
+				if o.Amount.Units != e.amount || o.Date.Format("2006-01-02") != e.date || o.ExternalID != e.externalID || o.RawLabel != e.rawLabel {
+					t.Errorf("operation #%d: expected %+v, got amount %d, date %s, external id %q and raw label %q", idx+1, e, o.Amount.Units, o.Date.Format("2006-01-02"), o.ExternalID, o.RawLabel)
+				}
+			}
+
+			// Check line errors
+			if len(st.Errors) != len(s.errorLines) {
+				t.Fatalf("expected %d line error(s), got %+v", len(s.errorLines), st.Errors)
+			}
+			for idx, l := range s.errorLines {
+				if st.Errors[idx].Line != l {
+					t.Errorf("line error #%d: expected line %d, got %+v", idx+1, l, st.Errors[idx])
+				}
+			}
+		})
+	}
+}
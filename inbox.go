@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Inbox
+// Imported operations wait in the inbox of their account until they're reviewed so that a statement can be reviewed
+// over several sessions
+const (
+	metadataKeyInboxPrefix = "inbox."
+)
+
+// inbox represents the imported operations of an account waiting to be reviewed
+// Account is set until the account is created, which happens with the first operation that is accepted. Points are
+// the reconciliation points of the imported statements which are recorded once every operation has been reviewed.
+type inbox struct {
+	Account    *Account              `json:"account,omitempty"`
+	Operations []inboxOperation      `json:"operations"`
+	Points     []reconciliationPoint `json:"points,omitempty"`
+}
+
+// inboxOperation represents an imported operation waiting to be reviewed
+// Batch is the import the operation comes from
+type inboxOperation struct {
+	Batch     string     `json:"batch"`
+	Operation *Operation `json:"operation"`
+}
+
+// inboxStatement represents the operations of an imported statement to add to the inbox of its account
+// Point is the reconciliation point of the statement when it has a balance
+type inboxStatement struct {
+	account    *Account
+	operations []*Operation
+	point      *reconciliationPoint
+}
+
+// inboxReview represents the review of operations of the inbox of an account
+// Operations are identified by their fingerprint and only the subject, category and label of the accepted ones are
+// taken into account. All accepts every operation as it is.
+type inboxReview struct {
+	AccountID string
+	Accepted  []*Operation
+	All       bool
+	Skipped   []string
+}
+
+// inboxMetadataKey returns the metadata key of the inbox of an account
+func inboxMetadataKey(accountID string) string {
+	return metadataKeyInboxPrefix + accountID
+}
+
+// empty checks whether an inbox has nothing left to commit
+func (i inbox) empty() bool {
+	return len(i.Operations) == 0 && i.Account == nil && len(i.Points) == 0
+}
+
+// index returns the position of the operation with a specific fingerprint
+func (i inbox) index(fingerprint string) int {
+	for idx, o := range i.Operations {
+		if o.Operation.Fingerprint == fingerprint {
+			return idx
+		}
+	}
+	return -1
+}
+
+// Inbox returns the inbox of an account
+func (d *Data) Inbox(accountID string) (inbox, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.inbox(accountID)
+}
+
+// Inboxes returns the inboxes that are not empty indexed by account id
+func (d *Data) Inboxes() (is map[string]inbox, err error) {
+	// Lock
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// Loop through metadata
+	is = make(map[string]inbox)
+	for k := range d.metadata {
+		// Not an inbox
+		if !strings.HasPrefix(k, metadataKeyInboxPrefix) {
+			continue
+		}
+
+		// Fetch inbox
+		var id = strings.TrimPrefix(k, metadataKeyInboxPrefix)
+		var i inbox
+		if i, err = d.inbox(id); err != nil {
+			err = errors.Wrapf(err, "fetching inbox of account %s failed", id)
+			return
+		}
+		if !i.empty() {
+			is[id] = i
+		}
+	}
+	return
+}
+
+// inbox returns the inbox of an account
+// Data must be locked
+func (d *Data) inbox(accountID string) (i inbox, err error) {
+	// Unmarshal
+	if b := d.metadata[inboxMetadataKey(accountID)]; len(b) > 0 {
+		if err = json.Unmarshal(b, &i); err != nil {
+			err = errors.Wrapf(err, "unmarshaling %s failed", b)
+			return
+		}
+	}
+
+	// Accounts are stored without their operations
+	if i.Account != nil {
+		i.Account.init()
+	}
+	if i.Operations == nil {
+		i.Operations = []inboxOperation{}
+	}
+	return
+}
+
+// AddToInbox adds the operations of imported statements to the inboxes of their accounts
+// Operations that are already in an inbox are ignored and inboxes that have no operation left to review are committed
+// right away. Inboxes are written at once.
+func (d *Data) AddToInbox(ss []inboxStatement, batch string) (err error) {
+	// Lock
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// Read-only
+	if d.readOnly {
+		err = errReadOnly
+		return
+	}
+
+	// Loop through statements
+	var is = make(map[string]inbox)
+	for _, s := range ss {
+		// Fetch inbox
+		// Statements of the same account share its inbox
+		var i, ok = is[s.account.ID]
+		if !ok {
+			if i, err = d.inbox(s.account.ID); err != nil {
+				err = errors.Wrapf(err, "fetching inbox of account %s failed", s.account.ID)
+				return
+			}
+		}
+
+		// Account doesn't exist yet
+		if _, errOne := d.Accounts.One(s.account.ID); errOne != nil && i.Account == nil {
+			i.Account = s.account
+		}
+
+		// Add operations
+		for _, o := range s.operations {
+			if i.index(o.Fingerprint) < 0 {
+				i.Operations = append(i.Operations, inboxOperation{Batch: batch, Operation: o})
+			}
+		}
+		if s.point != nil {
+			i.Points = append(i.Points, *s.point)
+		}
+		is[s.account.ID] = i
+	}
+
+	// Commit
+	// Inboxes with operations left to review are only written
+	_, err = d.commitInbox(is, map[string][]*Operation{}, batch)
+	return
+}
+
+// ReviewInbox removes reviewed operations from the inboxes of their accounts and adds the accepted ones to their
+// accounts
+// Reviews are checked before anything is changed and either all of them are applied or none of them
+func (d *Data) ReviewInbox(rs []inboxReview, batch string) (s importSummary, err error) {
+	// Lock
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// Read-only
+	if d.readOnly {
+		err = errReadOnly
+		return
+	}
+
+	// Loop through reviews
+	var is = make(map[string]inbox)
+	var accepted = make(map[string][]*Operation)
+	for _, r := range rs {
+		// Check account
+		if _, ok := is[r.AccountID]; ok {
+			err = fmt.Errorf("inbox of account %s is reviewed twice", r.AccountID)
+			return
+		}
+
+		// Fetch inbox
+		var i inbox
+		if i, err = d.inbox(r.AccountID); err != nil {
+			err = errors.Wrapf(err, "fetching inbox of account %s failed", r.AccountID)
+			return
+		}
+
+		// Accept all
+		if r.All {
+			for _, o := range i.Operations {
+				accepted[r.AccountID] = append(accepted[r.AccountID], o.Operation)
+			}
+			i.Operations = []inboxOperation{}
+		}
+
+		// Accept operations
+		for _, o := range r.Accepted {
+			var idx = i.index(o.Fingerprint)
+			if idx < 0 {
+				err = fmt.Errorf("operation %s is not in inbox of account %s", o.RawLabel, r.AccountID)
+				return
+			}
+			var c = *i.Operations[idx].Operation
+			c.Category, c.Label, c.Subject = o.Category, o.Label, o.Subject
+			accepted[r.AccountID] = append(accepted[r.AccountID], &c)
+			i.Operations = append(i.Operations[:idx], i.Operations[idx+1:]...)
+		}
+
+		// Skip operations
+		for _, f := range r.Skipped {
+			var idx = i.index(f)
+			if idx < 0 {
+				err = fmt.Errorf("operation %s is not in inbox of account %s", f, r.AccountID)
+				return
+			}
+			i.Operations = append(i.Operations[:idx], i.Operations[idx+1:]...)
+		}
+		is[r.AccountID] = i
+	}
+
+	// Commit
+	return d.commitInbox(is, accepted, batch)
+}
+
+// commitInbox writes reviewed inboxes and commits their accepted operations
+// Accounts are created along with their first accepted operations and reconciliation points are recorded once their
+// inbox has no operation left. The inbox of an account that doesn't exist yet is dropped when its operations have all
+// been skipped.
+// Data must be locked
+func (d *Data) commitInbox(is map[string]inbox, accepted map[string][]*Operation, batch string) (s importSummary, err error) {
+	// Sort accounts
+	var ids []string
+	for id := range is {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	// Loop through inboxes
+	var cs []importCommit
+	var ms = make(map[string][]byte)
+	for _, id := range ids {
+		// Build commit
+		var i = is[id]
+		if len(accepted[id]) == 0 && len(i.Operations) == 0 && i.Account != nil {
+			i = inbox{Operations: []inboxOperation{}}
+		} else if len(accepted[id]) > 0 || len(i.Operations) == 0 {
+			var c = importCommit{operations: accepted[id]}
+			if c.account = i.Account; c.account == nil {
+				if c.account, err = d.Accounts.One(id); err != nil {
+					err = errors.Wrapf(err, "fetching account %s failed", id)
+					return
+				}
+			}
+			if len(i.Operations) == 0 {
+				c.points, i.Points = i.Points, nil
+			}
+			i.Account = nil
+			cs = append(cs, c)
+		}
+
+		// Marshal inbox
+		var b []byte
+		if b, err = json.Marshal(i); err != nil {
+			err = errors.Wrapf(err, "marshaling inbox of account %s failed", id)
+			return
+		}
+		ms[inboxMetadataKey(id)] = b
+	}
+	return d.commitImport(cs, batch, ms)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestInboxStatement creates a statement of an account with operations of the same day
+func newTestInboxStatement(accountID string, labels ...string) (s inboxStatement) {
+	s.account = newAccount()
+	s.account.ID = accountID
+	s.account.setDefaults()
+	for _, l := range labels {
+		s.operations = append(s.operations, &Operation{Amount: Money{Currency: s.account.Currency, Units: -10000}, Date: time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC), RawLabel: l})
+	}
+	setFingerprints(s.operations)
+	s.point = &reconciliationPoint{Balance: Money{Currency: s.account.Currency, Units: -10000 * int64(len(labels))}, Date: time.Date(2018, 1, 31, 0, 0, 0, 0, time.UTC)}
+	return
+}
+
+// reopenTestData closes data and opens it again so that what has been written is checked
+func reopenTestData(t *testing.T, d *Data, dir string) *Data {
+	if err := d.Close(); err != nil {
+		t.Fatalf("closing data failed: %v", err)
+	}
+	return openTestData(t, dir)
+}
+
+func TestInboxLifecycle(t *testing.T) {
+	// Add to inbox
+	// Adding the same statement twice doesn't duplicate its operations
+	var dir = t.TempDir()
+	var d = openTestData(t, dir)
+	defer func() { d.Close() }()
+	var s = newTestInboxStatement("a", "Shop", "Bakery")
+	for idx := 0; idx < 2; idx++ {
+		if err := d.AddToInbox([]inboxStatement{s}, "import"); err != nil {
+			t.Fatalf("adding to inbox failed: %v", err)
+		}
+	}
+	d = reopenTestData(t, d, dir)
+	if _, err := d.Accounts.One("a"); err == nil {
+		t.Fatal("expected account not to be created before an operation is accepted")
+	}
+	i, err := d.Inbox("a")
+	if err != nil {
+		t.Fatalf("fetching inbox failed: %v", err)
+	} else if i.Account == nil || len(i.Operations) != 2 || len(i.Points) != 2 {
+		t.Fatalf("expected inbox with account, 2 operations and 2 points, got %+v", i)
+	}
+
+	// Accept
+	var o = *s.operations[0]
+	o.Category = categoryFood
+	sum, err := d.ReviewInbox([]inboxReview{{AccountID: "a", Accepted: []*Operation{&o}}}, "review")
+	if err != nil {
+		t.Fatalf("reviewing inbox failed: %v", err)
+	} else if len(sum.Accounts) != 1 || !sum.Accounts[0].Created || sum.Accounts[0].Operations != 1 {
+		t.Fatalf("expected account to be created with 1 operation, got %+v", sum.Accounts)
+	}
+	d = reopenTestData(t, d, dir)
+	a, err := d.Accounts.One("a")
+	if err != nil {
+		t.Fatalf("fetching account failed: %v", err)
+	} else if ops := a.Operations.All(); len(ops) != 1 || ops[0].Category != categoryFood || a.Balance.Units != -10000 {
+		t.Fatalf("expected 1 operation in %s and a balance of -10000 units, got %+v and %d units", categoryFood, ops, a.Balance.Units)
+	}
+	if ps, _ := d.ReconciliationPoints("a"); len(ps) != 0 {
+		t.Fatalf("expected no reconciliation point while operations are left, got %+v", ps)
+	}
+
+	// Skip
+	if _, err = d.ReviewInbox([]inboxReview{{AccountID: "a", Skipped: []string{s.operations[1].Fingerprint}}}, "review"); err != nil {
+		t.Fatalf("reviewing inbox failed: %v", err)
+	}
+	d = reopenTestData(t, d, dir)
+	if is, _ := d.Inboxes(); len(is) != 0 {
+		t.Fatalf("expected no inbox left, got %+v", is)
+	}
+	if ps, _ := d.ReconciliationPoints("a"); len(ps) != 1 {
+		t.Fatalf("expected the reconciliation points of the same statement to be recorded once, got %+v", ps)
+	}
+}
+
+func TestInboxSkippedCreatesNoAccount(t *testing.T) {
+	// Add to inbox
+	var dir = t.TempDir()
+	var d = openTestData(t, dir)
+	defer func() { d.Close() }()
+	var s = newTestInboxStatement("a", "Shop", "Bakery")
+	if err := d.AddToInbox([]inboxStatement{s}, "import"); err != nil {
+		t.Fatalf("adding to inbox failed: %v", err)
+	}
+
+	// Skip all
+	var fs []string
+	for _, o := range s.operations {
+		fs = append(fs, o.Fingerprint)
+	}
+	if _, err := d.ReviewInbox([]inboxReview{{AccountID: "a", Skipped: fs}}, "review"); err != nil {
+		t.Fatalf("reviewing inbox failed: %v", err)
+	}
+	d = reopenTestData(t, d, dir)
+	if _, err := d.Accounts.One("a"); err == nil {
+		t.Fatal("expected account not to be created")
+	}
+	if i, _ := d.Inbox("a"); !i.empty() {
+		t.Fatalf("expected inbox to be empty, got %+v", i)
+	}
+	if ps, _ := d.ReconciliationPoints("a"); len(ps) != 0 {
+		t.Fatalf("expected no reconciliation point, got %+v", ps)
+	}
+}
+
+func TestReviewInboxAtomic(t *testing.T) {
+	// Add to inboxes
+	var dir = t.TempDir()
+	var d = openTestData(t, dir)
+	defer func() { d.Close() }()
+	var sa, sb = newTestInboxStatement("a", "Shop"), newTestInboxStatement("b", "Bakery")
+	if err := d.AddToInbox([]inboxStatement{sa, sb}, "import"); err != nil {
+		t.Fatalf("adding to inbox failed: %v", err)
+	}
+
+	// Review
+	// The second review is invalid which prevents the first one from being applied
+	if _, err := d.ReviewInbox([]inboxReview{
+		{AccountID: "a", All: true},
+		{AccountID: "b", Skipped: []string{"unknown"}},
+	}, "review"); err == nil {
+		t.Fatal("expected an error")
+	}
+	d = reopenTestData(t, d, dir)
+	if _, err := d.Accounts.One("a"); err == nil {
+		t.Fatal("expected account not to be created")
+	}
+	if is, _ := d.Inboxes(); len(is) != 2 || len(is["a"].Operations) != 1 || len(is["b"].Operations) != 1 {
+		t.Fatalf("expected inboxes to be left untouched, got %+v", is)
+	}
+}
+
+func TestCommitImportAtomic(t *testing.T) {
+	// Commit
+	// The operation of the second account is in another currency which prevents the first one from being committed
+	var dir = t.TempDir()
+	var d = openTestData(t, dir)
+	defer func() { d.Close() }()
+	var sa, sb = newTestInboxStatement("a", "Shop"), newTestInboxStatement("b", "Bakery")
+	sb.operations[0].Amount.Currency = "USD"
+	d.mutex.Lock()
+	_, err := d.commitImport([]importCommit{
+		{account: sa.account, operations: sa.operations, points: []reconciliationPoint{*sa.point}},
+		{account: sb.account, operations: sb.operations},
+	}, "import", map[string][]byte{"k": []byte(`"v"`)})
+	d.mutex.Unlock()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// Nothing has changed
+	d = reopenTestData(t, d, dir)
+	if as := d.Accounts.All(); len(as) != 0 {
+		t.Fatalf("expected no account, got %+v", as)
+	}
+	if ps, _ := d.ReconciliationPoints("a"); len(ps) != 0 {
+		t.Fatalf("expected no reconciliation point, got %+v", ps)
+	}
+	if _, err = d.Undo(); err != errNothingToUndo {
+		t.Fatalf("expected %v, got %v", errNothingToUndo, err)
+	}
+}
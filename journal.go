@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// Journal
+// A journal is a sequence of records each of them made of its size and its crc32 as big endian uint32 followed by
+// its gob encoded content
+const (
+	journalRecordHeaderSize = 8
+)
+
+// journal represents an append-only journal of the changes made since the last snapshot
+type journal struct {
+	f    *os.File
+	path string
+}
+
+// journalRecord represents a journal record
+// Changes written together, such as an import batch, are stored in the same record
+type journalRecord struct {
+	Changes []StoreChange
+	Time    time.Time
+	Version int
+}
+
+// journalRecordHeader represents the fields of a journal record that don't depend on its version
+// Records written before they were versioned are in version 1
+type journalRecordHeader struct {
+	Time    time.Time
+	Version int
+}
+
+// journalPath returns the journal path of a data path
+func journalPath(dataPath string) string {
+	return dataPath + ".journal"
+}
+
+// newJournal creates a new journal
+func newJournal(path string) *journal {
+	return &journal{path: path}
+}
+
+// close closes the journal
+func (j *journal) close() (err error) {
+	if j.f == nil {
+		return
+	}
+	if err = j.f.Close(); err != nil {
+		err = errors.Wrapf(err, "closing %s failed", j.path)
+		return
+	}
+	j.f = nil
+	return
+}
+
+// open opens the journal for appending
+func (j *journal) open() (err error) {
+	if j.f != nil {
+		return
+	}
+	if j.f, err = os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err != nil {
+		err = errors.Wrapf(err, "opening %s failed", j.path)
+		return
+	}
+	return
+}
+
+// append appends a record to the journal and syncs it
+func (j *journal) append(r journalRecord, e *encrypter) (err error) {
+	// Open
+	if err = j.open(); err != nil {
+		err = errors.Wrap(err, "opening failed")
+		return
+	}
+
+	// Encode
+	var buf = &bytes.Buffer{}
+	if err = gob.NewEncoder(buf).Encode(r); err != nil {
+		err = errors.Wrap(err, "encoding record failed")
+		return
+	}
+	var b = buf.Bytes()
+
+	// Encrypt
+	if e != nil {
+		if b, err = e.seal(b); err != nil {
+			err = errors.Wrap(err, "encrypting record failed")
+			return
+		}
+	}
+
+	// Build header
+	var h = make([]byte, journalRecordHeaderSize)
+	binary.BigEndian.PutUint32(h[:4], uint32(len(b)))
+	binary.BigEndian.PutUint32(h[4:], crc32.ChecksumIEEE(b))
+
+	// Write
+	if _, err = j.f.Write(append(h, b...)); err != nil {
+		err = errors.Wrapf(err, "writing to %s failed", j.path)
+		return
+	}
+
+	// Sync
+	if err = j.f.Sync(); err != nil {
+		err = errors.Wrapf(err, "syncing %s failed", j.path)
+		return
+	}
+	return
+}
+
+// read reads the records of the journal and returns the offset following the last valid one
+// A truncated or corrupted record, which happens when the app crashes while appending, ends the journal
+func (j *journal) read(e *encrypter) (rs []journalRecord, end int64, err error) {
+	// Read file
+	var b []byte
+	if b, err = ioutil.ReadFile(j.path); os.IsNotExist(err) {
+		err = nil
+		return
+	} else if err != nil {
+		err = errors.Wrapf(err, "reading %s failed", j.path)
+		return
+	}
+
+	// Loop through records
+	for len(b) > 0 {
+		// Parse header
+		if len(b) < journalRecordHeaderSize {
+			astilog.Warnf("Journal %s ends with a truncated record header, ignoring it", j.path)
+			return
+		}
+		var size = int(binary.BigEndian.Uint32(b[:4]))
+		var sum = binary.BigEndian.Uint32(b[4:journalRecordHeaderSize])
+		b = b[journalRecordHeaderSize:]
+
+		// Check content
+		if len(b) < size || crc32.ChecksumIEEE(b[:size]) != sum {
+			astilog.Warnf("Journal %s ends with a corrupted record, ignoring it", j.path)
+			return
+		}
+		var c = b[:size]
+		b = b[size:]
+		end += int64(journalRecordHeaderSize + size)
+
+		// Decrypt
+		if isEncrypted(c) {
+			if e == nil {
+				err = errMissingPassphrase
+				return
+			}
+			if c, err = e.open(c); err != nil {
+				err = errors.Wrap(err, "decrypting record failed")
+				return
+			}
+		}
+
+		// Decode header
+		var h journalRecordHeader
+		if err = gob.NewDecoder(bytes.NewReader(c)).Decode(&h); err != nil {
+			err = errors.Wrap(err, "decoding record header failed")
+			return
+		}
+		if h.Version == 0 {
+			h.Version = 1
+		}
+
+		// Migrate
+		if h.Version > dataVersion {
+			err = fmt.Errorf("record version %d is more recent than supported version %d", h.Version, dataVersion)
+			return
+		} else if c, err = migratePayload(journalMigrations, h.Version, c); err != nil {
+			err = errors.Wrap(err, "migrating record failed")
+			return
+		}
+
+		// Decode
+		var r journalRecord
+		if err = gob.NewDecoder(bytes.NewReader(c)).Decode(&r); err != nil {
+			err = errors.Wrap(err, "decoding record failed")
+			return
+		}
+		rs = append(rs, r)
+	}
+	return
+}
+
+// truncate empties the journal once its records have been included in a snapshot
+func (j *journal) truncate() (err error) {
+	// Open
+	if err = j.open(); err != nil {
+		err = errors.Wrap(err, "opening failed")
+		return
+	}
+
+	// Truncate
+	if err = j.f.Truncate(0); err != nil {
+		err = errors.Wrapf(err, "truncating %s failed", j.path)
+		return
+	}
+
+	// Sync
+	if err = j.f.Sync(); err != nil {
+		err = errors.Wrapf(err, "syncing %s failed", j.path)
+		return
+	}
+	return
+}
+
+// truncateAt truncates the journal at an offset
+// It drops the truncated or corrupted record ending the journal which would otherwise hide the records appended after
+// it
+func (j *journal) truncateAt(offset int64) (err error) {
+	// Close since the journal is reopened for appending
+	if err = j.close(); err != nil {
+		err = errors.Wrap(err, "closing failed")
+		return
+	}
+
+	// Truncate
+	if err = os.Truncate(j.path, offset); err != nil {
+		err = errors.Wrapf(err, "truncating %s failed", j.path)
+		return
+	}
+	return
+}
+
+// apply applies changes on top of stored data
+// Changes hold the full state of what they're about which makes applying them several times harmless
+func (ds *dataStored) apply(cs []StoreChange) {
+	for _, c := range cs {
+		switch c.Kind {
+		case storeChangeKindAccountCreated, storeChangeKindAccountUpdated:
+			if as := ds.account(c.AccountID); as != nil {
+				as.Account = c.Account
+			} else {
+				ds.Accounts = append(ds.Accounts, AccountStored{Account: c.Account})
+			}
+		case storeChangeKindMetadataUpdated:
+			if ds.Metadata == nil {
+				ds.Metadata = make(map[string][]byte)
+			}
+			ds.Metadata[c.Key] = c.Value
+		case storeChangeKindOperationAdded, storeChangeKindOperationUpdated:
+			if as := ds.account(c.AccountID); as != nil {
+				if idx := as.operationIndex(c.Operation.ID); idx > -1 {
+					as.Operations[idx] = c.Operation
+				} else {
+					as.Operations = append(as.Operations, c.Operation)
+				}
+			}
+		case storeChangeKindOperationDeleted:
+			if as := ds.account(c.AccountID); as != nil {
+				if idx := as.operationIndex(c.Operation.ID); idx > -1 {
+					as.Operations = append(as.Operations[:idx], as.Operations[idx+1:]...)
+				}
+			}
+		}
+	}
+}
+
+// account returns the stored account for a specific id
+func (ds *dataStored) account(id string) *AccountStored {
+	for idx := range ds.Accounts {
+		if ds.Accounts[idx].ID == id {
+			return &ds.Accounts[idx]
+		}
+	}
+	return nil
+}
+
+// operationIndex returns the index of the operation for a specific id
+func (as *AccountStored) operationIndex(id int) int {
+	for idx, o := range as.Operations {
+		if o.ID == id {
+			return idx
+		}
+	}
+	return -1
+}
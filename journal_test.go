@@ -0,0 +1,221 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestJournal creates a journal with records whose changes each update a metadata
+func newTestJournal(t *testing.T, e *encrypter, keys ...string) *journal {
+	var j = newJournal(filepath.Join(t.TempDir(), "data.bin.journal"))
+	for _, k := range keys {
+		if err := j.append(journalRecord{Changes: []StoreChange{newStoreChangeMetadata(k, []byte(`"`+k+`"`))}, Time: time.Now(), Version: dataVersion}, e); err != nil {
+			t.Fatalf("appending record %s failed: %v", k, err)
+		}
+	}
+	if err := j.close(); err != nil {
+		t.Fatalf("closing journal failed: %v", err)
+	}
+	return j
+}
+
+// journalKeys returns the metadata keys of journal records
+func journalKeys(rs []journalRecord) (ks []string) {
+	for _, r := range rs {
+		for _, c := range r.Changes {
+			ks = append(ks, c.Key)
+		}
+	}
+	return
+}
+
+func TestJournalRead(t *testing.T) {
+	for _, c := range []struct {
+		alter func(b []byte) []byte
+		name  string
+		want  []string
+	}{
+		{
+			alter: func(b []byte) []byte { return b },
+			name:  "intact",
+			want:  []string{"a", "b", "c"},
+		},
+		{
+			alter: func(b []byte) []byte { return b[:len(b)-3] },
+			name:  "truncated content",
+			want:  []string{"a", "b"},
+		},
+		{
+			alter: func(b []byte) []byte { return append(b, 0, 0, 0) },
+			name:  "truncated header",
+			want:  []string{"a", "b", "c"},
+		},
+		{
+			alter: func(b []byte) []byte {
+				b[len(b)-1] ^= 0xff
+				return b
+			},
+			name: "bad crc",
+			want: []string{"a", "b"},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			// Alter journal
+			var j = newTestJournal(t, nil, "a", "b", "c")
+			b, err := ioutil.ReadFile(j.path)
+			if err != nil {
+				t.Fatalf("reading journal failed: %v", err)
+			}
+			if err = ioutil.WriteFile(j.path, c.alter(b), 0600); err != nil {
+				t.Fatalf("writing journal failed: %v", err)
+			}
+
+			// Read
+			rs, _, err := j.read(nil)
+			if err != nil {
+				t.Fatalf("reading records failed: %v", err)
+			}
+			if ks := journalKeys(rs); !equalStrings(ks, c.want) {
+				t.Fatalf("expected keys %v, got %v", c.want, ks)
+			}
+		})
+	}
+}
+
+func TestJournalReadEncrypted(t *testing.T) {
+	e, err := newEncrypter([]byte("passphrase"), nil)
+	if err != nil {
+		t.Fatalf("creating encrypter failed: %v", err)
+	}
+	var j = newTestJournal(t, e, "a", "b")
+
+	// Missing passphrase
+	if _, _, err = j.read(nil); err != errMissingPassphrase {
+		t.Fatalf("expected missing passphrase error, got %v", err)
+	}
+
+	// Passphrase
+	rs, _, err := j.read(e)
+	if err != nil {
+		t.Fatalf("reading records failed: %v", err)
+	}
+	if ks := journalKeys(rs); !equalStrings(ks, []string{"a", "b"}) {
+		t.Fatalf("expected keys [a b], got %v", ks)
+	}
+}
+
+func TestJournalMissing(t *testing.T) {
+	rs, _, err := newJournal(filepath.Join(t.TempDir(), "missing")).read(nil)
+	if err != nil || len(rs) > 0 {
+		t.Fatalf("expected no record and no error, got %d record(s) and %v", len(rs), err)
+	}
+}
+
+func TestFileStoreReplay(t *testing.T) {
+	// Snapshot
+	var p = filepath.Join(t.TempDir(), "data.bin")
+	var s = newFileStore(p, nil, false)
+	var a = &Account{Balance: Money{Currency: "EUR", Units: 100000}, Currency: "EUR", ID: "a"}
+	if err := writeStore(s, dataStored{Accounts: []AccountStored{{Account: a}}}); err != nil {
+		t.Fatalf("writing store failed: %v", err)
+	}
+
+	// Write changes
+	var u = *a
+	u.Balance.Units = 50000
+	var o = &Operation{Amount: Money{Currency: "EUR", Units: -50000}, ID: 1}
+	for _, cs := range [][]StoreChange{
+		{newStoreChangeOperation(storeChangeKindOperationAdded, "a", o), newStoreChangeAccount(storeChangeKindAccountUpdated, &u)},
+		{newStoreChangeMetadata("k", []byte(`"v"`))},
+	} {
+		if err := s.Write(cs); err != nil {
+			t.Fatalf("writing changes failed: %v", err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("closing store failed: %v", err)
+	}
+
+	// Crash while appending
+	f, err := os.OpenFile(journalPath(p), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatalf("opening journal failed: %v", err)
+	}
+	if _, err = f.Write([]byte{0, 0, 1, 0, 1, 2, 3, 4, 5}); err != nil {
+		t.Fatalf("writing journal failed: %v", err)
+	}
+	f.Close()
+
+	// Load
+	ds, err := newFileStore(p, nil, true).Load()
+	if err != nil {
+		t.Fatalf("loading store failed: %v", err)
+	}
+	if len(ds.Accounts) != 1 || ds.Accounts[0].Balance.Units != 50000 || len(ds.Accounts[0].Operations) != 1 {
+		t.Fatalf("journal has not been replayed: %+v", ds.Accounts)
+	}
+	if v := string(ds.Metadata["k"]); v != `"v"` {
+		t.Fatalf("expected metadata \"v\", got %s", v)
+	}
+}
+
+func TestFileStoreAppendAfterCorruptTail(t *testing.T) {
+	// Write changes
+	var p = filepath.Join(t.TempDir(), "data.bin")
+	var s = newFileStore(p, nil, false)
+	if err := s.Write([]StoreChange{newStoreChangeMetadata("a", []byte(`"a"`))}); err != nil {
+		t.Fatalf("writing changes failed: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("closing store failed: %v", err)
+	}
+
+	// Crash while appending
+	f, err := os.OpenFile(journalPath(p), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatalf("opening journal failed: %v", err)
+	}
+	if _, err = f.Write([]byte{0, 0, 1, 0, 1, 2, 3, 4, 5}); err != nil {
+		t.Fatalf("writing journal failed: %v", err)
+	}
+	f.Close()
+
+	// Load and append
+	s = newFileStore(p, nil, false)
+	if _, err = s.Load(); err != nil {
+		t.Fatalf("loading store failed: %v", err)
+	}
+	if err = s.Write([]StoreChange{newStoreChangeMetadata("b", []byte(`"b"`))}); err != nil {
+		t.Fatalf("writing changes failed: %v", err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatalf("closing store failed: %v", err)
+	}
+
+	// Reload
+	ds, err := newFileStore(p, nil, true).Load()
+	if err != nil {
+		t.Fatalf("loading store failed: %v", err)
+	}
+	for _, k := range []string{"a", "b"} {
+		if v := string(ds.Metadata[k]); v != `"`+k+`"` {
+			t.Errorf("expected metadata %s to be \"%s\", got %s", k, k, v)
+		}
+	}
+}
+
+// equalStrings checks whether two slices of strings are equal
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// Vars
+var (
+	errLocked   = errors.New("data is already used by another instance of Astibank, close it or use -read-only")
+	errReadOnly = errors.New("data is read-only")
+)
+
+// dirLock represents an exclusive lock on a dir
+// The lock is held by the OS and is therefore released even if the app crashes
+type dirLock struct {
+	f *os.File
+}
+
+// lockPath returns the path of the lock file of a dir
+func lockPath(dirPath string) string {
+	return filepath.Join(dirPath, ".lock")
+}
+
+// lockDir takes an exclusive lock on a dir
+func lockDir(dirPath string) (l *dirLock, err error) {
+	// Open lock file
+	l = &dirLock{}
+	if l.f, err = os.OpenFile(lockPath(dirPath), os.O_CREATE|os.O_RDWR, 0600); err != nil {
+		err = errors.Wrapf(err, "opening %s failed", lockPath(dirPath))
+		return
+	}
+
+	// Lock
+	if err = lockFile(l.f); err != nil {
+		l.f.Close()
+		if err != errLocked {
+			err = errors.Wrapf(err, "locking %s failed", lockPath(dirPath))
+		}
+		return
+	}
+
+	// Write pid for information purposes
+	if err = l.f.Truncate(0); err == nil {
+		_, err = l.f.WriteAt([]byte(fmt.Sprintf("%d\n", os.Getpid())), 0)
+	}
+	if err != nil {
+		l.unlock()
+		err = errors.Wrapf(err, "writing pid in %s failed", lockPath(dirPath))
+		return
+	}
+	return
+}
+
+// unlock releases the lock
+func (l *dirLock) unlock() (err error) {
+	if err = unlockFile(l.f); err != nil {
+		l.f.Close()
+		err = errors.Wrapf(err, "unlocking %s failed", l.f.Name())
+		return
+	}
+	if err = l.f.Close(); err != nil {
+		err = errors.Wrapf(err, "closing %s failed", l.f.Name())
+		return
+	}
+	return
+}
@@ -0,0 +1,27 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockFile takes an exclusive lock on a file without blocking
+func lockFile(f *os.File) error {
+	var ol windows.Overlapped
+	if err := windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, &ol); err == windows.ERROR_LOCK_VIOLATION {
+		return errLocked
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// unlockFile releases the lock on a file
+func unlockFile(f *os.File) error {
+	var ol windows.Overlapped
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &ol)
+}
@@ -2,9 +2,9 @@ package main
 
 import (
 	"flag"
-
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/asticode/go-astilectron"
 	"github.com/asticode/go-astilectron/bootstrap"
@@ -14,8 +14,19 @@ import (
 
 // Vars
 var (
-	data  *Data
-	debug = flag.Bool("d", false, "debug")
+	backupsDaily   = flag.Int("backups-daily", 7, "number of daily backups to keep")
+	backupsMonthly = flag.Int("backups-monthly", 12, "number of monthly backups to keep")
+	data           *Data
+	dataDir        = flag.String("data-dir", "", "data dir path, defaults to $"+envDataDir+" or to $XDG_DATA_HOME/astibank")
+	dataDirPath    string
+	dataMutex      = &sync.RWMutex{}
+	dataOptions    DataOptions
+	debug          = flag.Bool("d", false, "debug")
+	profile        = flag.String("profile", "", "profile name, defaults to the last profile used")
+	ratesFile      = flag.String("rates", "", "exchange rates file path, defaults to "+ratesFileName+" in the data dir")
+	ratesFilePath  string
+	readOnly       = flag.Bool("read-only", false, "open data in read-only mode, which is allowed while another instance is running")
+	storeType      = flag.String("store", storeTypeFile, "store type: file or bolt")
 )
 
 //go:generate go-bindata -pkg $GOPACKAGE -o resources.go resources/...
@@ -24,19 +35,73 @@ func main() {
 	flag.Parse()
 	astilog.SetLogger(astilog.New(astilog.FlagConfig()))
 
-	// Fetch executable path
-	var p string
+	// Fetch data dir path
 	var err error
+	if dataDirPath = *dataDir; dataDirPath == "" {
+		if dataDirPath = os.Getenv(envDataDir); dataDirPath == "" {
+			if dataDirPath, err = defaultDataDirPath(); err != nil {
+				astilog.Fatal(errors.Wrap(err, "fetching default data dir path failed"))
+			}
+		}
+	}
+
+	// Fetch rates file path
+	if ratesFilePath = *ratesFile; ratesFilePath == "" {
+		ratesFilePath = ratesPath(dataDirPath)
+	}
+
+	// Older versions stored data next to the executable
+	var p string
 	if p, err = os.Executable(); err != nil {
 		astilog.Fatal(errors.Wrap(err, "fetching executable path failed"))
 	}
-	p = filepath.Dir(p)
+	if err = migrateLegacyData(filepath.Dir(p), dataDirPath); err != nil {
+		astilog.Fatal(errors.Wrap(err, "migrating legacy data failed"))
+	}
+
+	// Create profile dir
+	if *profile == "" {
+		*profile = lastProfile(dataDirPath)
+	}
+	if p, err = createProfileDir(dataDirPath, *profile); err != nil {
+		astilog.Fatal(errors.Wrapf(err, "creating dir of profile %s failed", *profile))
+	}
+
+	// Build data options
+	dataOptions = DataOptions{
+		Backups: BackupOptions{
+			Daily:   *backupsDaily,
+			Monthly: *backupsMonthly,
+		},
+		Passphrase: cachePassphrase(askPassphrase),
+		ReadOnly:   *readOnly,
+		StoreType:  *storeType,
+	}
+
+	// Run command
+	var ok bool
+	if ok, err = runCommand(p, dataOptions); err != nil {
+		astilog.Fatal(errors.Wrap(err, "running command failed"))
+	} else if ok {
+		return
+	}
 
 	// Import data
-	if data, err = NewData(p); err != nil {
-		astilog.Fatal(errors.Wrap(err, "importing data failed"))
+	// When its passphrase can't be read from the terminal or is invalid, data stays locked until the passphrase is
+	// provided through the UI, see handleMessages
+	if data, err = NewData(p, dataOptions); err != nil {
+		if c := errors.Cause(err); c != errMissingPassphrase && c != errInvalidPassphrase {
+			astilog.Fatal(errors.Wrap(err, "importing data failed"))
+		}
+		astilog.Infof("Passphrase will be asked through the UI: %s", err)
+		data = nil
+	}
+	defer closeData()
+
+	// Save last profile
+	if err = saveLastProfile(dataDirPath, *profile); err != nil {
+		astilog.Error(errors.Wrap(err, "saving last profile failed"))
 	}
-	defer data.Close()
 
 	// Run bootstrap
 	if err = bootstrap.Run(bootstrap.Options{
@@ -54,6 +119,18 @@ func main() {
 			Width:           astilectron.PtrInt(1280),
 		},
 	}); err != nil {
+		closeData()
 		astilog.Fatal(errors.Wrap(err, "running bootstrap failed"))
 	}
 }
+
+// closeData closes the data and logs errors since it's the last chance to save it
+// Locked data has nothing to close
+func closeData() {
+	if data == nil {
+		return
+	}
+	if err := data.Close(); err != nil {
+		astilog.Error(errors.Wrap(err, "closing data failed"))
+	}
+}
@@ -7,23 +7,81 @@ import (
 	"github.com/pkg/errors"
 )
 
+// Messages that don't need data and are therefore handled while it's locked
+var messagesWithoutData = map[string]bool{
+	"csvprofiles.delete": true,
+	"csvprofiles.list":   true,
+	"csvprofiles.save":   true,
+	"profiles.list":      true,
+	"profiles.switch":    true,
+	"references.list":    true,
+}
+
 // handleMessages handles messages
 func handleMessages(w *astilectron.Window, m bootstrap.MessageIn) {
+	// Data is replaced when switching profiles which must not happen while other messages are using it
+	if m.Name == "profiles.switch" {
+		dataMutex.Lock()
+		defer dataMutex.Unlock()
+	} else {
+		dataMutex.RLock()
+		defer dataMutex.RUnlock()
+	}
+
+	// Data is locked until its passphrase has been provided
+	if data == nil && !messagesWithoutData[m.Name] {
+		if err := sendProfilePassphrase(w, *profile, false); err != nil {
+			astilog.Error(errors.Wrap(err, "sending profile passphrase failed"))
+		}
+		return
+	}
+
+	// Route
 	switch m.Name {
 	case "accounts.list":
 		handleMessageAccountsList(w)
 	case "charts.all":
 		handleMessageChartsAll(w, m)
+	case "csvprofiles.delete":
+		handleMessageCSVProfilesDelete(w, m)
+	case "csvprofiles.list":
+		handleMessageCSVProfilesList(w)
+	case "csvprofiles.save":
+		handleMessageCSVProfilesSave(w, m)
+	case "history.redo":
+		handleMessageHistoryRedo(w)
+	case "history.undo":
+		handleMessageHistoryUndo(w)
 	case "import":
 		handleMessageImport(w, m)
+	case "import.commit":
+		handleMessageImportCommit(w, m)
+	case "import.preview":
+		handleMessageImportPreview(w, m)
+	case "inbox.accept":
+		handleMessageInboxAccept(w, m)
+	case "inbox.acceptAll":
+		handleMessageInboxAcceptAll(w, m)
+	case "inbox.list":
+		handleMessageInboxList(w)
+	case "inbox.skip":
+		handleMessageInboxSkip(w, m)
 	case "operations.add":
 		handleMessageOperationsAdd(w, m)
+	case "operations.delete":
+		handleMessageOperationsDelete(w, m)
 	case "operations.list":
 		handleMessageOperationsList(w, m)
 	case "operations.one":
 		handleMessageOperationsOne(w, m)
 	case "operations.update":
 		handleMessageOperationsUpdate(w, m)
+	case "profiles.list":
+		handleMessageProfilesList(w)
+	case "profiles.switch":
+		handleMessageProfilesSwitch(w, m)
+	case "reconcile.status":
+		handleMessageReconcileStatus(w, m)
 	case "references.list":
 		handleMessageReferencesList(w)
 	}
@@ -11,6 +11,20 @@ import (
 	"github.com/pkg/errors"
 )
 
+// PayloadCharts represents a payload asking for the charts of an account in a reporting currency
+// The reporting currency defaults to the currency of the account
+type PayloadCharts struct {
+	AccountID string `json:"account_id"`
+	Currency  string `json:"currency,omitempty"`
+}
+
+// PayloadChartsAll represents the charts of an account with the currencies they can be reported in
+type PayloadChartsAll struct {
+	Charts     []astichartjs.Chart `json:"charts"`
+	Currencies []string            `json:"currencies"`
+	Currency   string              `json:"currency"`
+}
+
 // handleMessageChartsList handles the "charts.all" message
 func handleMessageChartsAll(w *astilectron.Window, m bootstrap.MessageIn) {
 	// Process errors
@@ -18,43 +32,68 @@ func handleMessageChartsAll(w *astilectron.Window, m bootstrap.MessageIn) {
 	defer processMessageError(w, &err)
 
 	// Unmarshal
-	var id string
-	if err = json.Unmarshal(m.Payload, &id); err != nil {
+	var pc PayloadCharts
+	if err = json.Unmarshal(m.Payload, &pc); err != nil {
 		err = errors.Wrapf(err, "unmarshaling %s failed", m.Payload)
 		return
 	}
 
 	// Fetch account
 	var a *Account
-	if a, err = data.Accounts.One(id); err != nil {
-		err = errors.Wrapf(err, "fetching account %s failed", id)
+	if a, err = data.Accounts.One(pc.AccountID); err != nil {
+		err = errors.Wrapf(err, "fetching account %s failed", pc.AccountID)
+		return
+	}
+
+	// Load rates
+	// They're loaded every time since the user may edit them while the app is running
+	var rs *rates
+	if rs, err = loadRates(ratesFilePath); err != nil {
+		err = errors.Wrap(err, "loading rates failed")
+		return
+	}
+
+	// Build payload
+	var p = PayloadChartsAll{Currencies: rs.currencies(), Currency: pc.Currency}
+	if p.Currency == "" {
+		p.Currency = a.Currency
+	}
+	if i := sort.SearchStrings(p.Currencies, a.Currency); i == len(p.Currencies) || p.Currencies[i] != a.Currency {
+		p.Currencies = append(p.Currencies, a.Currency)
+		sort.Strings(p.Currencies)
+	}
+
+	// Build charts
+	if p.Charts, err = buildCharts(a, p.Currency, rs); err != nil {
+		err = errors.Wrapf(err, "building charts in %s failed", p.Currency)
 		return
 	}
 
 	// Send
-	if err = w.Send(bootstrap.MessageOut{Name: "charts.all", Payload: buildCharts(a)}); err != nil {
+	if err = w.Send(bootstrap.MessageOut{Name: "charts.all", Payload: p}); err != nil {
 		err = errors.Wrap(err, "sending message failed")
 		return
 	}
 }
 
-// buildCharts builds charts
-func buildCharts(a *Account) (cs []astichartjs.Chart) {
+// buildCharts builds charts in a reporting currency
+// Amounts are converted with the rates of the date of their operation
+func buildCharts(a *Account, currency string, rs *rates) (cs []astichartjs.Chart, err error) {
 	// Loop through operations
 	var categories, dates []string
 	var datesMap = make(map[string]bool)
-	var d = make(map[string]map[string]map[string]float64)
+	var d = make(map[string]map[string]map[string]Money)
 	for _, operation := range a.Operations.All() {
 		// New category
 		if _, ok := d[operation.Category]; !ok {
 			categories = append(categories, operation.Category)
-			d[operation.Category] = make(map[string]map[string]float64)
+			d[operation.Category] = make(map[string]map[string]Money)
 		}
 
 		// New date for category
 		var date = operation.Date.Format("01/2006")
 		if _, ok := d[operation.Category][date]; !ok {
-			d[operation.Category][date] = make(map[string]float64)
+			d[operation.Category][date] = make(map[string]Money)
 		}
 
 		// New date
@@ -63,28 +102,54 @@ func buildCharts(a *Account) (cs []astichartjs.Chart) {
 			datesMap[date] = true
 		}
 
+		// Convert
+		var amount Money
+		if amount, err = rs.convert(operation.Amount, currency, operation.Date); err != nil {
+			err = errors.Wrapf(err, "converting amount of operation %d failed", operation.ID)
+			return
+		}
+
 		// Update sum
-		d[operation.Category][date][operation.Subject] += operation.Amount
+		if d[operation.Category][date][operation.Subject], err = d[operation.Category][date][operation.Subject].Add(amount); err != nil {
+			err = errors.Wrapf(err, "adding amount of operation %d failed", operation.ID)
+			return
+		}
 	}
 	sort.Strings(categories)
 	sort.Strings(dates)
 
 	// Build average chart
-	cs = append(cs, buildChartAverage(dates, d))
+	var c astichartjs.Chart
+	if c, err = buildChartAverage(currency, dates, d); err != nil {
+		err = errors.Wrap(err, "building average chart failed")
+		return
+	}
+	cs = append(cs, c)
 
 	// Build monthly balance
-	cs = append(cs, buildChartMonthlyBalance(dates, d))
+	if c, err = buildChartMonthlyBalance(currency, dates, d); err != nil {
+		err = errors.Wrap(err, "building monthly balance chart failed")
+		return
+	}
+	cs = append(cs, c)
+
+	// Build balance over time
+	if c, err = buildChartBalance(a, currency, rs); err != nil {
+		err = errors.Wrap(err, "building balance chart failed")
+		return
+	}
+	cs = append(cs, c)
 
 	// Build monthly sum charts
 	for _, category := range categories {
-		cs = append(cs, buildChartMonthlySum(category, dates, d[category]))
+		cs = append(cs, buildChartMonthlySum(category, currency, dates, d[category]))
 	}
 	return
 }
 
 // buildChartAverage builds the average chart
 // d  is indexed by category then by date then by subject
-func buildChartAverage(dates []string, d map[string]map[string]map[string]float64) (c astichartjs.Chart) {
+func buildChartAverage(currency string, dates []string, d map[string]map[string]map[string]Money) (c astichartjs.Chart, err error) {
 	// Init
 	c = astichartjs.Chart{
 		Data: astichartjs.Data{
@@ -108,7 +173,7 @@ func buildChartAverage(dates []string, d map[string]map[string]map[string]float6
 				YAxes: []astichartjs.Axis{{
 					ScaleLabel: astichartjs.ScaleLabel{
 						Display:     true,
-						LabelString: "Average(€)",
+						LabelString: "Average(" + currency + ")",
 					},
 				}},
 			},
@@ -128,13 +193,16 @@ func buildChartAverage(dates []string, d map[string]map[string]map[string]float6
 	var backgroundColors, borderColors []string
 	for _, category := range c.Data.Labels {
 		// Init
-		var sum float64
+		var sum Money
 
 		// Loop through dates
 		for _, subjects := range d[category] {
 			// Loop through subjects
 			for _, amount := range subjects {
-				sum += amount
+				if sum, err = sum.Add(amount); err != nil {
+					err = errors.Wrapf(err, "adding amount to sum of %s failed", category)
+					return
+				}
 			}
 		}
 
@@ -142,7 +210,7 @@ func buildChartAverage(dates []string, d map[string]map[string]map[string]float6
 		var color = colorPicker.Next()
 		backgroundColors = append(backgroundColors, astichartjs.BackgroundColor(color))
 		borderColors = append(borderColors, astichartjs.BorderColor(color))
-		c.Data.Datasets[0].Data = append(c.Data.Datasets[0].Data, sum/float64(len(dates)))
+		c.Data.Datasets[0].Data = append(c.Data.Datasets[0].Data, sum.Float64()/float64(len(dates)))
 	}
 	c.Data.Datasets[0].BackgroundColor = backgroundColors
 	c.Data.Datasets[0].BorderColor = borderColors
@@ -151,7 +219,7 @@ func buildChartAverage(dates []string, d map[string]map[string]map[string]float6
 
 // buildChartMonthlyBalance builds the monthly balance chart
 // d  is indexed by category then by date then by subject
-func buildChartMonthlyBalance(dates []string, d map[string]map[string]map[string]float64) (c astichartjs.Chart) {
+func buildChartMonthlyBalance(currency string, dates []string, d map[string]map[string]map[string]Money) (c astichartjs.Chart, err error) {
 	// Init
 	c = astichartjs.Chart{
 		Data: astichartjs.Data{
@@ -169,7 +237,7 @@ func buildChartMonthlyBalance(dates []string, d map[string]map[string]map[string
 				YAxes: []astichartjs.Axis{{
 					ScaleLabel: astichartjs.ScaleLabel{
 						Display:     true,
-						LabelString: "Balance(€)",
+						LabelString: "Balance(" + currency + ")",
 					},
 				}},
 			},
@@ -183,27 +251,89 @@ func buildChartMonthlyBalance(dates []string, d map[string]map[string]map[string
 	}
 
 	// Loop through categories
-	var balances = make(map[string]float64)
+	var balances = make(map[string]Money)
 	for _, ds := range d {
 		// Loop through dates
 		for date, subjects := range ds {
 			// Loop through subjects
 			for _, amount := range subjects {
-				balances[date] += amount
+				if balances[date], err = balances[date].Add(amount); err != nil {
+					err = errors.Wrapf(err, "adding amount to balance of %s failed", date)
+					return
+				}
 			}
 		}
 	}
 
 	// Loop through dates
 	for _, date := range dates {
-		c.Data.Datasets[0].Data = append(c.Data.Datasets[0].Data, balances[date])
+		c.Data.Datasets[0].Data = append(c.Data.Datasets[0].Data, balances[date].Float64())
+	}
+	return
+}
+
+// buildChartBalance builds the balance over time chart
+// There's a point at the end of each day with operations and balances are converted with the rates of that day
+func buildChartBalance(a *Account, currency string, rs *rates) (c astichartjs.Chart, err error) {
+	// Init
+	c = astichartjs.Chart{
+		Data: astichartjs.Data{
+			Datasets: []astichartjs.Dataset{{
+				BackgroundColor: astichartjs.BackgroundColor(astichartjs.ChartColorBlue),
+				BorderColor:     astichartjs.BorderColor(astichartjs.ChartColorBlue),
+				BorderWidth:     1,
+			}},
+		},
+		Options: astichartjs.Options{
+			Responsive: true,
+			Scales: astichartjs.Scales{
+				XAxes: []astichartjs.Axis{},
+				YAxes: []astichartjs.Axis{{
+					ScaleLabel: astichartjs.ScaleLabel{
+						Display:     true,
+						LabelString: "Balance(" + currency + ")",
+					},
+				}},
+			},
+			Title: astichartjs.Title{
+				Display:  true,
+				FontSize: 16,
+				Text:     "Balance over time",
+			},
+		},
+		Type: astichartjs.ChartTypeLine,
+	}
+
+	// Loop through operations
+	var ops []*Operation
+	var bs []Money
+	if ops, bs, err = a.RunningBalances(); err != nil {
+		err = errors.Wrap(err, "computing running balances failed")
+		return
+	}
+	for idx, o := range ops {
+		// Only the last operation of the day is kept
+		if idx < len(ops)-1 && ops[idx+1].Date.Equal(o.Date) {
+			continue
+		}
+
+		// Convert
+		var b Money
+		if b, err = rs.convert(bs[idx], currency, o.Date); err != nil {
+			err = errors.Wrapf(err, "converting balance at %s failed", o.Date.Format("2006-01-02"))
+			return
+		}
+
+		// Add to dataset
+		c.Data.Labels = append(c.Data.Labels, o.Date.Format("2006-01-02"))
+		c.Data.Datasets[0].Data = append(c.Data.Datasets[0].Data, b.Float64())
 	}
 	return
 }
 
 // buildChartMonthlySum builds the monthly sum chart
 // d  is indexed by date then by subject
-func buildChartMonthlySum(category string, dates []string, d map[string]map[string]float64) (c astichartjs.Chart) {
+func buildChartMonthlySum(category, currency string, dates []string, d map[string]map[string]Money) (c astichartjs.Chart) {
 	// Init
 	c = astichartjs.Chart{
 		Data: astichartjs.Data{
@@ -221,7 +351,7 @@ func buildChartMonthlySum(category string, dates []string, d map[string]map[stri
 				YAxes: []astichartjs.Axis{{
 					ScaleLabel: astichartjs.ScaleLabel{
 						Display:     true,
-						LabelString: "Sum(€)",
+						LabelString: "Sum(" + currency + ")",
 					},
 					Stacked: true,
 				}},
@@ -264,7 +394,7 @@ func buildChartMonthlySum(category string, dates []string, d map[string]map[stri
 			if _, ok := d[date][subject]; !ok {
 				dataset.Data = append(dataset.Data, 0)
 			} else {
-				dataset.Data = append(dataset.Data, d[date][subject])
+				dataset.Data = append(dataset.Data, d[date][subject].Float64())
 			}
 		}
 	}
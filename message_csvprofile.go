@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/asticode/go-astilectron"
+	"github.com/asticode/go-astilectron/bootstrap"
+	"github.com/pkg/errors"
+)
+
+// PayloadCSVProfiles represents the payload containing CSV profiles
+type PayloadCSVProfiles struct {
+	Profiles []csvProfile `json:"profiles"`
+}
+
+// handleMessageCSVProfilesList handles the "csvprofiles.list" message
+func handleMessageCSVProfilesList(w *astilectron.Window) {
+	// Process errors
+	var err error
+	defer processMessageError(w, &err)
+
+	// Load
+	var ps []csvProfile
+	if ps, err = loadCSVProfiles(csvProfilesPath(dataDirPath)); err != nil {
+		err = errors.Wrap(err, "loading CSV profiles failed")
+		return
+	}
+
+	// Send
+	if err = w.Send(bootstrap.MessageOut{Name: "csvprofiles.list", Payload: PayloadCSVProfiles{Profiles: ps}}); err != nil {
+		err = errors.Wrap(err, "sending message failed")
+		return
+	}
+}
+
+// handleMessageCSVProfilesSave handles the "csvprofiles.save" message
+// A profile with the same name is replaced
+func handleMessageCSVProfilesSave(w *astilectron.Window, m bootstrap.MessageIn) {
+	// Process errors
+	var err error
+	defer processMessageError(w, &err)
+
+	// Unmarshal
+	var p csvProfile
+	if err = json.Unmarshal(m.Payload, &p); err != nil {
+		err = errors.Wrapf(err, "unmarshaling %s failed", m.Payload)
+		return
+	}
+
+	// Validate
+	if err = p.validate(); err != nil {
+		err = errors.Wrapf(err, "validating CSV profile %s failed", p.Name)
+		return
+	}
+
+	// Load
+	var path = csvProfilesPath(dataDirPath)
+	var ps []csvProfile
+	if ps, err = loadCSVProfiles(path); err != nil {
+		err = errors.Wrap(err, "loading CSV profiles failed")
+		return
+	}
+
+	// Set
+	var found bool
+	for idx := range ps {
+		if ps[idx].Name == p.Name {
+			ps[idx] = p
+			found = true
+			break
+		}
+	}
+	if !found {
+		ps = append(ps, p)
+	}
+
+	// Save
+	if err = saveCSVProfiles(path, ps); err != nil {
+		err = errors.Wrap(err, "saving CSV profiles failed")
+		return
+	}
+
+	// Send
+	if err = w.Send(bootstrap.MessageOut{Name: "csvprofiles.save", Payload: PayloadCSVProfiles{Profiles: ps}}); err != nil {
+		err = errors.Wrap(err, "sending message failed")
+		return
+	}
+}
+
+// handleMessageCSVProfilesDelete handles the "csvprofiles.delete" message
+func handleMessageCSVProfilesDelete(w *astilectron.Window, m bootstrap.MessageIn) {
+	// Process errors
+	var err error
+	defer processMessageError(w, &err)
+
+	// Unmarshal
+	var name string
+	if err = json.Unmarshal(m.Payload, &name); err != nil {
+		err = errors.Wrapf(err, "unmarshaling %s failed", m.Payload)
+		return
+	}
+
+	// Load
+	var path = csvProfilesPath(dataDirPath)
+	var ps []csvProfile
+	if ps, err = loadCSVProfiles(path); err != nil {
+		err = errors.Wrap(err, "loading CSV profiles failed")
+		return
+	}
+
+	// Delete
+	var found bool
+	for idx := range ps {
+		if ps[idx].Name == name {
+			ps = append(ps[:idx], ps[idx+1:]...)
+			found = true
+			break
+		}
+	}
+	if !found {
+		err = fmt.Errorf("unknown CSV profile %s", name)
+		return
+	}
+
+	// Save
+	if err = saveCSVProfiles(path, ps); err != nil {
+		err = errors.Wrap(err, "saving CSV profiles failed")
+		return
+	}
+
+	// Send
+	if err = w.Send(bootstrap.MessageOut{Name: "csvprofiles.delete", Payload: PayloadCSVProfiles{Profiles: ps}}); err != nil {
+		err = errors.Wrap(err, "sending message failed")
+		return
+	}
+}
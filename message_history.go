@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/asticode/go-astilectron"
+	"github.com/asticode/go-astilectron/bootstrap"
+	"github.com/pkg/errors"
+)
+
+// handleMessageHistoryRedo handles the "history.redo" message
+func handleMessageHistoryRedo(w *astilectron.Window) {
+	// Process errors
+	var err error
+	defer processMessageError(w, &err)
+
+	// Redo
+	var e historyEntry
+	if e, err = data.Redo(); err != nil {
+		err = errors.Wrap(err, "redoing failed")
+		return
+	}
+
+	// Send
+	if err = w.Send(bootstrap.MessageOut{Name: "history.redo", Payload: e}); err != nil {
+		err = errors.Wrap(err, "sending message failed")
+		return
+	}
+}
+
+// handleMessageHistoryUndo handles the "history.undo" message
+func handleMessageHistoryUndo(w *astilectron.Window) {
+	// Process errors
+	var err error
+	defer processMessageError(w, &err)
+
+	// Undo
+	var e historyEntry
+	if e, err = data.Undo(); err != nil {
+		err = errors.Wrap(err, "undoing failed")
+		return
+	}
+
+	// Send
+	if err = w.Send(bootstrap.MessageOut{Name: "history.undo", Payload: e}); err != nil {
+		err = errors.Wrap(err, "sending message failed")
+		return
+	}
+}
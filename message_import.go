@@ -1,36 +1,168 @@
 package main
 
 import (
-	"bytes"
-	"encoding/csv"
+	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"strconv"
 	"strings"
 	"time"
 
-	"path/filepath"
-
-	"encoding/json"
-
 	"github.com/asticode/go-astilectron"
 	"github.com/asticode/go-astilectron/bootstrap"
-	"github.com/asticode/go-astilog"
 	"github.com/pkg/errors"
 )
 
-// Vars
-var (
-	bytesLineSeparator = []byte("\r\n")
-)
-
 // PayloadOperation represents a payload containing an operation and its account
+// Batch groups the operations of an import so that they're undone together
+// PossibleDuplicates are operations of the account that may be the same operation, which is up to the user to decide
 type PayloadOperation struct {
-	Account   *Account   `json:"account"`
-	Operation *Operation `json:"operation"`
+	Account            *Account     `json:"account"`
+	Batch              string       `json:"batch,omitempty"`
+	Operation          *Operation   `json:"operation"`
+	PossibleDuplicates []*Operation `json:"possible_duplicates,omitempty"`
+}
+
+// PayloadImport represents the payload containing the result of an import
+// Operations are the operations waiting in the inboxes, including the ones of previous imports
+type PayloadImport struct {
+	Batch      string                   `json:"batch"`
+	Operations []PayloadOperation       `json:"operations"`
+	Statements []PayloadImportStatement `json:"statements"`
+}
+
+// PayloadImportCommit represents the payload containing the reviewed operations of an import
+type PayloadImportCommit struct {
+	Batch      string             `json:"batch"`
+	Operations []PayloadOperation `json:"operations"`
+}
+
+// PayloadImportStatement represents a payload containing what has been detected about an imported statement
+// Duplicates is the number of operations that have been skipped since they've already been imported
+// Errors are the lines whose operations are missing since they couldn't be parsed
+type PayloadImportStatement struct {
+	AccountID  string      `json:"account_id"`
+	Duplicates int         `json:"duplicates"`
+	Errors     []lineError `json:"errors"`
+	Format     string      `json:"format"`
+	Path       string      `json:"path"`
+	Text       textInfo    `json:"text"`
+}
+
+// PayloadImportPreview represents the payload containing what an import would do
+type PayloadImportPreview struct {
+	Files []PayloadImportFile `json:"files"`
+}
+
+// PayloadImportFile represents a payload containing what an import would do with a file
+// Error is set when the file can't be imported at all, in which case the other fields are empty
+// NewAccount is true when the account of the statement doesn't exist yet
+type PayloadImportFile struct {
+	AccountID  string             `json:"account_id,omitempty"`
+	Duplicates []*Operation       `json:"duplicates"`
+	Error      string             `json:"error,omitempty"`
+	Errors     []lineError        `json:"errors"`
+	Format     string             `json:"format,omitempty"`
+	NewAccount bool               `json:"new_account"`
+	Operations []PayloadOperation `json:"operations"`
+	Path       string             `json:"path"`
+	Text       textInfo           `json:"text"`
+}
+
+// importFile represents an imported file whose operations have been sorted out
+// Account is the account in data when it exists and the account of the statement otherwise
+type importFile struct {
+	account    *Account
+	duplicates []*Operation
+	err        error
+	newAccount bool
+	operations []PayloadOperation
+	path       string
+	statement  bankStatement
+}
+
+// readImportFiles parses the statements of files and sorts out their new operations from their duplicates
+// Data is not modified. Operations of previous files are taken into account since statements may overlap.
+func readImportFiles(is []Importer, paths []string, batch string) (fs []importFile) {
+	var accounts = make(map[string]*Account)
+	var externalIDs, fingerprints = make(map[string]map[string]bool), make(map[string]map[string]bool)
+	for _, p := range paths {
+		// Parse bank statement
+		var f = importFile{path: p}
+		if f.statement, f.err = parseBankStatement(is, p); f.err != nil {
+			f.err = errors.Wrapf(f.err, "parsing bank statement %s failed", p)
+			fs = append(fs, f)
+			continue
+		}
+		var s = f.statement
+
+		// Fetch account
+		// Accounts that don't exist yet are shared by the files of the import
+		var a, ok = accounts[s.Account.ID]
+		if !ok {
+			var errOne error
+			if a, errOne = data.Accounts.One(s.Account.ID); errOne != nil {
+				a = s.Account
+			}
+			accounts[a.ID] = a
+		}
+		f.account, f.newAccount = a, a == s.Account
+
+		// Fingerprint operations
+		setFingerprints(s.Operations)
+
+		// Index operations of the account
+		// Operations waiting in its inbox are indexed as well so that they're not imported twice
+		if _, ok := fingerprints[a.ID]; !ok {
+			var i inbox
+			if i, f.err = data.Inbox(a.ID); f.err != nil {
+				f.err = errors.Wrapf(f.err, "fetching inbox of account %s failed", a.ID)
+				fs = append(fs, f)
+				continue
+			}
+			var ops = a.Operations.All()
+			for _, o := range i.Operations {
+				ops = append(ops, o.Operation)
+			}
+			externalIDs[a.ID], fingerprints[a.ID] = make(map[string]bool), make(map[string]bool)
+			for _, o := range ops {
+				if o.ExternalID != "" {
+					externalIDs[a.ID][o.ExternalID] = true
+				}
+				fingerprints[a.ID][o.Fingerprint] = true
+			}
+		}
+
+		// Sort out operations
+		// Operations that have already been imported are duplicates whatever their date, which allows importing
+		// overlapping date ranges as well as operations that were missing
+		var ops = a.Operations.All()
+		for _, op := range s.Operations {
+			// Duplicate
+			if (op.ExternalID != "" && externalIDs[a.ID][op.ExternalID]) || fingerprints[a.ID][op.Fingerprint] {
+				f.duplicates = append(f.duplicates, op)
+				continue
+			}
+
+			// Index
+			if op.ExternalID != "" {
+				externalIDs[a.ID][op.ExternalID] = true
+			}
+			fingerprints[a.ID][op.Fingerprint] = true
+
+			// Add
+			f.operations = append(f.operations, PayloadOperation{
+				Account:            a,
+				Batch:              batch,
+				Operation:          op,
+				PossibleDuplicates: possibleDuplicates(ops, op),
+			})
+		}
+		fs = append(fs, f)
+	}
+	return
 }
 
 // handleMessageImport handles the "import" message
+// New operations are added to the inboxes of their accounts where they wait to be reviewed
 func handleMessageImport(w *astilectron.Window, m bootstrap.MessageIn) {
 	// Process errors
 	var err error
@@ -43,133 +175,224 @@ func handleMessageImport(w *astilectron.Window, m bootstrap.MessageIn) {
 		return
 	}
 
-	// Loop in paths
-	var po = []PayloadOperation{}
-	for _, p := range ps {
-		// Parse bank statement
-		var a *Account
-		var ops []*Operation
-		if a, ops, err = parseBankStatement(p); err != nil {
-			err = errors.Wrapf(err, "parsing bank statement %s failed", p)
+	// Load importers
+	var is []Importer
+	if is, err = loadImporters(csvProfilesPath(dataDirPath)); err != nil {
+		err = errors.Wrap(err, "loading importers failed")
+		return
+	}
+
+	// Read files
+	var batch = fmt.Sprintf("import-%d", time.Now().UnixNano())
+	var fs = readImportFiles(is, ps, batch)
+	for _, f := range fs {
+		if f.err != nil {
+			err = f.err
 			return
 		}
+	}
 
-		// Set account
-		a = data.Accounts.Set(a)
-		a.UpdatedAt = time.Now()
+	// Loop through files
+	var pi = PayloadImport{
+		Batch:      batch,
+		Operations: []PayloadOperation{},
+		Statements: []PayloadImportStatement{},
+	}
+	var ss []inboxStatement
+	for _, f := range fs {
+		// Add inbox statement
+		var s = inboxStatement{account: f.account}
+		for _, po := range f.operations {
+			s.operations = append(s.operations, po.Operation)
+		}
+		if !f.statement.NoBalance {
+			var rp = newReconciliationPoint(f.statement)
+			s.point = &rp
+		}
+		ss = append(ss, s)
 
-		// Get last operation
-		var lo = a.Operations.Last()
+		// Add statement
+		pi.Statements = append(pi.Statements, PayloadImportStatement{
+			AccountID:  f.account.ID,
+			Duplicates: len(f.duplicates),
+			Errors:     f.statement.Errors,
+			Format:     f.statement.Format,
+			Path:       f.path,
+			Text:       f.statement.Text,
+		})
+	}
 
-		// Add operations
-		for _, op := range ops {
-			if lo == nil || !op.Date.Before(lo.Date) {
-				po = append(po, PayloadOperation{Account: a, Operation: op})
-			}
-		}
+	// Add operations to inboxes
+	if err = data.AddToInbox(ss, batch); err != nil {
+		err = errors.Wrap(err, "adding operations to inboxes failed")
+		return
+	}
+
+	// List inboxes
+	if pi.Operations, err = inboxOperations(); err != nil {
+		err = errors.Wrap(err, "listing inbox operations failed")
+		return
 	}
 
 	// Send
-	if err = w.Send(bootstrap.MessageOut{Name: "import", Payload: po}); err != nil {
+	if err = w.Send(bootstrap.MessageOut{Name: "import", Payload: pi}); err != nil {
 		err = errors.Wrap(err, "sending message failed")
 		return
 	}
 }
 
-// parseBankStatement parses a bank statement
-func parseBankStatement(path string) (a *Account, ops []*Operation, err error) {
-	// Log
-	astilog.Debugf("Parsing bank statement %s", path)
+// handleMessageImportCommit handles the "import.commit" message
+// Operations are the reviewed operations of an import, the other operations of the import waiting in the inboxes
+// having been skipped. Only their subject, category and label may have been changed by the user.
+func handleMessageImportCommit(w *astilectron.Window, m bootstrap.MessageIn) {
+	// Process errors
+	var err error
+	defer processMessageError(w, &err)
 
-	// Check file extension
-	if filepath.Ext(path) != ".csv" {
-		err = fmt.Errorf("invalid extension for %s", path)
+	// Unmarshal
+	var pc PayloadImportCommit
+	if err = json.Unmarshal(m.Payload, &pc); err != nil {
+		err = errors.Wrapf(err, "unmarshaling %s failed", m.Payload)
 		return
 	}
 
-	// Open file
-	var b []byte
-	if b, err = ioutil.ReadFile(path); err != nil {
-		err = errors.Wrapf(err, "opening %s failed", path)
-		return
+	// Index reviewed operations
+	var accepted = make(map[string]map[string]*Operation)
+	for _, po := range pc.Operations {
+		// Check input
+		if po.Account == nil || po.Operation == nil {
+			err = errors.New("Account and operation are required")
+			return
+		}
+		if err = checkOperationInput(po.Operation); err != nil {
+			return
+		}
+
+		// Index
+		if _, ok := accepted[po.Account.ID]; !ok {
+			accepted[po.Account.ID] = make(map[string]*Operation)
+		}
+		accepted[po.Account.ID][po.Operation.Fingerprint] = po.Operation
 	}
 
-	// Split header from body
-	var items = bytes.Split(b, append(bytesLineSeparator, bytesLineSeparator...))
-	if len(items) == 1 {
-		err = fmt.Errorf("no body detected in content %s", b)
+	// Fetch inboxes
+	var is map[string]inbox
+	if is, err = data.Inboxes(); err != nil {
+		err = errors.Wrap(err, "fetching inboxes failed")
 		return
 	}
 
-	// Build header csv reader
-	var hr = csv.NewReader(bytes.NewReader(items[0]))
-	hr.Comma = ';'
-	hr.FieldsPerRecord = 2
+	// Check reviewed operations are part of the import
+	for id, ops := range accepted {
+		for f, o := range ops {
+			if i, ok := is[id]; !ok || i.index(f) < 0 || i.Operations[i.index(f)].Batch != pc.Batch {
+				err = fmt.Errorf("operation %s is not part of import %s", o.RawLabel, pc.Batch)
+				return
+			}
+		}
+	}
 
-	// Read header lines
-	var lines [][]string
-	if lines, err = hr.ReadAll(); err != nil {
-		err = errors.Wrapf(err, "reading header lines of %s failed", path)
-		return
+	// Build reviews
+	var rs []inboxReview
+	for id, i := range is {
+		var r = inboxReview{AccountID: id}
+		for _, o := range i.Operations {
+			if o.Batch != pc.Batch {
+				continue
+			}
+			if a, ok := accepted[id][o.Operation.Fingerprint]; ok {
+				r.Accepted = append(r.Accepted, a)
+			} else {
+				r.Skipped = append(r.Skipped, o.Operation.Fingerprint)
+			}
+		}
+		if len(r.Accepted) > 0 || len(r.Skipped) > 0 {
+			rs = append(rs, r)
+		}
 	}
-	if len(lines) < 6 {
-		err = fmt.Errorf("not enough lines in header %s", items[0])
+
+	// Review
+	var s importSummary
+	if s, err = data.ReviewInbox(rs, pc.Batch); err != nil {
+		err = errors.Wrapf(err, "committing import %s failed", pc.Batch)
 		return
 	}
 
-	// Parse account fields
-	a = newAccount()
-	a.ID = fmt.Sprintf("%s %s", lines[1][1], lines[0][1])
-	if a.Balance, err = strconv.ParseFloat(strings.Replace(lines[4][1], ",", ".", -1), 64); err != nil {
-		err = fmt.Errorf("%s is not a valid float", lines[4][1])
+	// Send
+	if err = w.Send(bootstrap.MessageOut{Name: "import.commit", Payload: s}); err != nil {
+		err = errors.Wrap(err, "sending message failed")
 		return
 	}
+}
 
-	// Build body csv reader
-	var br = csv.NewReader(bytes.NewReader(items[1]))
-	br.Comma = ';'
-	br.FieldsPerRecord = 4
+// handleMessageImportPreview handles the "import.preview" message
+// Files are parsed as they would be imported but nothing is modified and files that can't be imported are reported
+// instead of failing the whole preview
+func handleMessageImportPreview(w *astilectron.Window, m bootstrap.MessageIn) {
+	// Process errors
+	var err error
+	defer processMessageError(w, &err)
 
-	// Read body lines
-	br.Read()
-	if lines, err = br.ReadAll(); err != nil {
-		err = errors.Wrapf(err, "reading body lines of %s failed", path)
+	// Unmarshal
+	var ps []string
+	if err = json.Unmarshal(m.Payload, &ps); err != nil {
+		err = errors.Wrapf(err, "unmarshaling %s failed", m.Payload)
 		return
 	}
 
-	// Loop through lines
-	for i := len(lines) - 1; i >= 0; i-- {
-		// Init
-		var op = &Operation{RawLabel: lines[i][1]}
+	// Load importers
+	var is []Importer
+	if is, err = loadImporters(csvProfilesPath(dataDirPath)); err != nil {
+		err = errors.Wrap(err, "loading importers failed")
+		return
+	}
 
-		// Parse date
-		if op.Date, err = time.Parse("02/01/2006", lines[i][0]); err != nil {
-			err = fmt.Errorf("%s is not a valid date", lines[i][0])
-			return
+	// Loop through files
+	var pp = PayloadImportPreview{Files: []PayloadImportFile{}}
+	for _, f := range readImportFiles(is, ps, "") {
+		// File can't be imported
+		var pf = PayloadImportFile{
+			Duplicates: []*Operation{},
+			Errors:     []lineError{},
+			Operations: []PayloadOperation{},
+			Path:       f.path,
 		}
-
-		// Parse amount
-		if op.Amount, err = strconv.ParseFloat(strings.Replace(lines[i][2], ",", ".", -1), 64); err != nil {
-			err = fmt.Errorf("%s is not a valid float", lines[i][2])
-			return
+		if f.err != nil {
+			pf.Error = f.err.Error()
+			pp.Files = append(pp.Files, pf)
+			continue
 		}
 
-		// Update account balance
-		a.Balance -= op.Amount
+		// Add file
+		pf.AccountID = f.account.ID
+		pf.Duplicates = append(pf.Duplicates, f.duplicates...)
+		pf.Errors = append(pf.Errors, f.statement.Errors...)
+		pf.Format = f.statement.Format
+		pf.NewAccount = f.newAccount
+		pf.Operations = append(pf.Operations, f.operations...)
+		pf.Text = f.statement.Text
+		pp.Files = append(pp.Files, pf)
+	}
 
-		// Parse raw label
-		op.Subject = parseRawLabel(op.RawLabel)
-		if c, ok := mappingSubjectToCategory[op.Subject]; ok {
-			op.Category = c
-		}
-		if l, ok := mappingSubjectToLabel[op.Subject]; ok {
-			op.Label = l
-		}
+	// Send
+	if err = w.Send(bootstrap.MessageOut{Name: "import.preview", Payload: pp}); err != nil {
+		err = errors.Wrap(err, "sending message failed")
+		return
+	}
+}
 
-		// Add operation
-		ops = append(ops, op)
+// parseCurrency parses the currency an account is held in
+// Statements name it in plain words such as "euros"
+func parseCurrency(s string) string {
+	switch c := strings.ToUpper(strings.TrimSpace(s)); c {
+	case "EURO", "EUROS":
+		return "EUR"
+	default:
+		if validCurrency(c) {
+			return c
+		}
+		return currencyDefault
 	}
-	return
 }
 
 // parseRawLabel parses a raw label
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadImportFiles(t *testing.T) {
+	// Create data
+	data = newTestData(t)
+	defer func() { data = nil }()
+
+	// Add operations
+	var a = newAccount()
+	a.ID = "Bank"
+	a.setDefaults()
+	var ops = []*Operation{
+		{Amount: Money{Currency: a.Currency, Units: -100000}, Date: time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC), ExternalID: "R1", RawLabel: "Shop"},
+		{Amount: Money{Currency: a.Currency, Units: -50000}, Date: time.Date(2018, 1, 3, 0, 0, 0, 0, time.UTC), RawLabel: "Bakery Paris"},
+	}
+	setFingerprints(ops)
+	data.mutex.Lock()
+	_, err := data.commitImport([]importCommit{{account: a, operations: ops}}, "", nil)
+	data.mutex.Unlock()
+	if err != nil {
+		t.Fatalf("committing import failed: %v", err)
+	}
+
+	// Write statements
+	// The second one overlaps with the first one
+	var dir = t.TempDir()
+	var paths []string
+	for idx, c := range []string{
+		"Ref;Date;Label;Amount\nR1;02/01/2018;Shop renamed;-10\n;03/01/2018;BAKERY - paris;-5\n;04/01/2018;Coffee;-2\n;04/01/2018;Coffee;-2\n",
+		"Ref;Date;Label;Amount\n;04/01/2018;Coffee;-2\n;04/01/2018;Coffee;-2\n;04/01/2018;Coffee;-2\n;05/01/2018;Rent;-500\n",
+	} {
+		var p = filepath.Join(dir, string(rune('a'+idx))+".csv")
+		if err = ioutil.WriteFile(p, []byte(c), 0600); err != nil {
+			t.Fatalf("writing %s failed: %v", p, err)
+		}
+		paths = append(paths, p)
+	}
+
+	// Read
+	var p = testCSVProfile()
+	p.Columns.ExternalID = "Ref"
+	var fs = readImportFiles([]Importer{csvImporter{p: p}}, paths, "batch")
+	if len(fs) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(fs))
+	}
+	for idx, c := range []struct {
+		duplicates []string
+		operations []string
+	}{
+		{
+			duplicates: []string{"Shop renamed", "BAKERY - paris"},
+			operations: []string{"Coffee", "Coffee"},
+		},
+		{
+			duplicates: []string{"Coffee", "Coffee"},
+			operations: []string{"Coffee", "Rent"},
+		},
+	} {
+		var f = fs[idx]
+		if f.err != nil {
+			t.Fatalf("file #%d: reading failed: %v", idx+1, f.err)
+		} else if f.newAccount || f.account.ID != a.ID {
+			t.Errorf("file #%d: expected existing account %s, got account %s", idx+1, a.ID, f.account.ID)
+		}
+		var ds, ns []string
+		for _, o := range f.duplicates {
+			ds = append(ds, o.RawLabel)
+		}
+		for _, o := range f.operations {
+			ns = append(ns, o.Operation.RawLabel)
+		}
+		if !equalStrings(ds, c.duplicates) || !equalStrings(ns, c.operations) {
+			t.Errorf("file #%d: expected duplicates %v and operations %v, got %v and %v", idx+1, c.duplicates, c.operations, ds, ns)
+		}
+	}
+}
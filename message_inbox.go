@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/asticode/go-astilectron"
+	"github.com/asticode/go-astilectron/bootstrap"
+	"github.com/pkg/errors"
+)
+
+// PayloadInbox represents the payload containing the operations waiting in the inboxes
+type PayloadInbox struct {
+	Operations []PayloadOperation `json:"operations"`
+}
+
+// inboxOperations returns the operations waiting in the inboxes sorted by account
+// The account of an operation is the account of the statement when it doesn't exist yet
+func inboxOperations() (pos []PayloadOperation, err error) {
+	// Fetch inboxes
+	var is map[string]inbox
+	if is, err = data.Inboxes(); err != nil {
+		err = errors.Wrap(err, "fetching inboxes failed")
+		return
+	}
+
+	// Sort accounts
+	var ids []string
+	for id := range is {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	// Loop through accounts
+	pos = []PayloadOperation{}
+	for _, id := range ids {
+		// Fetch account
+		var a = is[id].Account
+		if a == nil {
+			if a, err = data.Accounts.One(id); err != nil {
+				err = errors.Wrapf(err, "fetching account %s failed", id)
+				return
+			}
+		}
+
+		// Loop through operations
+		var ops = a.Operations.All()
+		for _, o := range is[id].Operations {
+			pos = append(pos, PayloadOperation{
+				Account:            a,
+				Batch:              o.Batch,
+				Operation:          o.Operation,
+				PossibleDuplicates: possibleDuplicates(ops, o.Operation),
+			})
+		}
+	}
+	return
+}
+
+// handleMessageInboxList handles the "inbox.list" message
+func handleMessageInboxList(w *astilectron.Window) {
+	// Process errors
+	var err error
+	defer processMessageError(w, &err)
+
+	// List operations
+	var p = PayloadInbox{}
+	if p.Operations, err = inboxOperations(); err != nil {
+		err = errors.Wrap(err, "listing inbox operations failed")
+		return
+	}
+
+	// Send
+	if err = w.Send(bootstrap.MessageOut{Name: "inbox.list", Payload: p}); err != nil {
+		err = errors.Wrap(err, "sending message failed")
+		return
+	}
+}
+
+// handleMessageInboxAccept handles the "inbox.accept" message
+// Only the subject, category and label of the operation may have been changed by the user
+func handleMessageInboxAccept(w *astilectron.Window, m bootstrap.MessageIn) {
+	// Process errors
+	var err error
+	defer processMessageError(w, &err)
+
+	// Unmarshal
+	var po PayloadOperation
+	if err = json.Unmarshal(m.Payload, &po); err != nil {
+		err = errors.Wrapf(err, "unmarshaling %s failed", m.Payload)
+		return
+	}
+
+	// Check input
+	if po.Account == nil || po.Operation == nil {
+		err = errors.New("Account and operation are required")
+		return
+	}
+	if err = checkOperationInput(po.Operation); err != nil {
+		return
+	}
+
+	// Review
+	// Operations accepted one by one are undone together with the other operations of their import
+	var s importSummary
+	if s, err = data.ReviewInbox([]inboxReview{{AccountID: po.Account.ID, Accepted: []*Operation{po.Operation}}}, po.Batch); err != nil {
+		err = errors.Wrapf(err, "accepting operation of account %s failed", po.Account.ID)
+		return
+	}
+
+	// Send
+	if err = w.Send(bootstrap.MessageOut{Name: "inbox.accept", Payload: s}); err != nil {
+		err = errors.Wrap(err, "sending message failed")
+		return
+	}
+}
+
+// handleMessageInboxAcceptAll handles the "inbox.acceptAll" message
+// Every operation waiting in the inbox of the account is accepted as it is
+func handleMessageInboxAcceptAll(w *astilectron.Window, m bootstrap.MessageIn) {
+	// Process errors
+	var err error
+	defer processMessageError(w, &err)
+
+	// Unmarshal
+	var id string
+	if err = json.Unmarshal(m.Payload, &id); err != nil {
+		err = errors.Wrapf(err, "unmarshaling %s failed", m.Payload)
+		return
+	}
+
+	// Review
+	var s importSummary
+	if s, err = data.ReviewInbox([]inboxReview{{AccountID: id, All: true}}, fmt.Sprintf("inbox-%d", time.Now().UnixNano())); err != nil {
+		err = errors.Wrapf(err, "accepting operations of account %s failed", id)
+		return
+	}
+
+	// Send
+	if err = w.Send(bootstrap.MessageOut{Name: "inbox.acceptAll", Payload: s}); err != nil {
+		err = errors.Wrap(err, "sending message failed")
+		return
+	}
+}
+
+// handleMessageInboxSkip handles the "inbox.skip" message
+func handleMessageInboxSkip(w *astilectron.Window, m bootstrap.MessageIn) {
+	// Process errors
+	var err error
+	defer processMessageError(w, &err)
+
+	// Unmarshal
+	var po PayloadOperation
+	if err = json.Unmarshal(m.Payload, &po); err != nil {
+		err = errors.Wrapf(err, "unmarshaling %s failed", m.Payload)
+		return
+	}
+
+	// Check input
+	if po.Account == nil || po.Operation == nil {
+		err = errors.New("Account and operation are required")
+		return
+	}
+
+	// Review
+	var s importSummary
+	if s, err = data.ReviewInbox([]inboxReview{{AccountID: po.Account.ID, Skipped: []string{po.Operation.Fingerprint}}}, po.Batch); err != nil {
+		err = errors.Wrapf(err, "skipping operation of account %s failed", po.Account.ID)
+		return
+	}
+
+	// Send
+	if err = w.Send(bootstrap.MessageOut{Name: "inbox.skip", Payload: s}); err != nil {
+		err = errors.Wrap(err, "sending message failed")
+		return
+	}
+}
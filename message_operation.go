@@ -9,6 +9,20 @@ import (
 	"github.com/pkg/errors"
 )
 
+// checkOperationInput checks the fields of an operation that are filled in by the user
+func checkOperationInput(o *Operation) error {
+	if o.Subject == "" {
+		return errors.New("Subject is required")
+	}
+	if o.Category == "" {
+		return errors.New("Category is required")
+	}
+	if o.Label == "" {
+		return errors.New("Label is required")
+	}
+	return nil
+}
+
 // handleMessageOperationsAdd handles the "operations.add" message=
 func handleMessageOperationsAdd(w *astilectron.Window, m bootstrap.MessageIn) {
 	// Process errors
@@ -30,31 +44,71 @@ func handleMessageOperationsAdd(w *astilectron.Window, m bootstrap.MessageIn) {
 	}
 
 	// Check input
-	if po.Operation.Subject == "" {
-		err = errors.New("Subject is required")
+	if err = checkOperationInput(po.Operation); err != nil {
+		return
+	}
+
+	// Add operation
+	if err = data.AddOperation(a, po.Operation, po.Batch); err != nil {
+		err = errors.Wrap(err, "adding operation failed")
 		return
 	}
-	if po.Operation.Category == "" {
-		err = errors.New("Category is required")
+
+	// Send
+	if err = w.Send(bootstrap.MessageOut{Name: "operations.add"}); err != nil {
+		err = errors.Wrap(err, "sending message failed")
 		return
 	}
-	if po.Operation.Label == "" {
-		err = errors.New("Label is required")
+}
+
+// handleMessageOperationsDelete handles the "operations.delete" message
+func handleMessageOperationsDelete(w *astilectron.Window, m bootstrap.MessageIn) {
+	// Process errors
+	var err error
+	defer processMessageError(w, &err)
+
+	// Unmarshal
+	var po PayloadOperation
+	if err = json.Unmarshal(m.Payload, &po); err != nil {
+		err = errors.Wrapf(err, "unmarshaling %s failed", m.Payload)
 		return
 	}
 
-	// Add operation
-	a.Operations.Add(po.Operation)
-	a.Balance += po.Operation.Amount
+	// Fetch account
+	var a *Account
+	if a, err = data.Accounts.One(po.Account.ID); err != nil {
+		err = errors.Wrapf(err, "fetching account %s failed", po.Account.ID)
+		return
+	}
+
+	// Fetch operation
+	var o *Operation
+	if o, err = a.Operations.One(po.Operation.ID); err != nil {
+		err = errors.Wrapf(err, "fetching operation %d failed", po.Operation.ID)
+		return
+	}
+
+	// Delete operation
+	if err = data.DeleteOperation(a, o); err != nil {
+		err = errors.Wrapf(err, "deleting operation %d failed", o.ID)
+		return
+	}
 
 	// Send
-	if err = w.Send(bootstrap.MessageOut{Name: "operations.add"}); err != nil {
+	if err = w.Send(bootstrap.MessageOut{Name: "operations.delete"}); err != nil {
 		err = errors.Wrap(err, "sending message failed")
 		return
 	}
 }
 
+// PayloadOperationListed represents an operation along with the balance of its account right after it
+type PayloadOperationListed struct {
+	*Operation
+	Balance Money `json:"balance"`
+}
+
 // handleMessageOperationsList handles the "operations.list" message
+// Operations are sorted by date
 func handleMessageOperationsList(w *astilectron.Window, m bootstrap.MessageIn) {
 	// Process errors
 	var err error
@@ -75,8 +129,20 @@ func handleMessageOperationsList(w *astilectron.Window, m bootstrap.MessageIn) {
 	}
 	a.UpdatedAt = time.Now()
 
+	// Build payload
+	var ops []*Operation
+	var bs []Money
+	if ops, bs, err = a.RunningBalances(); err != nil {
+		err = errors.Wrapf(err, "computing running balances of account %s failed", pa)
+		return
+	}
+	var p = []PayloadOperationListed{}
+	for idx, o := range ops {
+		p = append(p, PayloadOperationListed{Balance: bs[idx], Operation: o})
+	}
+
 	// Send
-	if err = w.Send(bootstrap.MessageOut{Name: "operations.list", Payload: a.Operations.All()}); err != nil {
+	if err = w.Send(bootstrap.MessageOut{Name: "operations.list", Payload: p}); err != nil {
 		err = errors.Wrap(err, "sending message failed")
 		return
 	}
@@ -105,7 +171,7 @@ func handleMessageOperationsOne(w *astilectron.Window, m bootstrap.MessageIn) {
 	// Fetch operation
 	var o *Operation
 	if o, err = a.Operations.One(po.Operation.ID); err != nil {
-		err = errors.Wrapf(err, "fetching operation %s failed", po.Operation.ID)
+		err = errors.Wrapf(err, "fetching operation %d failed", po.Operation.ID)
 		return
 	}
 
@@ -139,12 +205,15 @@ func handleMessageOperationsUpdate(w *astilectron.Window, m bootstrap.MessageIn)
 	// Fetch operation
 	var o *Operation
 	if o, err = a.Operations.One(po.Operation.ID); err != nil {
-		err = errors.Wrapf(err, "fetching operation %s failed", po.Operation.ID)
+		err = errors.Wrapf(err, "fetching operation %d failed", po.Operation.ID)
 		return
 	}
 
 	// Update operation
-	*o = *po.Operation
+	if err = data.UpdateOperation(a, o, po.Operation); err != nil {
+		err = errors.Wrapf(err, "updating operation %d failed", o.ID)
+		return
+	}
 
 	// Send
 	if err = w.Send(bootstrap.MessageOut{Name: "operations.update"}); err != nil {
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/asticode/go-astilectron"
+	"github.com/asticode/go-astilectron/bootstrap"
+	"github.com/pkg/errors"
+)
+
+// PayloadProfilePassphrase represents the payload asking the passphrase of a profile
+// Invalid is true when the passphrase that has been provided is not the right one
+type PayloadProfilePassphrase struct {
+	Invalid bool   `json:"invalid"`
+	Name    string `json:"name"`
+}
+
+// PayloadProfileSwitch represents the payload of a profile switch
+// Passphrase is only needed when the data of the profile is encrypted
+type PayloadProfileSwitch struct {
+	Name       string `json:"name"`
+	Passphrase string `json:"passphrase,omitempty"`
+}
+
+// PayloadProfiles represents the payload containing profiles
+type PayloadProfiles struct {
+	Current  string   `json:"current"`
+	Profiles []string `json:"profiles"`
+}
+
+// newPayloadProfiles creates a new profiles payload
+func newPayloadProfiles() (p PayloadProfiles, err error) {
+	p = PayloadProfiles{Current: *profile}
+	if p.Profiles, err = listProfiles(dataDirPath); err != nil {
+		err = errors.Wrap(err, "listing profiles failed")
+		return
+	}
+	return
+}
+
+// sendProfilePassphrase asks the passphrase of a profile through the "profiles.passphrase" message
+func sendProfilePassphrase(w *astilectron.Window, name string, invalid bool) (err error) {
+	if err = w.Send(bootstrap.MessageOut{Name: "profiles.passphrase", Payload: PayloadProfilePassphrase{
+		Invalid: invalid,
+		Name:    name,
+	}}); err != nil {
+		err = errors.Wrap(err, "sending message failed")
+		return
+	}
+	return
+}
+
+// handleMessageProfilesList handles the "profiles.list" message
+func handleMessageProfilesList(w *astilectron.Window) {
+	// Process errors
+	var err error
+	defer processMessageError(w, &err)
+
+	// Build payload
+	var p PayloadProfiles
+	if p, err = newPayloadProfiles(); err != nil {
+		err = errors.Wrap(err, "building payload failed")
+		return
+	}
+
+	// Send
+	if err = w.Send(bootstrap.MessageOut{Name: "profiles.list", Payload: p}); err != nil {
+		err = errors.Wrap(err, "sending message failed")
+		return
+	}
+}
+
+// handleMessageProfilesSwitch handles the "profiles.switch" message
+// The profile is created if it doesn't exist and, when its data is encrypted, the passphrase is asked through the
+// "profiles.passphrase" message. Switching to the current profile unlocks its data when it's locked.
+// Messages are not handled while data is switched, see handleMessages
+func handleMessageProfilesSwitch(w *astilectron.Window, m bootstrap.MessageIn) {
+	// Process errors
+	var err error
+	defer processMessageError(w, &err)
+
+	// Unmarshal
+	var ps PayloadProfileSwitch
+	if err = json.Unmarshal(m.Payload, &ps); err != nil {
+		err = errors.Wrapf(err, "unmarshaling %s failed", m.Payload)
+		return
+	}
+	var name = ps.Name
+
+	// Switch
+	if name != *profile || data == nil {
+		// Create profile dir
+		var p string
+		if p, err = createProfileDir(dataDirPath, name); err != nil {
+			err = errors.Wrapf(err, "creating dir of profile %s failed", name)
+			return
+		}
+
+		// Import data
+		// Current data is only closed once the new one has been imported successfully
+		// Profiles may have different passphrases
+		var o = dataOptions
+		o.Passphrase = func() ([]byte, error) {
+			if ps.Passphrase == "" {
+				return nil, errMissingPassphrase
+			}
+			return []byte(ps.Passphrase), nil
+		}
+		var d *Data
+		if d, err = NewData(p, o); err != nil {
+			// Ask passphrase
+			if c := errors.Cause(err); c == errMissingPassphrase || c == errInvalidPassphrase {
+				if err = sendProfilePassphrase(w, name, c == errInvalidPassphrase); err != nil {
+					err = errors.Wrap(err, "sending profile passphrase failed")
+					return
+				}
+				return
+			}
+			err = errors.Wrapf(err, "importing data of profile %s failed", name)
+			return
+		}
+
+		// Close current data
+		closeData()
+
+		// Update
+		data = d
+		*profile = name
+
+		// Save last profile
+		if err = saveLastProfile(dataDirPath, name); err != nil {
+			err = errors.Wrap(err, "saving last profile failed")
+			return
+		}
+	}
+
+	// Build payload
+	var p PayloadProfiles
+	if p, err = newPayloadProfiles(); err != nil {
+		err = errors.Wrap(err, "building payload failed")
+		return
+	}
+
+	// Send
+	if err = w.Send(bootstrap.MessageOut{Name: "profiles.switch", Payload: p}); err != nil {
+		err = errors.Wrap(err, "sending message failed")
+		return
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/asticode/go-astilectron"
+	"github.com/asticode/go-astilectron/bootstrap"
+	"github.com/pkg/errors"
+)
+
+// PayloadReconcileStatus represents the reconciliation status of an account
+// Status is nil when no statement has been imported yet
+type PayloadReconcileStatus struct {
+	AccountID string                `json:"account_id"`
+	Status    *reconciliationStatus `json:"status"`
+}
+
+// handleMessageReconcileStatus handles the "reconcile.status" message
+// The last reconciliation point of the account is compared with its operations
+func handleMessageReconcileStatus(w *astilectron.Window, m bootstrap.MessageIn) {
+	// Process errors
+	var err error
+	defer processMessageError(w, &err)
+
+	// Unmarshal
+	var id string
+	if err = json.Unmarshal(m.Payload, &id); err != nil {
+		err = errors.Wrapf(err, "unmarshaling %s failed", m.Payload)
+		return
+	}
+
+	// Fetch account
+	var a *Account
+	if a, err = data.Accounts.One(id); err != nil {
+		err = errors.Wrapf(err, "fetching account %s failed", id)
+		return
+	}
+
+	// Fetch reconciliation points
+	var ps []reconciliationPoint
+	if ps, err = data.ReconciliationPoints(a.ID); err != nil {
+		err = errors.Wrapf(err, "fetching reconciliation points of account %s failed", a.ID)
+		return
+	}
+
+	// Reconcile
+	var p = PayloadReconcileStatus{AccountID: a.ID}
+	if len(ps) > 0 {
+		var s reconciliationStatus
+		if s, err = reconcile(a, ps[len(ps)-1]); err != nil {
+			err = errors.Wrapf(err, "reconciling account %s failed", a.ID)
+			return
+		}
+		p.Status = &s
+	}
+
+	// Send
+	if err = w.Send(bootstrap.MessageOut{Name: "reconcile.status", Payload: p}); err != nil {
+		err = errors.Wrap(err, "sending message failed")
+		return
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Money
+// Amounts are stored as an integer number of ten-thousandths of their currency unit which avoids the rounding errors
+// of floats while covering the minor unit of every currency
+const (
+	currencyDefault = "EUR"
+	moneyDecimals   = 4
+	moneyScale      = 10000
+)
+
+// Money represents an amount of money in a specific currency
+type Money struct {
+	Currency string
+	Units    int64
+}
+
+// moneyJSON represents money as JSON
+// The value is a string so that no precision is lost in the UI
+type moneyJSON struct {
+	Currency string `json:"currency"`
+	Value    string `json:"value"`
+}
+
+// newMoneyFromFloat creates money out of a float which is rounded to the closest unit
+func newMoneyFromFloat(f float64, currency string) (m Money, err error) {
+	var u = math.Round(f * moneyScale)
+	if math.IsNaN(u) || u >= math.MaxInt64 || u < math.MinInt64 {
+		err = fmt.Errorf("%v is not a valid amount", f)
+		return
+	}
+	m = Money{Currency: currency, Units: int64(u)}
+	return
+}
+
+// parseMoney parses an amount written by a human
+// Spaces are ignored and, when both "," and "." are used, the last one is the decimal separator
+func parseMoney(s, currency string) (m Money, err error) {
+	// Init
+	m.Currency = currency
+	var v = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\u00a0', '\u202f', '\'':
+			return -1
+		}
+		return r
+	}, s)
+
+	// Sign
+	var negative bool
+	if strings.HasPrefix(v, "-") {
+		negative = true
+		v = v[1:]
+	} else if strings.HasPrefix(v, "+") {
+		v = v[1:]
+	}
+
+	// Separators
+	var decimal = "."
+	if i := strings.LastIndexAny(v, ",."); i > -1 {
+		decimal = v[i : i+1]
+	}
+	for _, sep := range []string{",", "."} {
+		if sep != decimal {
+			v = strings.Replace(v, sep, "", -1)
+		}
+	}
+
+	// Split
+	var integer, fraction = v, ""
+	if i := strings.Index(v, decimal); i > -1 {
+		integer, fraction = v[:i], v[i+1:]
+	}
+	if integer == "" && fraction == "" {
+		err = fmt.Errorf("%s is not a valid amount", s)
+		return
+	} else if len(fraction) > moneyDecimals {
+		err = fmt.Errorf("%s has more than %d decimals", s, moneyDecimals)
+		return
+	}
+
+	// Parse
+	if m.Units, err = strconv.ParseInt(integer+fraction+strings.Repeat("0", moneyDecimals-len(fraction)), 10, 64); err != nil || m.Units < 0 {
+		err = fmt.Errorf("%s is not a valid amount", s)
+		return
+	}
+	if negative {
+		m.Units = -m.Units
+	}
+	return
+}
+
+// validCurrency checks whether a currency is an ISO 4217 code
+func validCurrency(c string) bool {
+	if len(c) != 3 {
+		return false
+	}
+	for _, r := range c {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Add adds money
+// Amounts must be in the same currency, zero money adopts the currency of the other amount. Amounts in different
+// currencies must be converted first.
+func (m Money) Add(n Money) (o Money, err error) {
+	if m.Currency == "" {
+		m.Currency = n.Currency
+	} else if n.Currency != "" && n.Currency != m.Currency {
+		err = fmt.Errorf("%s and %s are in different currencies", m, n)
+		return
+	}
+	m.Units += n.Units
+	o = m
+	return
+}
+
+// Sub subtracts money
+func (m Money) Sub(n Money) (Money, error) {
+	return m.Add(n.Neg())
+}
+
+// Neg returns the opposite amount
+func (m Money) Neg() Money {
+	m.Units = -m.Units
+	return m
+}
+
+// mulRat multiplies money by a rate and expresses the result in a currency
+// The result is rounded half away from zero to the closest unit
+func (m Money) mulRat(r *big.Rat, currency string) (o Money, err error) {
+	// Multiply
+	var v = new(big.Rat).SetInt64(m.Units)
+	v.Mul(v, r)
+
+	// Round
+	var q, rm = new(big.Int).QuoRem(v.Num(), v.Denom(), new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(rm), big.NewInt(2)).Cmp(v.Denom()) >= 0 {
+		q.Add(q, big.NewInt(int64(v.Sign())))
+	}
+	if !q.IsInt64() {
+		err = errors.New("amount overflows")
+		return
+	}
+	o = Money{Currency: currency, Units: q.Int64()}
+	return
+}
+
+// Float64 returns the amount as a float which should only be used for display purposes such as charts
+func (m Money) Float64() float64 {
+	return float64(m.Units) / moneyScale
+}
+
+// IsZero checks whether the amount is zero
+func (m Money) IsZero() bool {
+	return m.Units == 0
+}
+
+// Value returns the amount as a decimal string with at least 2 decimals
+func (m Money) Value() string {
+	// Split
+	var sign, u = "", uint64(m.Units)
+	if m.Units < 0 {
+		sign, u = "-", uint64(-m.Units)
+	}
+	var s = strconv.FormatUint(u, 10)
+	if len(s) <= moneyDecimals {
+		s = strings.Repeat("0", moneyDecimals-len(s)+1) + s
+	}
+	var integer, fraction = s[:len(s)-moneyDecimals], strings.TrimRight(s[len(s)-moneyDecimals:], "0")
+
+	// Pad
+	if len(fraction) < 2 {
+		fraction += strings.Repeat("0", 2-len(fraction))
+	}
+	return sign + integer + "." + fraction
+}
+
+// String implements the fmt.Stringer interface
+func (m Money) String() string {
+	return strings.TrimSpace(m.Value() + " " + m.Currency)
+}
+
+// MarshalJSON implements the json.Marshaler interface
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyJSON{Currency: m.Currency, Value: m.Value()})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+// Plain numbers, which is how amounts were written before money had a currency, are in the default currency
+func (m *Money) UnmarshalJSON(b []byte) (err error) {
+	// Plain number
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] != '{' {
+		var f float64
+		if err = json.Unmarshal(b, &f); err != nil {
+			return
+		}
+		*m, err = newMoneyFromFloat(f, currencyDefault)
+		return
+	}
+
+	// Object
+	var j moneyJSON
+	if err = json.Unmarshal(b, &j); err != nil {
+		return
+	}
+	if *m, err = parseMoney(j.Value, j.Currency); err != nil {
+		err = errors.Wrapf(err, "parsing %s failed", j.Value)
+		return
+	}
+	return
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	for _, c := range []struct {
+		err   bool
+		in    string
+		units int64
+	}{
+		{in: "0", units: 0},
+		{in: "12", units: 120000},
+		{in: "12.5", units: 125000},
+		{in: "12,5", units: 125000},
+		{in: "-12.34", units: -123400},
+		{in: "+12.34", units: 123400},
+		{in: ".5", units: 5000},
+		{in: "1,234.56", units: 12345600},
+		{in: "1.234,56", units: 12345600},
+		{in: "1 234,56", units: 12345600},
+		{in: "1\u00a0234,56", units: 12345600},
+		{in: "1'234.56", units: 12345600},
+		{in: "0.0001", units: 1},
+		{in: "-0.0001", units: -1},
+		{in: "922337203685477.5807", units: 9223372036854775807},
+		{err: true, in: ""},
+		{err: true, in: "-"},
+		{err: true, in: "."},
+		{err: true, in: "0.00001"},
+		{err: true, in: "12a"},
+		{err: true, in: "--12"},
+		{err: true, in: "922337203685477.5808"},
+	} {
+		m, err := parseMoney(c.in, "EUR")
+		if c.err {
+			if err == nil {
+				t.Errorf("parsing %q: expected an error, got %d units", c.in, m.Units)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsing %q failed: %v", c.in, err)
+		} else if m.Units != c.units || m.Currency != "EUR" {
+			t.Errorf("parsing %q: expected %d EUR units, got %d %s units", c.in, c.units, m.Units, m.Currency)
+		}
+	}
+}
+
+func TestMoneyMulRat(t *testing.T) {
+	for _, c := range []struct {
+		rate  string
+		units int64
+		want  int64
+	}{
+		{rate: "1", units: 10000, want: 10000},
+		{rate: "1.2457", units: 10000, want: 12457},
+		{rate: "1/3", units: 10000, want: 3333},
+		{rate: "2/3", units: 10000, want: 6667},
+		{rate: "1/2", units: 1, want: 1},
+		{rate: "1/2", units: -1, want: -1},
+		{rate: "1/2", units: 3, want: 2},
+		{rate: "1/2", units: -3, want: -2},
+		{rate: "1/4", units: 1, want: 0},
+		{rate: "1/4", units: -1, want: 0},
+		{rate: "0", units: 12345, want: 0},
+	} {
+		r, ok := new(big.Rat).SetString(c.rate)
+		if !ok {
+			t.Fatalf("parsing rate %s failed", c.rate)
+		}
+		o, err := Money{Currency: "EUR", Units: c.units}.mulRat(r, "USD")
+		if err != nil {
+			t.Errorf("multiplying %d by %s failed: %v", c.units, c.rate, err)
+		} else if o.Units != c.want || o.Currency != "USD" {
+			t.Errorf("multiplying %d by %s: expected %d USD units, got %d %s units", c.units, c.rate, c.want, o.Units, o.Currency)
+		}
+	}
+
+	// Overflow
+	if _, err := (Money{Currency: "EUR", Units: 1 << 62}).mulRat(big.NewRat(4, 1), "USD"); err == nil {
+		t.Error("expected an overflow error")
+	}
+}
+
+func TestMoneyValue(t *testing.T) {
+	for _, c := range []struct {
+		units int64
+		want  string
+	}{
+		{units: 0, want: "0.00"},
+		{units: 1, want: "0.0001"},
+		{units: -1, want: "-0.0001"},
+		{units: 5000, want: "0.50"},
+		{units: 123456, want: "12.3456"},
+		{units: -123400, want: "-12.34"},
+	} {
+		if v := (Money{Units: c.units}).Value(); v != c.want {
+			t.Errorf("value of %d units: expected %s, got %s", c.units, c.want, v)
+		}
+	}
+}
+
+func TestMoneyAdd(t *testing.T) {
+	// Zero money adopts the currency of the other amount
+	if m, err := (Money{}).Add(Money{Currency: "USD", Units: 1}); err != nil || m.Currency != "USD" || m.Units != 1 {
+		t.Errorf("expected 1 USD unit, got %d %s units and %v", m.Units, m.Currency, err)
+	}
+	if m, err := (Money{Currency: "USD", Units: 3}).Sub(Money{Units: 1}); err != nil || m.Currency != "USD" || m.Units != 2 {
+		t.Errorf("expected 2 USD units, got %d %s units and %v", m.Units, m.Currency, err)
+	}
+
+	// Different currencies
+	if _, err := (Money{Currency: "EUR", Units: 1}).Add(Money{Currency: "USD", Units: 1}); err == nil {
+		t.Error("expected adding different currencies to fail")
+	}
+}
@@ -5,12 +5,28 @@ import (
 )
 
 // Operation represents an operation
+// Amount is in the currency of the account whereas OriginalAmount is in the currency the operation was made in
+// ExternalID is the id given by the bank, such as the OFX FITID, and is used to detect operations imported twice
+// Fingerprint is computed out of the date, the amount, the raw label and the occurrence of an operation in its
+// statement and is used to detect operations imported twice when there's no external id
+// ValueDate is only known for some formats, such as CAMT, and may differ from Date which is the booking date
 type Operation struct {
-	Amount   float64   `json:"amount"`
-	Category string    `json:"category"`
-	Date     time.Time `json:"date"`
-	ID       int       `json:"id"`
-	Label    string    `json:"label"`
-	RawLabel string    `json:"raw_label"`
-	Subject  string    `json:"subject"`
+	Amount         Money      `json:"amount"`
+	Category       string     `json:"category"`
+	Date           time.Time  `json:"date"`
+	ExternalID     string     `json:"external_id,omitempty"`
+	Fingerprint    string     `json:"fingerprint,omitempty"`
+	ID             int        `json:"id"`
+	Label          string     `json:"label"`
+	OriginalAmount Money      `json:"original_amount"`
+	RawLabel       string     `json:"raw_label"`
+	Subject        string     `json:"subject"`
+	ValueDate      *time.Time `json:"value_date,omitempty"`
+}
+
+// setDefaults sets the fields that didn't exist when the operation was stored
+func (o *Operation) setDefaults() {
+	if o.OriginalAmount.Currency == "" {
+		o.OriginalAmount = o.Amount
+	}
 }
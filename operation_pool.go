@@ -2,12 +2,21 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"sync"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 // OperationPool represents an operation pool
+// Operations are also indexed by date along with their cumulated amounts, the index being rebuilt lazily once
+// operations have changed
 type OperationPool struct {
+	byDate         []*Operation
 	Counter        int
+	cumulated      []Money
+	dirty          bool
 	OperationsByID map[int]*Operation
 	mutex          *sync.Mutex
 	OrderedIDs     []int
@@ -21,39 +30,48 @@ func newOperationPool() *OperationPool {
 	}
 }
 
-// Add adds an operation
-func (p *OperationPool) Add(op *Operation) *Operation {
+// set sets an operation while keeping its id
+// Ids are given in ascending order therefore the operation is inserted at the position of its id
+// It must also be called once an operation has been modified in place so that the date index is rebuilt
+func (p *OperationPool) set(op *Operation) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
-	p.Counter++
-	op.ID = p.Counter
 	if _, ok := p.OperationsByID[op.ID]; !ok {
-		p.OperationsByID[op.ID] = op
-		p.OrderedIDs = append(p.OrderedIDs, op.ID)
+		var idx = sort.SearchInts(p.OrderedIDs, op.ID)
+		p.OrderedIDs = append(p.OrderedIDs, 0)
+		copy(p.OrderedIDs[idx+1:], p.OrderedIDs[idx:])
+		p.OrderedIDs[idx] = op.ID
+	}
+	p.OperationsByID[op.ID] = op
+	p.dirty = true
+	if op.ID > p.Counter {
+		p.Counter = op.ID
 	}
-	return p.OperationsByID[op.ID]
 }
 
 // All returns the operations
-func (p *OperationPool) All() (os []*Operation) {
+func (p *OperationPool) All() (ops []*Operation) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
-	os = []*Operation{}
+	ops = []*Operation{}
 	for _, id := range p.OrderedIDs {
-		os = append(os, p.OperationsByID[id])
+		ops = append(ops, p.OperationsByID[id])
 	}
 	return
 }
 
-// Last returns the last operation
-func (p *OperationPool) Last() (o *Operation) {
+// Delete deletes an operation
+func (p *OperationPool) Delete(id int) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
-	if len(p.OrderedIDs) == 0 {
+	if _, ok := p.OperationsByID[id]; !ok {
 		return
 	}
-	o = p.OperationsByID[p.OrderedIDs[len(p.OrderedIDs)-1]]
-	return
+	delete(p.OperationsByID, id)
+	p.dirty = true
+	if idx := sort.SearchInts(p.OrderedIDs, id); idx < len(p.OrderedIDs) && p.OrderedIDs[idx] == id {
+		p.OrderedIDs = append(p.OrderedIDs[:idx], p.OrderedIDs[idx+1:]...)
+	}
 }
 
 // One returns the operation for a specific id
@@ -67,3 +85,73 @@ func (p *OperationPool) One(id int) (o *Operation, err error) {
 	}
 	return
 }
+
+// ByDate returns the operations sorted by date along with the cumulated amounts after each of them
+// Operations of the same date are sorted by id and returned slices must not be modified
+func (p *OperationPool) ByDate() (ops []*Operation, cumulated []Money, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if err = p.index(); err != nil {
+		err = errors.Wrap(err, "indexing failed")
+		return
+	}
+	return p.byDate, p.cumulated, nil
+}
+
+// Total returns the sum of the amounts of the operations
+func (p *OperationPool) Total() (m Money, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if err = p.index(); err != nil {
+		err = errors.Wrap(err, "indexing failed")
+		return
+	}
+	if len(p.cumulated) > 0 {
+		m = p.cumulated[len(p.cumulated)-1]
+	}
+	return
+}
+
+// CumulatedAt returns the sum of the amounts of the operations made on or before a specific date
+func (p *OperationPool) CumulatedAt(t time.Time) (m Money, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if err = p.index(); err != nil {
+		err = errors.Wrap(err, "indexing failed")
+		return
+	}
+	if idx := sort.Search(len(p.byDate), func(i int) bool { return p.byDate[i].Date.After(t) }); idx > 0 {
+		m = p.cumulated[idx-1]
+	}
+	return
+}
+
+// index rebuilds the date index if operations have changed
+// New slices are built so that the ones previously returned stay valid
+// Pool must be locked
+func (p *OperationPool) index() (err error) {
+	// Nothing changed
+	if !p.dirty {
+		return
+	}
+
+	// Sort
+	var byDate = make([]*Operation, 0, len(p.OrderedIDs))
+	for _, id := range p.OrderedIDs {
+		byDate = append(byDate, p.OperationsByID[id])
+	}
+	sort.SliceStable(byDate, func(i, j int) bool { return byDate[i].Date.Before(byDate[j].Date) })
+
+	// Cumulate
+	var cumulated = make([]Money, len(byDate))
+	var m Money
+	for idx, o := range byDate {
+		if m, err = m.Add(o.Amount); err != nil {
+			err = errors.Wrapf(err, "adding amount of operation %d failed", o.ID)
+			return
+		}
+		cumulated[idx] = m
+	}
+	p.byDate, p.cumulated, p.dirty = byDate, cumulated, false
+	return
+}
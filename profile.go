@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// Constants
+const (
+	envDataDir     = "ASTIBANK_DATA_DIR"
+	profileDefault = "default"
+)
+
+// Vars
+var (
+	regexpProfileName = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+)
+
+// defaultDataDirPath returns the default data dir path
+// It follows the XDG base directory specification and falls back on the OS config dir on Windows
+func defaultDataDirPath() (p string, err error) {
+	// XDG
+	if p = os.Getenv("XDG_DATA_HOME"); p != "" {
+		p = filepath.Join(p, "astibank")
+		return
+	}
+
+	// Windows
+	if runtime.GOOS == "windows" {
+		if p, err = os.UserConfigDir(); err != nil {
+			err = errors.Wrap(err, "fetching user config dir failed")
+			return
+		}
+		p = filepath.Join(p, "Astibank")
+		return
+	}
+
+	// Home
+	var h string
+	if h, err = os.UserHomeDir(); err != nil {
+		err = errors.Wrap(err, "fetching user home dir failed")
+		return
+	}
+	p = filepath.Join(h, ".local", "share", "astibank")
+	return
+}
+
+// profilesDirPath returns the path of the dir containing the profiles
+func profilesDirPath(dataDirPath string) string {
+	return filepath.Join(dataDirPath, "profiles")
+}
+
+// profileDirPath returns the path of the dir containing the data of a profile
+func profileDirPath(dataDirPath, name string) string {
+	return filepath.Join(profilesDirPath(dataDirPath), name)
+}
+
+// lastProfilePath returns the path of the file containing the name of the last profile used
+func lastProfilePath(dataDirPath string) string {
+	return filepath.Join(dataDirPath, "profile")
+}
+
+// validateProfileName validates a profile name
+func validateProfileName(name string) error {
+	if !regexpProfileName.MatchString(name) {
+		return fmt.Errorf("%s is not a valid profile name, only letters, digits, _ and - are allowed", name)
+	}
+	return nil
+}
+
+// listProfiles lists the profiles
+func listProfiles(dataDirPath string) (ps []string, err error) {
+	// Read dir
+	var fs []os.FileInfo
+	if fs, err = ioutil.ReadDir(profilesDirPath(dataDirPath)); err != nil && !os.IsNotExist(err) {
+		err = errors.Wrapf(err, "reading dir %s failed", profilesDirPath(dataDirPath))
+		return
+	}
+	err = nil
+
+	// Loop through files
+	ps = []string{}
+	for _, f := range fs {
+		if f.IsDir() && validateProfileName(f.Name()) == nil {
+			ps = append(ps, f.Name())
+		}
+	}
+	sort.Strings(ps)
+	return
+}
+
+// lastProfile returns the last profile used
+func lastProfile(dataDirPath string) string {
+	b, err := ioutil.ReadFile(lastProfilePath(dataDirPath))
+	if err != nil {
+		return profileDefault
+	}
+	if name := strings.TrimSpace(string(b)); validateProfileName(name) == nil {
+		return name
+	}
+	return profileDefault
+}
+
+// saveLastProfile saves the last profile used
+func saveLastProfile(dataDirPath, name string) (err error) {
+	if err = writeFileAtomic(lastProfilePath(dataDirPath), []byte(name)); err != nil {
+		err = errors.Wrapf(err, "writing %s failed", lastProfilePath(dataDirPath))
+		return
+	}
+	return
+}
+
+// createProfileDir creates the dir of a profile
+func createProfileDir(dataDirPath, name string) (p string, err error) {
+	// Validate name
+	if err = validateProfileName(name); err != nil {
+		return
+	}
+
+	// Create dir
+	p = profileDirPath(dataDirPath, name)
+	if err = os.MkdirAll(p, 0700); err != nil {
+		err = errors.Wrapf(err, "mkdirall %s failed", p)
+		return
+	}
+	return
+}
+
+// migrateLegacyData copies the data stored next to the executable in older versions to the default profile
+// The original file is left untouched
+func migrateLegacyData(executableDirPath, dataDirPath string) (err error) {
+	// Nothing to migrate
+	var src, dst = dataPath(executableDirPath), dataPath(profileDirPath(dataDirPath, profileDefault))
+	if _, errStat := os.Stat(src); errStat != nil {
+		return
+	} else if _, errStat := os.Stat(dst); errStat == nil {
+		return
+	} else if filepath.Clean(executableDirPath) == filepath.Clean(profileDirPath(dataDirPath, profileDefault)) {
+		return
+	}
+
+	// Create dir
+	if _, err = createProfileDir(dataDirPath, profileDefault); err != nil {
+		err = errors.Wrap(err, "creating default profile dir failed")
+		return
+	}
+
+	// Copy
+	astilog.Infof("Copying legacy data %s to %s", src, dst)
+	if err = copyFileAtomic(src, dst); err != nil {
+		err = errors.Wrapf(err, "copying %s to %s failed", src, dst)
+		return
+	}
+	return
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Rates
+// The rates file is maintained by the user and contains lines of date, currency and rate such as "2018-01-31,USD,1.2457"
+// A rate is the amount of the currency that one unit of the base currency buys at that date
+const (
+	ratesBaseCurrency = currencyDefault
+	ratesDateFormat   = "2006-01-02"
+	ratesFileName     = "rates.csv"
+)
+
+// rates represents exchange rates indexed by currency
+type rates struct {
+	byCurrency map[string][]rate
+}
+
+// rate represents an exchange rate at a specific date
+type rate struct {
+	date  time.Time
+	value *big.Rat
+}
+
+// ratesPath returns the rates file path of a data dir
+func ratesPath(dataDirPath string) string {
+	return filepath.Join(dataDirPath, ratesFileName)
+}
+
+// newRates creates new rates
+func newRates() *rates {
+	return &rates{byCurrency: make(map[string][]rate)}
+}
+
+// loadRates loads the rates file
+// A missing file means there are no rates
+func loadRates(path string) (rs *rates, err error) {
+	// Open
+	var f *os.File
+	if f, err = os.Open(path); os.IsNotExist(err) {
+		rs = newRates()
+		err = nil
+		return
+	} else if err != nil {
+		err = errors.Wrapf(err, "opening %s failed", path)
+		return
+	}
+	defer f.Close()
+
+	// Parse
+	if rs, err = parseRates(f); err != nil {
+		err = errors.Wrapf(err, "parsing %s failed", path)
+		return
+	}
+	return
+}
+
+// parseRates parses rates
+// Empty lines, lines starting with "#" and a header line are ignored
+func parseRates(r io.Reader) (rs *rates, err error) {
+	// Init
+	rs = newRates()
+	var cr = csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = 3
+	cr.TrimLeadingSpace = true
+
+	// Loop through lines
+	for {
+		// Read line
+		var l []string
+		if l, err = cr.Read(); err == io.EOF {
+			err = nil
+			break
+		} else if err != nil {
+			err = errors.Wrap(err, "reading line failed")
+			return
+		}
+
+		// Header
+		var line, _ = cr.FieldPos(0)
+		if line == 1 && strings.EqualFold(strings.TrimSpace(l[0]), "date") {
+			continue
+		}
+
+		// Parse
+		var rt rate
+		if rt.date, err = time.Parse(ratesDateFormat, strings.TrimSpace(l[0])); err != nil {
+			err = fmt.Errorf("line %d: %s is not a valid date", line, l[0])
+			return
+		}
+		var c = strings.ToUpper(strings.TrimSpace(l[1]))
+		if !validCurrency(c) {
+			err = fmt.Errorf("line %d: %s is not a valid currency", line, l[1])
+			return
+		}
+		var ok bool
+		if rt.value, ok = new(big.Rat).SetString(strings.TrimSpace(l[2])); !ok || rt.value.Sign() <= 0 {
+			err = fmt.Errorf("line %d: %s is not a valid rate", line, l[2])
+			return
+		}
+		rs.byCurrency[c] = append(rs.byCurrency[c], rt)
+	}
+
+	// Sort
+	for _, v := range rs.byCurrency {
+		sort.SliceStable(v, func(i, j int) bool { return v[i].date.Before(v[j].date) })
+	}
+	return
+}
+
+// currencies returns the currencies that have rates, including the base currency
+func (rs *rates) currencies() (cs []string) {
+	cs = []string{ratesBaseCurrency}
+	for c := range rs.byCurrency {
+		if c != ratesBaseCurrency {
+			cs = append(cs, c)
+		}
+	}
+	sort.Strings(cs)
+	return
+}
+
+// rate returns the most recent rate of a currency at a specific date
+func (rs *rates) rate(currency string, date time.Time) (r *big.Rat, err error) {
+	// Base currency
+	if currency == ratesBaseCurrency {
+		r = big.NewRat(1, 1)
+		return
+	}
+
+	// Search
+	var v = rs.byCurrency[currency]
+	var idx = sort.Search(len(v), func(i int) bool { return v[i].date.After(date) })
+	if idx == 0 {
+		err = fmt.Errorf("no %s rate on or before %s", currency, date.Format(ratesDateFormat))
+		return
+	}
+	r = v[idx-1].value
+	return
+}
+
+// convert converts money to a currency with the rates of a specific date
+func (rs *rates) convert(m Money, currency string, date time.Time) (o Money, err error) {
+	// Same currency
+	if m.Currency == currency {
+		o = m
+		return
+	}
+
+	// Fetch rates
+	var from, to *big.Rat
+	if from, err = rs.rate(m.Currency, date); err != nil {
+		err = errors.Wrapf(err, "fetching %s rate failed", m.Currency)
+		return
+	}
+	if to, err = rs.rate(currency, date); err != nil {
+		err = errors.Wrapf(err, "fetching %s rate failed", currency)
+		return
+	}
+
+	// Convert
+	if o, err = m.mulRat(new(big.Rat).Quo(to, from), currency); err != nil {
+		err = errors.Wrapf(err, "converting %s to %s failed", m, currency)
+		return
+	}
+	return
+}
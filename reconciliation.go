@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Reconciliation
+// Each import records the balance given by the statement as a reconciliation point which is then compared with the
+// balance computed out of the stored operations
+const (
+	metadataKeyReconciliationPrefix = "reconciliation."
+	reconciliationReasonMissing     = "missing"
+	reconciliationReasonOpening     = "opening"
+	reconciliationReasonUnexpected  = "unexpected"
+)
+
+// reconciliationPoint represents the balance of an account given by a statement at a specific date
+// Operations are the ones listed in the statement, oldest first
+type reconciliationPoint struct {
+	Balance    Money                     `json:"balance"`
+	Date       time.Time                 `json:"date"`
+	Operations []reconciliationOperation `json:"operations"`
+	RecordedAt time.Time                 `json:"recorded_at"`
+}
+
+// reconciliationOperation represents an operation listed in a statement
+type reconciliationOperation struct {
+	Amount   Money     `json:"amount"`
+	Date     time.Time `json:"date"`
+	RawLabel string    `json:"raw_label"`
+}
+
+// reconciliationStatus represents the result of the comparison of a reconciliation point with the stored operations
+// Balance is the balance computed at the date of the point and Difference is its difference with the statement
+type reconciliationStatus struct {
+	Balance    Money                     `json:"balance"`
+	Difference Money                     `json:"difference"`
+	Divergence *reconciliationDivergence `json:"divergence,omitempty"`
+	Point      reconciliationPoint       `json:"point"`
+	Reconciled bool                      `json:"reconciled"`
+}
+
+// reconciliationDivergence represents the first place where the stored operations and the statement diverge
+// Operation is set when a stored operation is not in the statement, StatementOperation is set when an operation of the
+// statement is not stored and none of them is set when the difference comes from before the statement
+type reconciliationDivergence struct {
+	Date               time.Time                `json:"date"`
+	Operation          *Operation               `json:"operation,omitempty"`
+	Reason             string                   `json:"reason"`
+	StatementOperation *reconciliationOperation `json:"statement_operation,omitempty"`
+}
+
+// reconciliationMetadataKey returns the metadata key of the reconciliation points of an account
+func reconciliationMetadataKey(accountID string) string {
+	return metadataKeyReconciliationPrefix + accountID
+}
+
+// newReconciliationPoint creates a new reconciliation point out of a bank statement
+func newReconciliationPoint(s bankStatement) (p reconciliationPoint) {
+	p = reconciliationPoint{
+		Balance:    s.Balance,
+		Date:       s.Date,
+		Operations: []reconciliationOperation{},
+		RecordedAt: time.Now(),
+	}
+	for _, o := range s.Operations {
+		p.Operations = append(p.Operations, reconciliationOperation{Amount: o.Amount, Date: o.Date, RawLabel: o.RawLabel})
+	}
+	return
+}
+
+// ReconciliationPoints returns the reconciliation points of an account, oldest first
+func (d *Data) ReconciliationPoints(accountID string) (ps []reconciliationPoint, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.reconciliationPoints(accountID)
+}
+
+// reconciliationPoints returns the reconciliation points of an account
+// Data must be locked
+func (d *Data) reconciliationPoints(accountID string) (ps []reconciliationPoint, err error) {
+	var b = d.metadata[reconciliationMetadataKey(accountID)]
+	if len(b) == 0 {
+		return
+	}
+	if err = json.Unmarshal(b, &ps); err != nil {
+		err = errors.Wrapf(err, "unmarshaling %s failed", b)
+		return
+	}
+	return
+}
+
+// appendReconciliationPoint appends a reconciliation point to the points of an account
+// A point replaces the last one when they're about the same statement, which happens when it's imported again
+func appendReconciliationPoint(ps []reconciliationPoint, p reconciliationPoint) []reconciliationPoint {
+	if l := len(ps); l > 0 && ps[l-1].Date.Equal(p.Date) && ps[l-1].Balance == p.Balance {
+		ps[l-1] = p
+		return ps
+	}
+	return append(ps, p)
+}
+
+// reconcile compares a reconciliation point with the operations of an account
+func reconcile(a *Account, p reconciliationPoint) (s reconciliationStatus, err error) {
+	// Compute balance at the date of the point
+	s = reconciliationStatus{Point: p}
+	if s.Balance, err = a.BalanceAt(p.Date); err != nil {
+		err = errors.Wrapf(err, "computing balance at %s failed", p.Date.Format("2006-01-02"))
+		return
+	}
+	if s.Balance.Currency != p.Balance.Currency {
+		err = fmt.Errorf("statement currency %s differs from account currency %s", p.Balance.Currency, s.Balance.Currency)
+		return
+	}
+	if s.Difference, err = s.Balance.Sub(p.Balance); err != nil {
+		err = errors.Wrap(err, "subtracting statement balance failed")
+		return
+	}
+	if s.Reconciled = s.Difference.IsZero(); s.Reconciled {
+		return
+	}
+
+	// Statement period
+	var from = p.Date
+	if len(p.Operations) > 0 && p.Operations[0].Date.Before(from) {
+		from = p.Operations[0].Date
+	}
+
+	// Match operations of the statement with stored operations of the same period
+	var ops []*Operation
+	if ops, _, err = a.Operations.ByDate(); err != nil {
+		err = errors.Wrap(err, "sorting operations failed")
+		return
+	}
+	var used = make(map[int]bool)
+	var missing *reconciliationOperation
+	for idx := range p.Operations {
+		var so = p.Operations[idx]
+		var matched bool
+		for _, o := range ops {
+			if !used[o.ID] && o.Date.Equal(so.Date) && o.Amount == so.Amount && o.RawLabel == so.RawLabel {
+				used[o.ID] = true
+				matched = true
+				break
+			}
+		}
+		if !matched && missing == nil {
+			missing = &so
+		}
+	}
+
+	// Find first stored operation of the period that is not in the statement
+	var unexpected *Operation
+	for _, o := range ops {
+		if !used[o.ID] && !o.Date.Before(from) && !o.Date.After(p.Date) {
+			unexpected = o
+			break
+		}
+	}
+
+	// Build divergence
+	switch {
+	case unexpected != nil && (missing == nil || !missing.Date.Before(unexpected.Date)):
+		s.Divergence = &reconciliationDivergence{Date: unexpected.Date, Operation: unexpected, Reason: reconciliationReasonUnexpected}
+	case missing != nil:
+		s.Divergence = &reconciliationDivergence{Date: missing.Date, Reason: reconciliationReasonMissing, StatementOperation: missing}
+	default:
+		s.Divergence = &reconciliationDivergence{Date: from, Reason: reconciliationReasonOpening}
+	}
+	return
+}
@@ -13,6 +13,9 @@ var charts = {
             // Listen
             charts.listen();
 
+            // Handle currency
+            document.getElementById("currency").onchange = charts.onChangeCurrency;
+
             // Refresh charts
             charts.sendChartsAll();
         });
@@ -33,19 +36,36 @@ var charts = {
     listenError: function(message) {
         asticode.notifier.error(message.payload);
     },
+    onChangeCurrency: function() {
+        charts.currency = this.value;
+        charts.sendChartsAll();
+    },
     sendChartsAll: function() {
         asticode.loader.show();
-        astilectron.send({name: "charts.all", payload: charts.account_id});
+        astilectron.send({name: "charts.all", payload: {account_id: charts.account_id, currency: charts.currency}});
     },
     listenChartsAll: function(message) {
+        // Currencies
+        charts.currency = message.payload.currency;
+        var select = document.getElementById("currency");
+        select.innerHTML = "";
+        for (var i = 0; i < message.payload.currencies.length; i++) {
+            var option = document.createElement("option");
+            option.value = message.payload.currencies[i];
+            option.innerText = message.payload.currencies[i];
+            option.selected = message.payload.currencies[i] === charts.currency;
+            select.appendChild(option);
+        }
+
+        // Charts
         var node = document.getElementById("charts");
         node.innerHTML = "";
-        for (var i = 0; i < message.payload.length; i++) {
+        for (var i = 0; i < message.payload.charts.length; i++) {
             charts.countCharts++;
             var canvas = document.createElement("canvas");
             canvas.id = "chart-" + charts.countCharts;
             document.getElementById("charts").append(canvas);
-            new Chart(canvas, message.payload[i]);
+            new Chart(canvas, message.payload.charts[i]);
         }
     }
 };
\ No newline at end of file
@@ -1,4 +1,11 @@
 var index = {
+    formatAmount: function(operation) {
+        var s = operation.amount.value + " " + operation.amount.currency;
+        if (operation.original_amount.currency !== operation.amount.currency) {
+            s += " (" + operation.original_amount.value + " " + operation.original_amount.currency + ")";
+        }
+        return s;
+    },
     init: function() {
         // Init
         asticode.loader.init();
@@ -19,8 +26,25 @@ var index = {
             // Refresh list accounts
             index.sendAccountsList();
 
+            // Refresh list profiles
+            index.sendProfilesList();
+
             // Handle import
             document.getElementById("btn-import").onclick = index.onClickImport;
+            document.getElementById("btn-inbox").onclick = index.onClickInbox;
+
+            // Refresh inbox
+            index.setInbox([]);
+            index.sendInboxList();
+            document.getElementById("btn-csv-profiles").onclick = index.onClickCSVProfiles;
+
+            // Handle history
+            document.getElementById("btn-redo").onclick = index.sendHistoryRedo;
+            document.getElementById("btn-undo").onclick = index.sendHistoryUndo;
+
+            // Handle profiles
+            document.getElementById("btn-profile-add").onclick = index.onClickProfileAdd;
+            document.getElementById("profiles").onchange = index.onChangeProfile;
         })
     },
     listen: function() {
@@ -30,14 +54,44 @@ var index = {
                 case "accounts.list":
                     index.listenAccountsList(message);
                     break;
+                case "csvprofiles.delete":
+                case "csvprofiles.list":
+                case "csvprofiles.save":
+                    index.listenCSVProfiles(message);
+                    break;
                 case "error":
                     index.listenError(message);
                     break;
+                case "history.redo":
+                case "history.undo":
+                    index.listenHistory(message);
+                    break;
                 case "import":
                     index.listenImport(message);
                     break;
-                case "operations.add":
-                    index.listenOperationsAdd(message);
+                case "import.preview":
+                    index.listenImportPreview(message);
+                    break;
+                case "inbox.accept":
+                    index.listenInboxAccept(message);
+                    break;
+                case "inbox.acceptAll":
+                    index.listenInboxAcceptAll(message);
+                    break;
+                case "inbox.list":
+                    index.listenInboxList(message);
+                    break;
+                case "inbox.skip":
+                    index.listenInboxSkip(message);
+                    break;
+                case "profiles.list":
+                    index.listenProfilesList(message);
+                    break;
+                case "profiles.passphrase":
+                    index.listenProfilesPassphrase(message);
+                    break;
+                case "profiles.switch":
+                    index.listenProfilesSwitch(message);
                     break;
                 case "references.list":
                     index.listenReferencesList(message);
@@ -50,7 +104,7 @@ var index = {
         node.innerHTML = "";
         for (var i = 0; i < message.payload.length; i++) {
             var className = "amount-negative";
-            if (message.payload[i].balance > 0) {
+            if (parseFloat(message.payload[i].balance.value) > 0) {
                 className = "amount-positive";
             }
             node.innerHTML = node.innerHTML + `
@@ -58,7 +112,7 @@ var index = {
                     <div class="account-wrapper">
                        <div class="account-table">
                             <div class="account-cell">` + message.payload[i].id + `</div>
-                            <div class="account-cell ` + className + `">` + message.payload[i].balance.toFixed(0) + `€</div>
+                            <div class="account-cell ` + className + `">` + parseFloat(message.payload[i].balance.value).toFixed(0) + ` ` + message.payload[i].balance.currency + `</div>
                             <div class="account-cell">
                                 <a class="action" href="operations.html?account_id=` + message.payload[i].id + `"><i class="fa fa-bars"></i></a>
                                 <a class="action" href="charts.html?account_id=` + message.payload[i].id + `"><i class="fa fa-line-chart"></i></a>
@@ -72,34 +126,145 @@ var index = {
             `;
         }
     },
+    listenCSVProfiles: function(message) {
+        if (message.name !== "csvprofiles.list") {
+            asticode.notifier.success("CSV profiles have been " + (message.name === "csvprofiles.save" ? "saved" : "deleted"));
+        }
+        index.csvProfiles = message.payload.profiles;
+        index.setCSVProfilesModalContent();
+    },
     listenError: function(message) {
         asticode.notifier.error(message.payload);
     },
+    listenHistory: function(message) {
+        asticode.notifier.success("Last " + message.payload.name + " has been " + message.name.split(".")[1] + "ne");
+        index.sendAccountsList();
+    },
     listenImport: function(message) {
-        // No new operations detected
-        if (message.payload.length == 0) {
+        // Statements
+        for (var i = 0; i < message.payload.statements.length; i++) {
+            var s = message.payload.statements[i];
+            asticode.notifier.info(s.path + " has been read as " + s.format + " encoded in " + s.text.encoding + ", " + s.duplicates + " operation(s) had already been imported");
+            if (s.errors.length > 0) {
+                asticode.notifier.error(s.errors.length + " line(s) of " + s.path + " couldn't be read");
+            }
+        }
+
+        // Set operations
+        // Operations waiting in the inbox since previous imports are reviewed as well
+        index.setInbox(message.payload.operations);
+
+        // No operations to review
+        if (message.payload.operations.length == 0) {
             asticode.notifier.info("No new operations detected");
+            index.sendAccountsList();
             return
         }
 
-        // Set operations
-        index.import = {
-            operations: message.payload,
+        // Set modal content
+        index.setModalContent();
+    },
+    listenImportPreview: function(message) {
+        // Set preview
+        index.preview = {
+            files: message.payload.files,
         };
 
         // Set modal content
+        index.setImportPreviewModalContent();
+    },
+    listenInboxAccept: function(message) {
+        index.notifyImportSummary(message.payload);
+        index.nextOperation();
+    },
+    listenInboxAcceptAll: function(message) {
+        // Remove operations of the accounts
+        index.notifyImportSummary(message.payload);
+        var operations = [];
+        for (var i = 0; i < index.import.operations.length; i++) {
+            var accepted = false;
+            for (var j = 0; j < message.payload.accounts.length; j++) {
+                if (index.import.operations[i].account.id == message.payload.accounts[j].id) {
+                    accepted = true;
+                }
+            }
+            if (!accepted) {
+                operations.push(index.import.operations[i]);
+            }
+        }
+        index.setInbox(operations);
+
+        // No operations left
+        if (operations.length == 0) {
+            index.sendAccountsList();
+            asticode.modaler.hide();
+            return
+        }
+
+        // Build modal content
         index.setModalContent();
     },
-    listenOperationsAdd: function() {
-        asticode.notifier.success("Operation successfully added!");
+    listenInboxList: function(message) {
+        index.setInbox(message.payload.operations);
+    },
+    listenInboxSkip: function() {
         index.nextOperation();
     },
+    listenProfilesList: function(message) {
+        var node = document.getElementById("profiles");
+        node.innerHTML = "";
+        var profiles = message.payload.profiles;
+        if (profiles.indexOf(message.payload.current) === -1) {
+            profiles.push(message.payload.current);
+        }
+        for (var i = 0; i < profiles.length; i++) {
+            var selected = "";
+            if (profiles[i] == message.payload.current) {
+                selected = " selected"
+            }
+            node.innerHTML += `<option value="` + profiles[i] + `"` + selected + `>` + profiles[i] + `</option>`;
+        }
+    },
+    listenProfilesPassphrase: function(message) {
+        // Build content
+        var content = document.createElement("div");
+        content.innerHTML = `
+        <label>Passphrase of profile ` + message.payload.name + `:</label>
+        <input type="password" id="content-passphrase"/>` + (message.payload.invalid ? `
+        <div class="amount-negative">Invalid passphrase</div>` : ``) + `
+        <div style="text-align: center">
+            <button class="btn-success" id="btn-profile-unlock">Unlock</button>
+        </div>
+        `;
+        content.style.textAlign = "left";
+
+        // Update modal
+        asticode.modaler.setContent(content);
+        document.getElementById("btn-profile-unlock").onclick = function() {
+            index.sendProfilesSwitch(message.payload.name, document.getElementById("content-passphrase").value);
+        };
+        document.getElementById('content-passphrase').onkeypress = function(e) {
+            if (e.keyCode == 13) {
+                document.getElementById("btn-profile-unlock").click();
+            }
+        };
+        asticode.modaler.show();
+        document.getElementById('content-passphrase').focus();
+    },
+    listenProfilesSwitch: function(message) {
+        asticode.modaler.hide();
+        asticode.notifier.success("Switched to profile " + message.payload.current);
+        index.listenProfilesList(message);
+        index.sendAccountsList();
+        index.sendInboxList();
+    },
     listenReferencesList: function(message) {
         index.references = message.payload;
     },
     nextOperation: function() {
         // Remove first operation
         index.import.operations.shift();
+        index.setInbox(index.import.operations);
 
         // No operations left
         if (index.import.operations.length == 0) {
@@ -111,42 +276,309 @@ var index = {
         // Build modal content
         index.setModalContent();
     },
+    notifyImportSummary: function(summary) {
+        for (var i = 0; i < summary.accounts.length; i++) {
+            var a = summary.accounts[i];
+            if (a.operations > 0) {
+                asticode.notifier.success(a.operations + " operation(s) added to " + (a.created ? "new " : "") + "account " + a.id + ", balance is now " + a.balance.value + " " + a.balance.currency);
+            }
+        }
+    },
     onClickAdd: function() {
         // Get values
         var category = document.getElementById("content-category").value;
         var label = document.getElementById("content-label").value;
         var subject = document.getElementById("content-subject").value;
 
+        // Check values
+        if (subject === "" || category === "" || label === "") {
+            asticode.notifier.error("Subject, category and label are required");
+            return
+        }
+
         // Send
         index.import.operations[0].operation.category = category;
         index.import.operations[0].operation.label = label;
         index.import.operations[0].operation.subject = subject;
-        index.sendOperationsAdd(index.import.operations[0].account, index.import.operations[0].operation);
+        index.sendInboxAccept(index.import.operations[0]);
+    },
+    onClickAcceptAll: function() {
+        index.sendInboxAcceptAll(index.import.operations[0].account.id);
+    },
+    onClickCSVProfileDelete: function(idx) {
+        index.sendCSVProfilesDelete(index.csvProfiles[idx].name);
+    },
+    onClickCSVProfileEdit: function(idx) {
+        document.getElementById("content-csv-profile").value = JSON.stringify(index.csvProfiles[idx], null, 2);
+    },
+    onClickCSVProfileSave: function() {
+        var profile;
+        try {
+            profile = JSON.parse(document.getElementById("content-csv-profile").value);
+        } catch (e) {
+            asticode.notifier.error("Profile is not valid JSON: " + e.message);
+            return
+        }
+        index.sendCSVProfilesSave(profile);
+    },
+    onClickCSVProfiles: function() {
+        index.sendCSVProfilesList();
+    },
+    onChangeProfile: function() {
+        index.sendProfilesSwitch(document.getElementById("profiles").value);
+    },
+    onClickProfileAdd: function() {
+        // Build content
+        var content = document.createElement("div");
+        content.innerHTML = `
+        <label>Profile name:</label>
+        <input type="text" id="content-profile"/>
+        <div style="text-align: center">
+            <button class="btn-success" id="btn-profile-create">Create</button>
+        </div>
+        `;
+        content.style.textAlign = "left";
+
+        // Update modal
+        asticode.modaler.setContent(content);
+        document.getElementById("btn-profile-create").onclick = function() {
+            index.sendProfilesSwitch(document.getElementById("content-profile").value);
+        };
+        document.getElementById('content-profile').onkeypress = function(e) {
+            if (e.keyCode == 13) {
+                document.getElementById("btn-profile-create").click();
+            }
+        };
+        asticode.modaler.show();
+        document.getElementById('content-profile').focus();
     },
     onClickImport: function() {
         astilectron.showOpenDialog({properties: ['openFile', 'multiSelections']}, function(paths) {
-            index.sendImport(paths);
+            index.sendImportPreview(paths);
         })
     },
+    onClickImportPreviewContinue: function() {
+        // Only files that can be imported are imported
+        var paths = [];
+        for (var i = 0; i < index.preview.files.length; i++) {
+            if (!index.preview.files[i].error) {
+                paths.push(index.preview.files[i].path);
+            }
+        }
+        asticode.modaler.hide();
+        index.sendImport(paths);
+    },
+    onClickInbox: function() {
+        // No operations to review
+        if (index.import.operations.length == 0) {
+            asticode.notifier.info("No operations waiting for review");
+            return
+        }
+
+        // Set modal content
+        index.setModalContent();
+    },
     onClickSkip: function() {
-        index.nextOperation();
+        index.sendInboxSkip(index.import.operations[0]);
+    },
+    possibleDuplicatesContent: function(operations) {
+        if (!operations || operations.length == 0) {
+            return "";
+        }
+        var html = `
+        <div style="margin-bottom: 15px">
+            <h3>Possible duplicates</h3>
+            <table style="width: 100%"><tbody>`;
+        for (var i = 0; i < operations.length; i++) {
+            html += `
+                <tr>
+                    <td>` + operations[i].date.split("T")[0] + `</td>
+                    <td>` + operations[i].raw_label + `</td>
+                    <td>` + index.formatAmount(operations[i]) + `</td>
+                </tr>`;
+        }
+        html += `
+            </tbody></table>
+        </div>`;
+        return html;
     },
     sendAccountsList: function() {
         asticode.loader.show();
         astilectron.send({name: "accounts.list"});
     },
+    sendCSVProfilesDelete: function(name) {
+        asticode.loader.show();
+        astilectron.send({name: "csvprofiles.delete", payload: name});
+    },
+    sendCSVProfilesList: function() {
+        asticode.loader.show();
+        astilectron.send({name: "csvprofiles.list"});
+    },
+    sendCSVProfilesSave: function(profile) {
+        asticode.loader.show();
+        astilectron.send({name: "csvprofiles.save", payload: profile});
+    },
+    sendHistoryRedo: function() {
+        asticode.loader.show();
+        astilectron.send({name: "history.redo"});
+    },
+    sendHistoryUndo: function() {
+        asticode.loader.show();
+        astilectron.send({name: "history.undo"});
+    },
     sendImport: function(paths) {
         asticode.loader.show();
         astilectron.send({name: "import", payload: paths});
     },
-    sendOperationsAdd: function(account, operation) {
+    sendImportPreview: function(paths) {
+        asticode.loader.show();
+        astilectron.send({name: "import.preview", payload: paths});
+    },
+    sendInboxAccept: function(operation) {
         asticode.loader.show();
-        astilectron.send({name: "operations.add", payload: {account: account, operation: operation}});
+        astilectron.send({name: "inbox.accept", payload: operation});
+    },
+    sendInboxAcceptAll: function(accountID) {
+        asticode.loader.show();
+        astilectron.send({name: "inbox.acceptAll", payload: accountID});
+    },
+    sendInboxList: function() {
+        asticode.loader.show();
+        astilectron.send({name: "inbox.list"});
+    },
+    sendInboxSkip: function(operation) {
+        asticode.loader.show();
+        astilectron.send({name: "inbox.skip", payload: operation});
+    },
+    sendProfilesList: function() {
+        asticode.loader.show();
+        astilectron.send({name: "profiles.list"});
+    },
+    sendProfilesSwitch: function(name, passphrase) {
+        asticode.loader.show();
+        astilectron.send({name: "profiles.switch", payload: {name: name, passphrase: passphrase}});
     },
     sendReferencesList: function() {
         asticode.loader.show();
         astilectron.send({name: "references.list"});
     },
+    setCSVProfilesModalContent: function() {
+        // Build content
+        var html = `
+        <div style="margin-bottom: 15px">
+            <h3>CSV profiles</h3>
+            <table style="width: 100%"><tbody>`;
+        for (var i = 0; i < index.csvProfiles.length; i++) {
+            html += `
+                <tr>
+                    <td>` + index.csvProfiles[i].name + `</td>
+                    <td style="text-align: right">
+                        <button class="btn-success" onclick="index.onClickCSVProfileEdit(` + i + `)"><i class="fa fa-pencil"></i></button>
+                        <button class="btn-danger" onclick="index.onClickCSVProfileDelete(` + i + `)"><i class="fa fa-trash"></i></button>
+                    </td>
+                </tr>`;
+        }
+        html += `
+            </tbody></table>
+        </div>
+        <div style="margin-bottom: 15px">
+            <label>Profile, a profile with the same name is replaced:</label>
+            <textarea id="content-csv-profile" style="font-family: monospace; height: 300px; width: 100%"></textarea>
+        </div>
+        <div style="text-align: center">
+            <button class="btn-success" onclick="index.onClickCSVProfileSave()">Save</button>
+        </div>
+        `;
+        var content = document.createElement("div");
+        content.innerHTML = html;
+        content.style.textAlign = "left";
+
+        // Update modal
+        asticode.modaler.setContent(content);
+        document.getElementById("content-csv-profile").value = JSON.stringify({
+            name: "",
+            delimiter: ";",
+            header_rows: 1,
+            date_layout: "02/01/2006",
+            decimal_separator: ",",
+            newest_first: false,
+            columns: {date: "0", label: ["1"], amount: "2"},
+            account: {id: "", currency: "EUR"}
+        }, null, 2);
+        asticode.modaler.show();
+    },
+    setInbox: function(operations) {
+        index.import = {
+            operations: operations,
+        };
+        document.getElementById("btn-inbox").innerHTML = "Inbox (" + operations.length + ")";
+    },
+    setImportPreviewModalContent: function() {
+        // Build content
+        var html = `<h3>Import preview</h3>`;
+        var importable = false;
+        for (var i = 0; i < index.preview.files.length; i++) {
+            var f = index.preview.files[i];
+            html += `
+            <div style="margin-bottom: 15px">
+                <h4>` + f.path + `</h4>`;
+            if (f.error) {
+                html += `
+                <div class="amount-negative">` + f.error + `</div>
+            </div>`;
+                continue;
+            }
+            importable = true;
+            html += `
+                <table style="width: 100%"><tbody>
+                    <tr>
+                        <td>Format:</td>
+                        <td>` + f.format + ` encoded in ` + f.text.encoding + `</td>
+                    </tr>
+                    <tr>
+                        <td>Account:</td>
+                        <td>` + f.account_id + (f.new_account ? ` (new)` : ``) + `</td>
+                    </tr>
+                    <tr>
+                        <td>New operations:</td>
+                        <td>` + f.operations.length + `</td>
+                    </tr>
+                    <tr>
+                        <td>Duplicates:</td>
+                        <td>` + f.duplicates.length + `</td>
+                    </tr>
+                </tbody></table>`;
+            if (f.errors.length > 0) {
+                html += `
+                <table style="width: 100%"><tbody>`;
+                for (var j = 0; j < f.errors.length; j++) {
+                    html += `
+                    <tr>
+                        <td>Line ` + f.errors[j].line + `</td>
+                        <td style="font-family: monospace">` + f.errors[j].content + `</td>
+                        <td class="amount-negative">` + f.errors[j].error + `</td>
+                    </tr>`;
+                }
+                html += `
+                </tbody></table>`;
+            }
+            html += `
+            </div>`;
+        }
+        if (importable) {
+            html += `
+            <div style="text-align: center">
+                <button class="btn-success" onclick="index.onClickImportPreviewContinue()">Import valid lines</button>
+            </div>`;
+        }
+        var content = document.createElement("div");
+        content.innerHTML = html;
+        content.style.textAlign = "left";
+
+        // Update modal
+        asticode.modaler.setContent(content);
+        asticode.modaler.show();
+    },
     setModalContent: function() {
         // Build content
         var html = `
@@ -167,10 +599,11 @@ var index = {
                 </tr>
                 <tr>
                     <td>Amount:</td>
-                    <td>` + index.import.operations[0].operation.amount + `€</td>
+                    <td>` + index.formatAmount(index.import.operations[0].operation) + `</td>
                 </tr>
             </tbody></table>
         </div>
+        ` + index.possibleDuplicatesContent(index.import.operations[0].possible_duplicates) + `
         <div style="margin-bottom: 15px">
             <h3>Custom data</h3>
             <label>Subject:</label>
@@ -195,6 +628,9 @@ var index = {
             <div style="display: inline-block">
                 <button class="btn-danger" onclick="index.onClickSkip()">Skip</button>
             </div>
+            <div style="display: inline-block">
+                <button class="btn-success" onclick="index.onClickAcceptAll()">Accept all of account</button>
+            </div>
         </div>
         `;
         var content = document.createElement("div");
@@ -1,4 +1,11 @@
 var operations = {
+    formatAmount: function(operation) {
+        var s = operation.amount.value + " " + operation.amount.currency;
+        if (operation.original_amount.currency !== operation.amount.currency) {
+            s += "<br/><small>" + operation.original_amount.value + " " + operation.original_amount.currency + "</small>";
+        }
+        return s;
+    },
     init: function() {
         // Init
         asticode.loader.init();
@@ -18,6 +25,10 @@ var operations = {
 
             // Refresh list operations
             operations.sendOperationsList();
+
+            // Handle history
+            document.getElementById("btn-redo").onclick = operations.sendHistoryRedo;
+            document.getElementById("btn-undo").onclick = operations.sendHistoryUndo;
         });
     },
     listen: function() {
@@ -27,6 +38,13 @@ var operations = {
                 case "error":
                     operations.listenError(message);
                     break;
+                case "history.redo":
+                case "history.undo":
+                    operations.listenHistory(message);
+                    break;
+                case "operations.delete":
+                    operations.listenOperationsDelete(message);
+                    break;
                 case "operations.list":
                     operations.listenOperationsList(message);
                     break;
@@ -36,6 +54,9 @@ var operations = {
                 case "operations.update":
                     operations.listenOperationsUpdate(message);
                     break;
+                case "reconcile.status":
+                    operations.listenReconcileStatus(message);
+                    break;
                 case "references.list":
                     operations.listenReferencesList(message);
                     break;
@@ -45,12 +66,21 @@ var operations = {
     listenError: function(message) {
         asticode.notifier.error(message.payload);
     },
+    listenHistory: function(message) {
+        asticode.notifier.success("Last " + message.payload.name + " has been " + message.name.split(".")[1] + "ne");
+        operations.sendOperationsList();
+    },
+    listenOperationsDelete: function() {
+        asticode.modaler.hide();
+        asticode.notifier.success("Operation successfully deleted!");
+        operations.sendOperationsList();
+    },
     listenOperationsList: function(message) {
         var node = document.getElementById("operations");
         var html = `<div class="operations-container"><table class="operations-table"><tbody>`;
         for (var i = message.payload.length - 1; i >= 0; i--) {
             var className = "amount-negative";
-            if (message.payload[i].amount > 0) {
+            if (parseFloat(message.payload[i].amount.value) > 0) {
                 className = "amount-positive";
             }
             html += `
@@ -59,12 +89,16 @@ var operations = {
                     <td class="operations-cell" style="text-align: center; width: 200px">` + message.payload[i].subject + `</td>
                     <td class="operations-cell" style="text-align: center; width: 100px">` + message.payload[i].category + `</td>
                     <td class="operations-cell">` + message.payload[i].label + `</td>
-                    <td class="operations-cell ` + className + `" style="text-align: right; width: 100px">` + message.payload[i].amount.toFixed(2) + `€</td>
+                    <td class="operations-cell ` + className + `" style="text-align: right; width: 100px">` + operations.formatAmount(message.payload[i]) + `</td>
+                    <td class="operations-cell" style="text-align: right; width: 100px">` + message.payload[i].balance.value + ` ` + message.payload[i].balance.currency + `</td>
                 </tr>
             `;
         }
         html += "</tbody></table></div>";
         node.innerHTML = html;
+
+        // Refresh reconciliation status
+        operations.sendReconcileStatus();
     },
     listenOperationsOne: function(message) {
         // Build button
@@ -73,6 +107,13 @@ var operations = {
         btn.className = "btn-lg btn-success";
         btn.onclick = operations.onClickUpdate(message.payload);
 
+        // Build delete button
+        var btnDelete = document.createElement("button");
+        btnDelete.innerText = "Delete";
+        btnDelete.className = "btn-lg btn-danger";
+        btnDelete.style.marginTop = "10px";
+        btnDelete.onclick = operations.onClickDelete(message.payload);
+
         // Build content
         var html = `
         <label>Subject:</label>
@@ -95,6 +136,7 @@ var operations = {
         content.innerHTML = html;
         content.style.textAlign = "left";
         content.appendChild(btn);
+        content.appendChild(btnDelete);
 
         // Update modal
         asticode.modaler.setContent(content);
@@ -109,9 +151,39 @@ var operations = {
         asticode.modaler.hide();
         operations.sendOperationsList();
     },
+    listenReconcileStatus: function(message) {
+        var node = document.getElementById("reconciliation");
+        var s = message.payload.status;
+        if (s === null) {
+            node.innerHTML = "";
+            return;
+        }
+        var date = s.point.date.split("T")[0];
+        if (s.reconciled) {
+            node.innerHTML = `<div class="reconciliation amount-positive">Balance matches the statement of ` + date + `</div>`;
+            return;
+        }
+        var html = `<div class="reconciliation amount-negative">Balance differs by ` + s.difference.value + ` ` + s.difference.currency + ` from the statement of ` + date + `: `;
+        switch (s.divergence.reason) {
+            case "missing":
+                html += `operation "` + s.divergence.statement_operation.raw_label + `" of ` + s.divergence.date.split("T")[0] + ` is missing`;
+                break;
+            case "unexpected":
+                html += `operation "` + s.divergence.operation.label + `" of ` + s.divergence.date.split("T")[0] + ` is not in the statement`;
+                break;
+            default:
+                html += `the difference comes from before ` + s.divergence.date.split("T")[0];
+        }
+        node.innerHTML = html + `</div>`;
+    },
     listenReferencesList: function(message) {
         operations.references = message.payload;
     },
+    onClickDelete: function(operation) {
+        return function() {
+            operations.sendOperationsDelete(operation);
+        };
+    },
     onClickUpdate: function(operation) {
         return function() {
             operation.category = document.getElementById("content-category").value;
@@ -120,6 +192,18 @@ var operations = {
             operations.sendOperationsUpdate(operation);
         };
     },
+    sendHistoryRedo: function() {
+        asticode.loader.show();
+        astilectron.send({name: "history.redo"});
+    },
+    sendHistoryUndo: function() {
+        asticode.loader.show();
+        astilectron.send({name: "history.undo"});
+    },
+    sendOperationsDelete: function(operation) {
+        asticode.loader.show();
+        astilectron.send({name: "operations.delete", payload: {account: {id: operations.account_id}, operation: {id: operation.id}}});
+    },
     sendOperationsList: function() {
         asticode.loader.show();
         astilectron.send({name: "operations.list", payload: operations.account_id});
@@ -132,6 +216,10 @@ var operations = {
         asticode.loader.show();
         astilectron.send({name: "operations.update", payload: {account: {id: operations.account_id}, operation: operation}});
     },
+    sendReconcileStatus: function() {
+        asticode.loader.show();
+        astilectron.send({name: "reconcile.status", payload: operations.account_id});
+    },
     sendReferencesList: function() {
         asticode.loader.show();
         astilectron.send({name: "references.list"});
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// Store types
+const (
+	storeTypeBolt = "bolt"
+	storeTypeFile = "file"
+)
+
+// Store change kinds
+const (
+	storeChangeKindAccountCreated   = "account.created"
+	storeChangeKindAccountUpdated   = "account.updated"
+	storeChangeKindMetadataUpdated  = "metadata.updated"
+	storeChangeKindOperationAdded   = "operation.added"
+	storeChangeKindOperationDeleted = "operation.deleted"
+	storeChangeKindOperationUpdated = "operation.updated"
+)
+
+// Store represents a storage backend
+type Store interface {
+	Close() error
+	Load() (dataStored, error)
+	Write(cs []StoreChange) error
+}
+
+// snapshotStore represents a store that persists snapshots of the whole data
+type snapshotStore interface {
+	Snapshot(ds dataStored) error
+}
+
+// StoreChange represents a change that needs to be persisted
+type StoreChange struct {
+	Account   *Account
+	AccountID string
+	Key       string
+	Kind      string
+	Operation *Operation
+	Value     []byte
+}
+
+// storePath returns the path of a store based on its type
+func storePath(baseDirPath, storeType string) string {
+	if storeType == storeTypeBolt {
+		return filepath.Join(baseDirPath, "data.db")
+	}
+	return dataPath(baseDirPath)
+}
+
+// newStore creates a new store based on its type
+func newStore(path string, o DataOptions, readOnly bool) (s Store, err error) {
+	switch o.StoreType {
+	case storeTypeBolt:
+		return newBoltStore(path, readOnly)
+	case storeTypeFile, "":
+		return newFileStore(path, o.Passphrase, readOnly), nil
+	default:
+		err = fmt.Errorf("unknown store type %s", o.StoreType)
+		return
+	}
+}
+
+// writeStore writes data in an empty store
+func writeStore(s Store, ds dataStored) (err error) {
+	// Write
+	if err = s.Write(newStoreChanges(ds)); err != nil {
+		err = errors.Wrap(err, "writing changes failed")
+		return
+	}
+
+	// Snapshot
+	if ss, ok := s.(snapshotStore); ok {
+		if err = ss.Snapshot(ds); err != nil {
+			err = errors.Wrap(err, "snapshotting failed")
+			return
+		}
+	}
+	return
+}
+
+// newStoreChanges creates the store changes needed to write data in an empty store
+func newStoreChanges(ds dataStored) (cs []StoreChange) {
+	for _, as := range ds.Accounts {
+		cs = append(cs, newStoreChangeAccount(storeChangeKindAccountCreated, as.Account))
+		for _, o := range as.Operations {
+			cs = append(cs, newStoreChangeOperation(storeChangeKindOperationAdded, as.ID, o))
+		}
+	}
+	for k, v := range ds.Metadata {
+		cs = append(cs, newStoreChangeMetadata(k, v))
+	}
+	return
+}
+
+// newStoreChangeAccount creates a new store change for an account
+func newStoreChangeAccount(kind string, a *Account) StoreChange {
+	var c = *a
+	c.Operations = nil
+	return StoreChange{Account: &c, AccountID: a.ID, Kind: kind}
+}
+
+// newStoreChangeMetadata creates a new store change for a metadata
+func newStoreChangeMetadata(key string, value []byte) StoreChange {
+	return StoreChange{Key: key, Kind: storeChangeKindMetadataUpdated, Value: value}
+}
+
+// newStoreChangeOperation creates a new store change for an operation
+func newStoreChangeOperation(kind, accountID string, o *Operation) StoreChange {
+	var c = *o
+	return StoreChange{AccountID: accountID, Kind: kind, Operation: &c}
+}
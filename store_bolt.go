@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bolt buckets
+// Operations are stored in a nested bucket per account and are indexed by their big endian id
+var (
+	boltBucketAccounts   = []byte("accounts")
+	boltBucketMetadata   = []byte("metadata")
+	boltBucketOperations = []byte("operations")
+	boltBucketStore      = []byte("store")
+	boltKeyVersion       = []byte("version")
+)
+
+// boltStore represents a store persisting data incrementally in an embedded key/value database
+// Read-only stores are opened from a copy of the db which is removed once closed
+type boltStore struct {
+	copyPath string
+	db       *bolt.DB
+	path     string
+}
+
+// newBoltStore creates a new bolt store
+func newBoltStore(path string, readOnly bool) (s *boltStore, err error) {
+	// Init
+	s = &boltStore{path: path}
+
+	// Copy db since bolt can't open it, even in read-only mode, while another instance holds its exclusive lock
+	var p = path
+	if readOnly {
+		if s.copyPath, err = copyBoltDB(path); err != nil {
+			err = errors.Wrapf(err, "copying %s failed", path)
+			return
+		}
+		p = s.copyPath
+	}
+
+	// Open db
+	if s.db, err = bolt.Open(p, 0600, &bolt.Options{ReadOnly: readOnly, Timeout: time.Second}); err != nil {
+		s.removeCopy()
+		err = errors.Wrapf(err, "opening %s failed", p)
+		return
+	}
+
+	// Read-only dbs can't be initialized nor migrated
+	if readOnly {
+		if err = s.db.View(func(tx *bolt.Tx) (err error) {
+			if b := tx.Bucket(boltBucketStore); b != nil {
+				if v := b.Get(boltKeyVersion); v != nil {
+					if version := int(binary.BigEndian.Uint64(v)); version != dataVersion {
+						err = fmt.Errorf("store version %d needs to be migrated to %d which requires opening it in read-write mode", version, dataVersion)
+					}
+				}
+			}
+			return
+		}); err != nil {
+			s.Close()
+			err = errors.Wrapf(err, "checking %s failed", path)
+		}
+		return
+	}
+
+	// Init db
+	var version int
+	if err = s.db.Update(func(tx *bolt.Tx) (err error) {
+		// Create buckets
+		for _, n := range [][]byte{boltBucketAccounts, boltBucketMetadata, boltBucketOperations, boltBucketStore} {
+			if _, err = tx.CreateBucketIfNotExists(n); err != nil {
+				err = errors.Wrapf(err, "creating bucket %s failed", n)
+				return
+			}
+		}
+
+		// Check version
+		var b = tx.Bucket(boltBucketStore)
+		if v := b.Get(boltKeyVersion); v == nil {
+			version = dataVersion
+			err = b.Put(boltKeyVersion, boltKey(dataVersion))
+		} else if version = int(binary.BigEndian.Uint64(v)); version > dataVersion {
+			err = fmt.Errorf("store version %d is more recent than supported version %d", version, dataVersion)
+		}
+		return
+	}); err != nil {
+		s.db.Close()
+		err = errors.Wrapf(err, "initializing %s failed", path)
+		return
+	}
+
+	// Migrate db
+	if version < dataVersion {
+		if err = s.migrate(version); err != nil {
+			s.db.Close()
+			err = errors.Wrapf(err, "migrating %s failed", path)
+			return
+		}
+	}
+	return
+}
+
+// copyBoltDB copies a bolt db to a temp file
+// The copy is made again if the db has been modified while being copied so that it's consistent
+func copyBoltDB(path string) (p string, err error) {
+	for i := 0; i < 3; i++ {
+		// Stat
+		var before, after os.FileInfo
+		if before, err = os.Stat(path); err != nil {
+			err = errors.Wrapf(err, "stating %s failed", path)
+			return
+		}
+
+		// Read
+		var b []byte
+		if b, err = ioutil.ReadFile(path); err != nil {
+			err = errors.Wrapf(err, "reading %s failed", path)
+			return
+		}
+
+		// Db has been modified
+		if after, err = os.Stat(path); err != nil {
+			err = errors.Wrapf(err, "stating %s failed", path)
+			return
+		} else if !after.ModTime().Equal(before.ModTime()) || after.Size() != before.Size() || int64(len(b)) != after.Size() {
+			continue
+		}
+
+		// Write
+		var f *os.File
+		if f, err = ioutil.TempFile("", "astibank-*.db"); err != nil {
+			err = errors.Wrap(err, "creating temp file failed")
+			return
+		}
+		if _, err = f.Write(b); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			err = errors.Wrapf(err, "writing %s failed", f.Name())
+			return
+		}
+		if err = f.Close(); err != nil {
+			os.Remove(f.Name())
+			err = errors.Wrapf(err, "closing %s failed", f.Name())
+			return
+		}
+		p = f.Name()
+		return
+	}
+	err = fmt.Errorf("%s keeps being modified", path)
+	return
+}
+
+// removeCopy removes the copy of the db if any
+func (s *boltStore) removeCopy() {
+	if s.copyPath == "" {
+		return
+	}
+	if err := os.Remove(s.copyPath); err != nil {
+		astilog.Error(errors.Wrapf(err, "removing %s failed", s.copyPath))
+	}
+	s.copyPath = ""
+}
+
+// boltMigrations upgrade a bolt store in place and are indexed by the version they upgrade from
+var boltMigrations = map[int]func(tx *bolt.Tx) error{
+	1: migrateBoltV1ToV2,
+}
+
+// migrate migrates the store step by step up to the current version
+// A copy of the store is kept and all steps are run in the same transaction so that a failure leaves it untouched
+func (s *boltStore) migrate(version int) (err error) {
+	// Copy
+	var p = fmt.Sprintf("%s.v%d", s.path, version)
+	if _, errStat := os.Stat(p); os.IsNotExist(errStat) {
+		if err = s.Backup(p); err != nil {
+			err = errors.Wrapf(err, "copying %s to %s failed", s.path, p)
+			return
+		}
+	}
+
+	// Migrate
+	return s.db.Update(func(tx *bolt.Tx) (err error) {
+		for v := version; v < dataVersion; v++ {
+			// Fetch migration
+			m, ok := boltMigrations[v]
+			if !ok {
+				err = fmt.Errorf("no migration from version %d", v)
+				return
+			}
+
+			// Migrate
+			astilog.Debugf("Migrating store from version %d to %d", v, v+1)
+			if err = m(tx); err != nil {
+				err = errors.Wrapf(err, "migrating from version %d to %d failed", v, v+1)
+				return
+			}
+		}
+		return tx.Bucket(boltBucketStore).Put(boltKeyVersion, boltKey(dataVersion))
+	})
+}
+
+// migrateBoltV1ToV2 replaces float amounts with fixed-point money
+func migrateBoltV1ToV2(tx *bolt.Tx) (err error) {
+	// Loop through accounts
+	var ab = tx.Bucket(boltBucketAccounts)
+	var avs = make(map[string][]byte)
+	if err = ab.ForEach(func(k, v []byte) (err error) {
+		// Decode
+		var a = &accountV0{}
+		if err = boltDecode(v, a); err != nil {
+			err = errors.Wrapf(err, "decoding account %s failed", k)
+			return
+		}
+
+		// Convert
+		var ao *accountV2
+		if ao, err = migrateAccountV1ToV2(a); err != nil {
+			return
+		}
+
+		// Encode
+		if avs[string(k)], err = boltEncode(ao); err != nil {
+			err = errors.Wrapf(err, "encoding account %s failed", k)
+			return
+		}
+		return
+	}); err != nil {
+		return
+	}
+
+	// Values can't be modified while looping through a bucket
+	for k, v := range avs {
+		if err = ab.Put([]byte(k), v); err != nil {
+			err = errors.Wrapf(err, "putting account %s failed", k)
+			return
+		}
+	}
+
+	// Fetch operation buckets
+	var ob = tx.Bucket(boltBucketOperations)
+	var ks [][]byte
+	if err = ob.ForEach(func(k, _ []byte) error {
+		ks = append(ks, append([]byte{}, k...))
+		return nil
+	}); err != nil {
+		return
+	}
+
+	// Loop through operation buckets
+	for _, k := range ks {
+		// Fetch bucket
+		var b = ob.Bucket(k)
+		if b == nil {
+			continue
+		}
+
+		// Loop through operations
+		var ovs = make(map[string][]byte)
+		if err = b.ForEach(func(k, v []byte) (err error) {
+			// Decode
+			var o = &operationV0{}
+			if err = boltDecode(v, o); err != nil {
+				err = errors.Wrapf(err, "decoding operation %d failed", binary.BigEndian.Uint64(k))
+				return
+			}
+
+			// Convert
+			var oo *operationV2
+			if oo, err = migrateOperationV1ToV2(o); err != nil {
+				return
+			}
+
+			// Encode
+			if ovs[string(k)], err = boltEncode(oo); err != nil {
+				err = errors.Wrapf(err, "encoding operation %d failed", o.ID)
+				return
+			}
+			return
+		}); err != nil {
+			err = errors.Wrapf(err, "looping through operations of account %s failed", k)
+			return
+		}
+
+		// Put
+		for k, v := range ovs {
+			if err = b.Put([]byte(k), v); err != nil {
+				err = errors.Wrapf(err, "putting operation %d failed", binary.BigEndian.Uint64([]byte(k)))
+				return
+			}
+		}
+	}
+	return
+}
+
+// boltKey returns the key of an id
+func boltKey(id int) []byte {
+	var b = make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(id))
+	return b
+}
+
+// boltEncode encodes a value
+func boltEncode(v interface{}) (b []byte, err error) {
+	var buf = &bytes.Buffer{}
+	if err = gob.NewEncoder(buf).Encode(v); err != nil {
+		return
+	}
+	b = buf.Bytes()
+	return
+}
+
+// boltDecode decodes a value
+func boltDecode(b []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(b)).Decode(v)
+}
+
+// Backup implements the backupStore interface
+func (s *boltStore) Backup(path string) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(path, 0600)
+	})
+}
+
+// Path implements the backupStore interface
+func (s *boltStore) Path() string {
+	return s.path
+}
+
+// Close implements the Store interface
+func (s *boltStore) Close() error {
+	defer s.removeCopy()
+	return s.db.Close()
+}
+
+// Load implements the Store interface
+func (s *boltStore) Load() (ds dataStored, err error) {
+	astilog.Debugf("Importing data from %s", s.path)
+	err = s.db.View(func(tx *bolt.Tx) (err error) {
+		// Loop through accounts
+		var ob = tx.Bucket(boltBucketOperations)
+		if err = tx.Bucket(boltBucketAccounts).ForEach(func(k, v []byte) (err error) {
+			// Decode account
+			var as = AccountStored{Account: &Account{}}
+			if err = boltDecode(v, as.Account); err != nil {
+				err = errors.Wrapf(err, "decoding account %s failed", k)
+				return
+			}
+
+			// Loop through operations
+			if b := ob.Bucket(k); b != nil {
+				if err = b.ForEach(func(k, v []byte) (err error) {
+					var o = &Operation{}
+					if err = boltDecode(v, o); err != nil {
+						err = errors.Wrapf(err, "decoding operation %d failed", binary.BigEndian.Uint64(k))
+						return
+					}
+					as.Operations = append(as.Operations, o)
+					return
+				}); err != nil {
+					err = errors.Wrapf(err, "looping through operations of account %s failed", k)
+					return
+				}
+			}
+			ds.Accounts = append(ds.Accounts, as)
+			return
+		}); err != nil {
+			err = errors.Wrap(err, "looping through accounts failed")
+			return
+		}
+
+		// Loop through metadata
+		ds.Metadata = make(map[string][]byte)
+		if err = tx.Bucket(boltBucketMetadata).ForEach(func(k, v []byte) error {
+			ds.Metadata[string(k)] = append([]byte{}, v...)
+			return nil
+		}); err != nil {
+			err = errors.Wrap(err, "looping through metadata failed")
+			return
+		}
+		return
+	})
+	return
+}
+
+// Write implements the Store interface
+// Changes are written in a single transaction
+func (s *boltStore) Write(cs []StoreChange) error {
+	return s.db.Update(func(tx *bolt.Tx) (err error) {
+		for _, c := range cs {
+			if err = s.write(tx, c); err != nil {
+				err = errors.Wrapf(err, "writing change %s failed", c.Kind)
+				return
+			}
+		}
+		return
+	})
+}
+
+// write writes a change in a transaction
+func (s *boltStore) write(tx *bolt.Tx, c StoreChange) (err error) {
+	switch c.Kind {
+	case storeChangeKindAccountCreated, storeChangeKindAccountUpdated:
+		var b []byte
+		if b, err = boltEncode(c.Account); err != nil {
+			err = errors.Wrapf(err, "encoding account %s failed", c.AccountID)
+			return
+		}
+		return tx.Bucket(boltBucketAccounts).Put([]byte(c.AccountID), b)
+	case storeChangeKindMetadataUpdated:
+		return tx.Bucket(boltBucketMetadata).Put([]byte(c.Key), c.Value)
+	case storeChangeKindOperationAdded, storeChangeKindOperationUpdated:
+		var b *bolt.Bucket
+		if b, err = tx.Bucket(boltBucketOperations).CreateBucketIfNotExists([]byte(c.AccountID)); err != nil {
+			err = errors.Wrapf(err, "creating bucket for account %s failed", c.AccountID)
+			return
+		}
+		var v []byte
+		if v, err = boltEncode(c.Operation); err != nil {
+			err = errors.Wrapf(err, "encoding operation %d failed", c.Operation.ID)
+			return
+		}
+		return b.Put(boltKey(c.Operation.ID), v)
+	case storeChangeKindOperationDeleted:
+		if b := tx.Bucket(boltBucketOperations).Bucket([]byte(c.AccountID)); b != nil {
+			return b.Delete(boltKey(c.Operation.ID))
+		}
+		return
+	default:
+		return fmt.Errorf("unknown change kind %s", c.Kind)
+	}
+}
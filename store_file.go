@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// fileStore represents a store persisting snapshots of the data in a single file
+// Changes made between snapshots are appended to a journal which is replayed on load
+// The file and the journal are encrypted once a passphrase has been set
+type fileStore struct {
+	encrypter  *encrypter
+	journal    *journal
+	passphrase func() ([]byte, error)
+	path       string
+	readOnly   bool
+}
+
+// newFileStore creates a new file store
+// passphrase is only called if the file is encrypted
+func newFileStore(path string, passphrase func() ([]byte, error), readOnly bool) *fileStore {
+	return &fileStore{
+		journal:    newJournal(journalPath(path)),
+		passphrase: passphrase,
+		path:       path,
+		readOnly:   readOnly,
+	}
+}
+
+// Close implements the Store interface
+func (s *fileStore) Close() error {
+	return s.journal.close()
+}
+
+// Load implements the Store interface
+func (s *fileStore) Load() (ds dataStored, err error) {
+	// Load snapshot
+	if ds, err = s.loadSnapshot(); err != nil {
+		err = errors.Wrap(err, "loading snapshot failed")
+		return
+	}
+
+	// Read journal
+	var rs []journalRecord
+	var end int64
+	if rs, end, err = s.journal.read(s.encrypter); err != nil {
+		err = errors.Wrapf(err, "reading journal %s failed", s.journal.path)
+		return
+	}
+
+	// Drop what follows the last valid record so that new records are appended right after it
+	if fi, errStat := os.Stat(s.journal.path); errStat == nil && fi.Size() > end && !s.readOnly {
+		if err = s.journal.truncateAt(end); err != nil {
+			err = errors.Wrapf(err, "truncating journal %s failed", s.journal.path)
+			return
+		}
+	}
+
+	// Replay journal
+	if len(rs) > 0 {
+		astilog.Debugf("Replaying %d record(s) of journal %s", len(rs), s.journal.path)
+		for _, r := range rs {
+			ds.apply(r.Changes)
+		}
+	}
+	return
+}
+
+// loadSnapshot loads the snapshot stored in the data file
+func (s *fileStore) loadSnapshot() (ds dataStored, err error) {
+	// Read data file
+	var b []byte
+	if b, err = ioutil.ReadFile(s.path); os.IsNotExist(err) {
+		astilog.Debugf("%s doesn't exist, working with new data", s.path)
+		err = nil
+		return
+	} else if err != nil {
+		err = errors.Wrapf(err, "reading %s failed", s.path)
+		return
+	}
+
+	// Decrypt data file
+	var plain = b
+	if isEncrypted(b) {
+		if plain, err = s.decrypt(b); err != nil {
+			err = errors.Wrapf(err, "decrypting %s failed", s.path)
+			return
+		}
+	}
+
+	// Parse data file
+	// Migrations happen in memory so that the file is left untouched if one of them fails
+	astilog.Debugf("Importing data from %s", s.path)
+	var version int
+	if ds, version, err = readDataFile(plain); err != nil {
+		err = errors.Wrapf(err, "reading data file %s failed", s.path)
+		return
+	}
+
+	// Data has been migrated: keep a copy of the original file since it will be overwritten on next save
+	if version < dataVersion && !s.readOnly {
+		var p = fmt.Sprintf("%s.v%d", s.path, version)
+		if _, errStat := os.Stat(p); os.IsNotExist(errStat) {
+			if err = ioutil.WriteFile(p, b, 0600); err != nil {
+				err = errors.Wrapf(err, "copying %s to %s failed", s.path, p)
+				return
+			}
+		}
+	}
+	return
+}
+
+// Backup implements the backupStore interface
+// The journal is copied next to the backup so that the changes made since the last snapshot are backed up as well
+func (s *fileStore) Backup(path string) (err error) {
+	// Nothing to back up
+	if _, err = os.Stat(s.path); os.IsNotExist(err) {
+		err = nil
+		return
+	} else if err != nil {
+		err = errors.Wrapf(err, "stating %s failed", s.path)
+		return
+	}
+
+	// Copy
+	if err = copyFileAtomic(s.path, path); err != nil {
+		err = errors.Wrapf(err, "copying %s to %s failed", s.path, path)
+		return
+	}
+
+	// Copy journal
+	if fi, errStat := os.Stat(s.journal.path); errStat == nil && fi.Size() > 0 {
+		if err = copyFileAtomic(s.journal.path, journalPath(path)); err != nil {
+			err = errors.Wrapf(err, "copying %s to %s failed", s.journal.path, journalPath(path))
+			return
+		}
+	}
+	return
+}
+
+// dataFilePassphrase returns the passphrase of an encrypted data file after checking it by decrypting the file
+// No passphrase is returned if the data file doesn't exist or is not encrypted
+func dataFilePassphrase(path string, passphrase func() ([]byte, error)) (p []byte, err error) {
+	// Read data file
+	var b []byte
+	if b, err = ioutil.ReadFile(path); os.IsNotExist(err) {
+		err = nil
+		return
+	} else if err != nil {
+		err = errors.Wrapf(err, "reading %s failed", path)
+		return
+	}
+
+	// Not encrypted
+	if !isEncrypted(b) {
+		return
+	}
+
+	// Fetch passphrase
+	if passphrase == nil {
+		err = errMissingPassphrase
+		return
+	}
+	if p, err = passphrase(); err != nil {
+		err = errors.Wrap(err, "fetching passphrase failed")
+		return
+	}
+
+	// Decrypt
+	if _, err = newFileStore(path, func() ([]byte, error) { return p, nil }, true).decrypt(b); err != nil {
+		err = errors.Wrapf(err, "decrypting %s failed", path)
+		return
+	}
+	return
+}
+
+// dataFileEncrypted checks whether a data file is encrypted
+func dataFileEncrypted(path string) (ok bool, err error) {
+	// Open
+	var f *os.File
+	if f, err = os.Open(path); err != nil {
+		err = errors.Wrapf(err, "opening %s failed", path)
+		return
+	}
+	defer f.Close()
+
+	// Read header
+	var b = make([]byte, len(encryptionMagic))
+	var n int
+	if n, err = io.ReadFull(f, b); err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		err = errors.Wrapf(err, "reading %s failed", path)
+		return
+	}
+	err = nil
+	ok = isEncrypted(b[:n])
+	return
+}
+
+// Path implements the backupStore interface
+func (s *fileStore) Path() string {
+	return s.path
+}
+
+// decrypt decrypts the content of the data file with the passphrase
+func (s *fileStore) decrypt(b []byte) (plain []byte, err error) {
+	// Fetch passphrase
+	if s.passphrase == nil {
+		err = errMissingPassphrase
+		return
+	}
+	var p []byte
+	if p, err = s.passphrase(); err != nil {
+		err = errors.Wrap(err, "fetching passphrase failed")
+		return
+	}
+
+	// Create encrypter
+	if s.encrypter, err = newEncrypterForContent(p, b); err != nil {
+		err = errors.Wrap(err, "creating encrypter failed")
+		return
+	}
+
+	// Open
+	if plain, err = s.encrypter.open(b); err != nil {
+		err = errors.Wrap(err, "opening failed")
+		return
+	}
+	return
+}
+
+// setPassphrase sets the passphrase used to encrypt the data file
+// An empty passphrase disables encryption
+func (s *fileStore) setPassphrase(p []byte) (err error) {
+	if len(p) == 0 {
+		s.encrypter = nil
+		return
+	}
+	if s.encrypter, err = newEncrypter(p, nil); err != nil {
+		err = errors.Wrap(err, "creating encrypter failed")
+		return
+	}
+	return
+}
+
+// Write implements the Store interface
+// Changes are appended to the journal until the next snapshot
+func (s *fileStore) Write(cs []StoreChange) (err error) {
+	if s.readOnly {
+		err = errReadOnly
+		return
+	}
+	if err = s.journal.append(journalRecord{Changes: cs, Time: time.Now(), Version: dataVersion}, s.encrypter); err != nil {
+		err = errors.Wrapf(err, "appending to journal %s failed", s.journal.path)
+		return
+	}
+	return
+}
+
+// Snapshot implements the snapshotStore interface
+func (s *fileStore) Snapshot(ds dataStored) (err error) {
+	// Read-only
+	if s.readOnly {
+		err = errReadOnly
+		return
+	}
+
+	// Build data file
+	var buf = &bytes.Buffer{}
+	if err = writeDataFile(buf, ds); err != nil {
+		err = errors.Wrap(err, "writing data file failed")
+		return
+	}
+	var b = buf.Bytes()
+
+	// Encrypt data file
+	if s.encrypter != nil {
+		if b, err = s.encrypter.seal(b); err != nil {
+			err = errors.Wrap(err, "encrypting data file failed")
+			return
+		}
+	}
+
+	// Write data file
+	astilog.Debugf("Exporting data to %s", s.path)
+	if err = writeFileAtomic(s.path, b); err != nil {
+		err = errors.Wrapf(err, "writing %s failed", s.path)
+		return
+	}
+
+	// Compact journal now that its records are part of the snapshot
+	if err = s.journal.truncate(); err != nil {
+		err = errors.Wrapf(err, "truncating journal %s failed", s.journal.path)
+		return
+	}
+	return
+}
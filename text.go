@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Encodings
+const (
+	encodingISO88591    = "ISO-8859-1"
+	encodingUTF16BE     = "UTF-16BE"
+	encodingUTF16LE     = "UTF-16LE"
+	encodingUTF8        = "UTF-8"
+	encodingWindows1252 = "Windows-1252"
+)
+
+// Line endings
+const (
+	lineEndingCR   = "CR"
+	lineEndingCRLF = "CRLF"
+	lineEndingLF   = "LF"
+)
+
+// Vars
+var (
+	bomUTF16BE = []byte{0xfe, 0xff}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+)
+
+// textInfo represents what has been detected about a text before normalizing it
+// LineEnding is empty when the text has a single line
+type textInfo struct {
+	BOM        bool   `json:"bom"`
+	Encoding   string `json:"encoding"`
+	LineEnding string `json:"line_ending"`
+}
+
+// normalizeText converts a text to UTF-8 without BOM and with "\n" line endings
+// Texts without BOM that are not valid UTF-8 are either UTF-16, when every other byte is a NUL one, or in a single
+// byte encoding which is Windows-1252 when it uses the bytes 0x80 to 0x9f and ISO-8859-1 otherwise
+func normalizeText(b []byte) (o []byte, i textInfo, err error) {
+	// Detect encoding
+	var e encoding.Encoding
+	switch {
+	case bytes.HasPrefix(b, bomUTF8):
+		i.BOM, i.Encoding = true, encodingUTF8
+		b = b[len(bomUTF8):]
+	case bytes.HasPrefix(b, bomUTF16LE):
+		i.BOM, i.Encoding = true, encodingUTF16LE
+		e, b = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), b[len(bomUTF16LE):]
+	case bytes.HasPrefix(b, bomUTF16BE):
+		i.BOM, i.Encoding = true, encodingUTF16BE
+		e, b = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), b[len(bomUTF16BE):]
+	case len(b) >= 4 && len(b)%2 == 0 && b[0] != 0 && b[1] == 0 && b[3] == 0:
+		i.Encoding, e = encodingUTF16LE, unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	case len(b) >= 4 && len(b)%2 == 0 && b[0] == 0 && b[1] != 0 && b[2] == 0:
+		i.Encoding, e = encodingUTF16BE, unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	case utf8.Valid(b):
+		i.Encoding = encodingUTF8
+	case hasWindows1252Bytes(b):
+		i.Encoding, e = encodingWindows1252, charmap.Windows1252
+	default:
+		i.Encoding, e = encodingISO88591, charmap.ISO8859_1
+	}
+
+	// Decode
+	if e != nil {
+		if b, err = e.NewDecoder().Bytes(b); err != nil {
+			err = errors.Wrapf(err, "decoding %s failed", i.Encoding)
+			return
+		}
+	}
+
+	// Detect line ending
+	var crlf = bytes.Count(b, []byte("\r\n"))
+	var cr, lf = bytes.Count(b, []byte("\r")) - crlf, bytes.Count(b, []byte("\n")) - crlf
+	switch {
+	case crlf > 0 && crlf >= cr && crlf >= lf:
+		i.LineEnding = lineEndingCRLF
+	case lf > 0 && lf >= cr:
+		i.LineEnding = lineEndingLF
+	case cr > 0:
+		i.LineEnding = lineEndingCR
+	}
+
+	// Normalize line endings
+	o = bytes.Replace(bytes.Replace(b, []byte("\r\n"), []byte("\n"), -1), []byte("\r"), []byte("\n"), -1)
+	return
+}
+
+// hasWindows1252Bytes checks whether a text has bytes that are only printable in Windows-1252
+func hasWindows1252Bytes(b []byte) bool {
+	for _, c := range b {
+		if c >= 0x80 && c <= 0x9f {
+			return true
+		}
+	}
+	return false
+}
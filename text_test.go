@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// utf16Bytes encodes a string in UTF-16 without BOM
+func utf16Bytes(s string, order binary.ByteOrder) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		var c = make([]byte, 2)
+		order.PutUint16(c, u)
+		b = append(b, c...)
+	}
+	return b
+}
+
+func TestNormalizeText(t *testing.T) {
+	for _, c := range []struct {
+		content []byte
+		info    textInfo
+		name    string
+		want    string
+	}{
+		{
+			content: []byte("Café;1\nThé;2\n"),
+			info:    textInfo{Encoding: encodingUTF8, LineEnding: lineEndingLF},
+			name:    "utf-8",
+			want:    "Café;1\nThé;2\n",
+		},
+		{
+			content: append(append([]byte{}, bomUTF8...), "Café;1\r\nThé;2\r\n"...),
+			info:    textInfo{BOM: true, Encoding: encodingUTF8, LineEnding: lineEndingCRLF},
+			name:    "utf-8 with bom",
+			want:    "Café;1\nThé;2\n",
+		},
+		{
+			content: append(append([]byte{}, bomUTF16LE...), utf16Bytes("Café;1\r\nThé;2", binary.LittleEndian)...),
+			info:    textInfo{BOM: true, Encoding: encodingUTF16LE, LineEnding: lineEndingCRLF},
+			name:    "utf-16le with bom",
+			want:    "Café;1\nThé;2",
+		},
+		{
+			content: append(append([]byte{}, bomUTF16BE...), utf16Bytes("Café;1\nThé;2", binary.BigEndian)...),
+			info:    textInfo{BOM: true, Encoding: encodingUTF16BE, LineEnding: lineEndingLF},
+			name:    "utf-16be with bom",
+			want:    "Café;1\nThé;2",
+		},
+		{
+			content: utf16Bytes("Café;1\nThé;2", binary.LittleEndian),
+			info:    textInfo{Encoding: encodingUTF16LE, LineEnding: lineEndingLF},
+			name:    "utf-16le without bom",
+			want:    "Café;1\nThé;2",
+		},
+		{
+			content: utf16Bytes("Café;1\nThé;2", binary.BigEndian),
+			info:    textInfo{Encoding: encodingUTF16BE, LineEnding: lineEndingLF},
+			name:    "utf-16be without bom",
+			want:    "Café;1\nThé;2",
+		},
+		{
+			content: []byte("Soci\xe9t\xe9 G\xe9n\xe9rale;1\rCaf\xe9;2"),
+			info:    textInfo{Encoding: encodingISO88591, LineEnding: lineEndingCR},
+			name:    "iso-8859-1",
+			want:    "Société Générale;1\nCafé;2",
+		},
+		{
+			content: []byte("Soci\xe9t\xe9 G\xe9n\xe9rale;1\r\nCaf\xe9 \x80;2"),
+			info:    textInfo{Encoding: encodingWindows1252, LineEnding: lineEndingCRLF},
+			name:    "windows-1252",
+			want:    "Société Générale;1\nCafé €;2",
+		},
+		{
+			content: []byte("Café;1"),
+			info:    textInfo{Encoding: encodingUTF8},
+			name:    "single line",
+			want:    "Café;1",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			o, i, err := normalizeText(c.content)
+			if err != nil {
+				t.Fatalf("normalizing failed: %v", err)
+			}
+			if string(o) != c.want {
+				t.Errorf("expected %q, got %q", c.want, o)
+			}
+			if i != c.info {
+				t.Errorf("expected %+v, got %+v", c.info, i)
+			}
+		})
+	}
+}
+
+func TestParseBankStatementLBP(t *testing.T) {
+	// The label of the header row and of an operation are accented
+	var lines = []string{
+		"Numéro Compte;0123",
+		"Type;CCP",
+		"Compte tenu en;euros",
+		"Date;31/01/2020",
+		"Solde (EUROS);100,00",
+		"Solde (FRANCS);655,96",
+		"",
+		"Date;Libellé;Montant(EUROS);Montant(FRANCS)",
+		"20/01/2020;Café;-10,00;-65,60",
+		"10/01/2020;Salaire;30,00;196,79",
+		"",
+	}
+	for _, c := range []struct {
+		encode     func(s string) []byte
+		encoding   string
+		lineEnding string
+		name       string
+	}{
+		{
+			encode:     func(s string) []byte { return []byte(strings.Replace(s, "\n", "\r\n", -1)) },
+			encoding:   encodingUTF8,
+			lineEnding: lineEndingCRLF,
+			name:       "utf-8 crlf",
+		},
+		{
+			encode:     func(s string) []byte { return []byte(s) },
+			encoding:   encodingUTF8,
+			lineEnding: lineEndingLF,
+			name:       "utf-8 lf",
+		},
+		{
+			encode: func(s string) []byte {
+				return []byte(strings.Replace(strings.Replace(s, "é", "\xe9", -1), "\n", "\r", -1))
+			},
+			encoding:   encodingISO88591,
+			lineEnding: lineEndingCR,
+			name:       "iso-8859-1 cr",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			// Write
+			var p = filepath.Join(t.TempDir(), "statement.csv")
+			if err := ioutil.WriteFile(p, c.encode(strings.Join(lines, "\n")), 0600); err != nil {
+				t.Fatalf("writing %s failed: %v", p, err)
+			}
+
+			// Parse
+			s, err := parseBankStatement([]Importer{lbpImporter{}}, p)
+			if err != nil {
+				t.Fatalf("parsing failed: %v", err)
+			}
+
+			// Check text
+			if s.Text.Encoding != c.encoding || s.Text.LineEnding != c.lineEnding {
+				t.Errorf("expected %s with %s line endings, got %+v", c.encoding, c.lineEnding, s.Text)
+			}
+
+			// Check operations
+			if len(s.Errors) > 0 {
+				t.Fatalf("expected no line errors, got %+v", s.Errors)
+			}
+			if len(s.Operations) != 2 || s.Operations[0].RawLabel != "Salaire" || s.Operations[1].RawLabel != "Café" {
+				t.Fatalf("expected operations Salaire and Café, got %+v", s.Operations)
+			}
+			if s.Account.Balance.Units != 800000 {
+				t.Errorf("expected opening balance of 800000 units, got %d", s.Account.Balance.Units)
+			}
+		})
+	}
+}